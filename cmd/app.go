@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jmjp/gopasswordless/internal/app"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// commandTimeout bounds the administrative commands, which only run a few queries.
+const commandTimeout = time.Minute
+
+var errUnknownAction = errors.New("unknown action")
+
+// setupLogger installs the global logger. The server logs at info level, to the
+// log file in dev; administrative commands only log errors so their output stays readable.
+func setupLogger(cfg *config.Config, level zapcore.Level) (func(), error) {
+	if level == zapcore.InfoLevel && cfg.IsDev() && cfg.LogFile != "" {
+		file, err := os.OpenFile(cfg.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("opening log file: %w", err)
+		}
+		zap.ReplaceGlobals(zap.New(zapcore.NewCore(
+			zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+			zapcore.AddSync(file),
+			level,
+		)))
+		return func() { file.Close() }, nil
+	}
+	logConfig := zap.NewProductionConfig()
+	logConfig.Level = zap.NewAtomicLevelAt(level)
+	logger, err := logConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+	zap.ReplaceGlobals(logger)
+	return func() { logger.Sync() }, nil
+}
+
+// withApp loads the configuration and the application wiring used by the
+// server, then runs fn with a bounded context.
+func withApp(configPath string, fn func(ctx context.Context, a *app.App) error) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	closeLogger, err := setupLogger(cfg, zapcore.ErrorLevel)
+	if err != nil {
+		return err
+	}
+	defer closeLogger()
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	a, err := app.New(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	return fn(ctx, a)
+}
+
+// action splits the arguments of a command into its action and the action flags.
+func action(args []string, actions ...string) (string, []string, error) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		return "", nil, fmt.Errorf("missing action, expected one of %v", actions)
+	}
+	for _, name := range actions {
+		if args[0] == name {
+			return name, args[1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("%w %q, expected one of %v", errUnknownAction, args[0], actions)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet("hyperzoop "+name, flag.ExitOnError)
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
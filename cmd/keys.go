@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"os"
+)
+
+var (
+	errMissingKeysFile = errors.New("-file is required when token_keys_file is not configured")
+	errSecretOnly      = errors.New("token_secret is an HS256 secret, ES256 keys need a keys file")
+)
+
+func runKeys(configPath string, args []string) error {
+	name, args, err := action(args, "generate", "rotate", "jwks")
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("keys " + name)
+	file := flags.String("file", "", "keys file, defaults to token_keys_file (generate prints a single secret for token_secret when neither is set)")
+	force := flags.Bool("force", false, "overwrite an existing keys file (generate only)")
+	alg := flags.String("alg", "", "HS256 or ES256, whose public keys can be published; generate defaults to HS256, rotate to the algorithm of the next key")
+	flags.Parse(args)
+
+	path := *file
+	if path == "" {
+		// keys may be generated before the rest of the configuration is valid
+		if cfg, err := config.Load(configPath); err == nil {
+			path = cfg.TokenKeysFile
+		}
+	}
+
+	switch name {
+	case "generate":
+		if *alg == "" {
+			*alg = token.AlgHS256
+		}
+		if path == "" {
+			if *alg != token.AlgHS256 {
+				return errSecretOnly
+			}
+			key, err := token.GenerateKey(*alg)
+			if err != nil {
+				return err
+			}
+			fmt.Println(key.Secret)
+			return nil
+		}
+		if _, err := os.Stat(path); err == nil && !*force {
+			return fmt.Errorf("%s already exists, use rotate or -force", path)
+		}
+		keys, err := token.NewKeySet(*alg)
+		if err != nil {
+			return err
+		}
+		if err := keys.Save(path); err != nil {
+			return err
+		}
+		fmt.Printf("generated %s with active key %s\n", path, keys.Active.ID)
+	case "rotate":
+		if path == "" {
+			return errMissingKeysFile
+		}
+		keys, err := token.LoadKeySet(path)
+		if err != nil {
+			return err
+		}
+		if err := keys.Rotate(*alg); err != nil {
+			return err
+		}
+		if err := keys.Save(path); err != nil {
+			return err
+		}
+		fmt.Printf("rotated %s, active key is now %s, servers pick it up within token_keys_reload\n", path, keys.Active.ID)
+	case "jwks":
+		if path == "" {
+			return errMissingKeysFile
+		}
+		keys, err := token.LoadKeySet(path)
+		if err != nil {
+			return err
+		}
+		jwks, err := json.MarshalIndent(keys.JWKS(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jwks))
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/app"
+)
+
+var errMissingEmail = errors.New("-email is required")
+
+func runLink(configPath string, args []string) error {
+	name, args, err := action(args, "issue")
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("link " + name)
+	email := flags.String("email", "", "email of an existing user")
+	flags.Parse(args)
+	if *email == "" {
+		return errMissingEmail
+	}
+
+	return withApp(configPath, func(ctx context.Context, a *app.App) error {
+		out, err := a.AuthService.IssueLink(ctx, *email)
+		if err != nil {
+			return err
+		}
+		// the link only verifies when the browser presents the cookie as _fingerprint
+		return printJSON(out)
+	})
+}
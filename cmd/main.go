@@ -1,61 +1,74 @@
 package main
 
 import (
-	"context"
-	"database/sql"
-	delivery "hyperzoop/internal/adapters/delivery/http"
+	"flag"
+	"fmt"
 	"os"
-
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
-	"github.com/redis/go-redis/v9"
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
+	"sort"
 )
 
+const usage = `hyperzoop runs and administers the HyperZoop passwordless authentication server.
+
+Usage:
+  hyperzoop [-config file] <command> <action> [flags]
+
+Commands:
+  serve                                   start the HTTP server (default)
+  migrate up | down [-steps n] | status   manage the database schema
+  user create | block | unblock | show    manage users
+  session list | revoke -user id          manage the sessions of a user
+  link issue -email address               print a magic link for support cases
+  keys generate | rotate | jwks           manage the token signing keys
+  purge expired                           delete expired magic links and sessions
+
+Run "hyperzoop <command> <action> -h" for the flags of an action.
+`
+
+// command runs a subcommand with the config file path and the remaining arguments.
+type command func(configPath string, args []string) error
+
+var commands = map[string]command{
+	"serve":   runServe,
+	"migrate": runMigrate,
+	"user":    runUser,
+	"session": runSession,
+	"link":    runLink,
+	"keys":    runKeys,
+	"purge":   runPurge,
+}
+
 func main() {
-	godotenv.Load()
-	logger := zap.Must(zap.NewProduction())
-	if os.Getenv("env") == "dev" {
-		file, err := os.OpenFile(os.Getenv("log_file"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-		if err != nil {
-			zap.L().Error("failed to open log file", zap.Error(err))
-			// handle error
-		}
-		defer file.Close()
-		logger = zap.New(zapcore.NewCore(
-			zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
-			zapcore.AddSync(file),
-			zapcore.InfoLevel,
-		))
+	global := flag.NewFlagSet("hyperzoop", flag.ExitOnError)
+	configPath := global.String("config", "", "path to a YAML or TOML config file (defaults to $config_file)")
+	global.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fmt.Fprintln(os.Stderr, "\nGlobal flags:")
+		global.PrintDefaults()
 	}
-	zap.ReplaceGlobals(logger)
-	postgres, _ := sql.Open("postgres", getEnvDB())
-	if err := postgres.Ping(); err != nil {
-		zap.L().Error("failed to connect pg database")
-		panic(err)
+	global.Parse(os.Args[1:])
+
+	args := global.Args()
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
 	}
-	opt, err := redis.ParseURL(os.Getenv("redis_url"))
-	if err != nil {
-		panic(err)
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "hyperzoop: unknown command %q, available: %v\n\n", name, commandNames())
+		global.Usage()
+		os.Exit(2)
 	}
-	redis := redis.NewClient(opt)
-	if err := redis.Ping(context.Background()).Err(); err != nil {
-		panic(err)
+	if err := run(*configPath, args); err != nil {
+		fmt.Fprintf(os.Stderr, "hyperzoop %s: %v\n", name, err)
+		os.Exit(1)
 	}
-	defer postgres.Close()
-	defer redis.Close()
-	delivery.NewHTTPServer(3000, postgres, redis).Start()
 }
 
-// !TODO: move to .env
-func getEnvDB() string {
-	switch os.Getenv("env") {
-	case "prod":
-		return os.Getenv("prod_db")
-	case "stagging":
-		return os.Getenv("stagging_db")
-	default:
-		return os.Getenv("dev_db")
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/migrate"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func runMigrate(configPath string, args []string) error {
+	name, args, err := action(args, "up", "down", "status")
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("migrate " + name)
+	steps := flags.Int("steps", 1, "number of migrations to roll back (down only)")
+	flags.Parse(args)
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	closeLogger, err := setupLogger(cfg, zapcore.InfoLevel)
+	if err != nil {
+		return err
+	}
+	defer closeLogger()
+	// migrations only need the database, so redis may still be unreachable
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	migrator, err := migrate.NewMigratorFor(ctx, db, cfg.DatabaseDialect)
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations %v (%s)\n", len(applied), applied, migrator.Dialect())
+	case "down":
+		rolledBack, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %d migrations %v (%s)\n", len(rolledBack), rolledBack, migrator.Dialect())
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tDESCRIPTION\tSTATE\tAPPLIED AT\tERROR")
+		for _, status := range statuses {
+			appliedAt := "-"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", status.Version, status.Description, status.State, appliedAt, status.Error)
+		}
+		return w.Flush()
+	}
+	return nil
+}
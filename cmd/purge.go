@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/app"
+	"time"
+)
+
+func runPurge(configPath string, args []string) error {
+	name, args, err := action(args, "expired")
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("purge " + name)
+	grace := flags.Duration("grace", 0, "keep rows that expired less than this long ago")
+	flags.Parse(args)
+
+	return withApp(configPath, func(ctx context.Context, a *app.App) error {
+		out, err := a.PurgeService.PurgeExpired(ctx, time.Now().Add(-*grace))
+		if err != nil {
+			return err
+		}
+		return printJSON(out)
+	})
+}
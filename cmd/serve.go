@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	delivery "github.com/jmjp/gopasswordless/internal/adapters/delivery/http"
+	"github.com/jmjp/gopasswordless/internal/adapters/geolocation"
+	"github.com/jmjp/gopasswordless/internal/app"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/migrate"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func runServe(configPath string, args []string) error {
+	newFlagSet("serve").Parse(args)
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+	closeLogger, err := setupLogger(cfg, zapcore.InfoLevel)
+	if err != nil {
+		return err
+	}
+	defer closeLogger()
+	shutdownTracing, err := telemetry.Setup(context.Background(), cfg)
+	if err != nil {
+		zap.L().Error("failed to setup tracing", zap.Error(err))
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	a, err := app.New(ctx, cfg)
+	if err != nil {
+		zap.L().Error("failed to start application", zap.Error(err))
+		return err
+	}
+	defer a.Close()
+	if cfg.AutoMigrate {
+		if err := migrateOnStart(cfg, a.DB); err != nil {
+			zap.L().Error("failed to migrate database", zap.Error(err))
+			return err
+		}
+	}
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go a.Keys.Watch(watchCtx, cfg.TokenKeysReload)
+	if locator, ok := a.GeoLocator.(*geolocation.MMDBLocator); ok {
+		go locator.Watch(watchCtx, cfg.GeoIPReload)
+	}
+	go a.Activity.Run(watchCtx)
+	a.Scheduler.Start(context.Background())
+	defer a.Scheduler.Stop()
+
+	delivery.NewHTTPServer(a).Start()
+	// write the refreshes counted since the last flush before closing the database
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelFlush()
+	if _, err := a.Activity.Flush(flushCtx); err != nil {
+		zap.L().Error("failed to write session activity", zap.Error(err))
+	}
+	return nil
+}
+
+// migrateOnStart applies pending migrations before serving, waiting for any
+// replica that is already migrating to finish.
+func migrateOnStart(cfg *config.Config, db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	migrator, err := migrate.NewMigratorFor(ctx, db, cfg.DatabaseDialect)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("database migrated", zap.String("dialect", migrator.Dialect()), zap.Strings("applied", applied))
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmjp/gopasswordless/internal/app"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+)
+
+var errMissingUserFlag = errors.New("-user is required")
+
+func runSession(configPath string, args []string) error {
+	name, args, err := action(args, "list", "revoke")
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("session " + name)
+	userId := flags.String("user", "", "id of the user owning the sessions")
+	sessionId := flags.String("session", "", "revoke only this session instead of all of them (revoke only)")
+	flags.Parse(args)
+	if *userId == "" {
+		return errMissingUserFlag
+	}
+
+	return withApp(configPath, func(ctx context.Context, a *app.App) error {
+		if name == "list" {
+			sessions, err := a.AuthService.Sessions(ctx, *userId, "")
+			if err != nil {
+				return err
+			}
+			return printJSON(sessions)
+		}
+		if *sessionId != "" {
+			if err := a.AuthService.Revoke(ctx, *sessionId, *userId); err != nil {
+				return err
+			}
+			fmt.Printf("revoked session %s\n", *sessionId)
+			return nil
+		}
+		out, err := a.AuthService.RevokeAll(ctx, *userId, dtos.ActorDTO{Operator: true})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("revoked %d sessions of user %s\n", out.Revoked, *userId)
+		return nil
+	})
+}
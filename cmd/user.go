@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/app"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+)
+
+var errMissingUser = errors.New("missing user id or email")
+
+func runUser(configPath string, args []string) error {
+	name, args, err := action(args, "create", "block", "unblock", "show")
+	if err != nil {
+		return err
+	}
+	flags := newFlagSet("user " + name)
+	email := flags.String("email", "", "email of the user to create (create only)")
+	username := flags.String("username", "", "username, generated when empty (create only)")
+	avatar := flags.String("avatar", "", "avatar URL (create only)")
+	flags.Parse(args)
+
+	return withApp(configPath, func(ctx context.Context, a *app.App) error {
+		var user *entities.User
+		var err error
+		switch name {
+		case "create":
+			input := dtos.LoginInputDTO{Email: *email}
+			if *username != "" {
+				input.Username = username
+			}
+			if *avatar != "" {
+				input.Avatar = avatar
+			}
+			user, err = a.UserService.Create(ctx, input)
+		default:
+			if flags.NArg() != 1 {
+				return errMissingUser
+			}
+			switch name {
+			case "block":
+				user, err = a.UserService.Block(ctx, flags.Arg(0))
+			case "unblock":
+				user, err = a.UserService.Unblock(ctx, flags.Arg(0))
+			case "show":
+				user, err = a.UserService.Find(ctx, flags.Arg(0))
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return printJSON(user)
+	})
+}
@@ -0,0 +1,30 @@
+package audit
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// LogAuditLog writes audit events to the application log under the "audit"
+// logger, with the trace they belong to.
+type LogAuditLog struct{}
+
+func NewLogAuditLog() *LogAuditLog {
+	return &LogAuditLog{}
+}
+
+func (l *LogAuditLog) Record(ctx context.Context, event *dtos.AuditEventDTO) error {
+	zap.L().Named("audit").Info(event.Action,
+		zap.String("actor_user_id", event.Actor.UserId),
+		zap.Bool("actor_operator", event.Actor.Operator),
+		zap.String("user_id", event.UserId),
+		zap.String("session_id", event.SessionId),
+		zap.Int64("count", event.Count),
+		zap.Time("at", event.At),
+		zap.String("trace_id", trace.SpanContextFromContext(ctx).TraceID().String()),
+	)
+	return nil
+}
@@ -1,39 +1,59 @@
 package controllers
 
 import (
-	"errors"
 	"fmt"
-	"hyperzoop/internal/core/ports"
-	"hyperzoop/internal/infra/dtos"
-	"hyperzoop/internal/infra/token"
+	"github.com/jmjp/gopasswordless/internal/adapters/delivery/http/middlewares"
+	"github.com/jmjp/gopasswordless/internal/core/errs"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"html/template"
 	"net/http"
-	"os"
 	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type AuthenticationController struct {
+	config      *config.Config
+	body        BodyOptions
 	authService ports.AuthService
 }
 
-func NewAuthenticationController(authService ports.AuthService) *AuthenticationController {
+var (
+	errMissingFingerprint  = errs.New("fingerprint_missing", http.StatusBadRequest, "fingerprint not found")
+	errMissingRefreshToken = errs.New("refresh_token_missing", http.StatusUnauthorized, "Refresh token not found")
+	// errStepUpRequired answers a sign-in held back as risky, with the message
+	// of the service telling where the confirmation link was sent.
+	errStepUpRequired = errs.New("step_up_required", http.StatusForbidden, "this sign-in must be confirmed with the link sent by email")
+)
+
+func NewAuthenticationController(config *config.Config, authService ports.AuthService) *AuthenticationController {
 	return &AuthenticationController{
+		config,
+		NewBodyOptions(config),
 		authService,
 	}
 }
 
+func (c *AuthenticationController) renderError(w http.ResponseWriter, r *http.Request, err error) {
+	RenderError(w, r, err, c.config.ProblemDetails)
+}
+
 // Login handles the authentication of a user.
 //
 // It takes in an http.ResponseWriter and an http.Request as parameters.
 // It does not return anything.
 func (c *AuthenticationController) Login(w http.ResponseWriter, r *http.Request) {
 	body := new(dtos.LoginInputDTO)
-	if err := RequestParseBody(r, body); err != nil {
-		ResponseError(w, http.StatusUnprocessableEntity, err.Error())
+	if err := RequestParseBody(w, r, body, c.body); err != nil {
+		c.renderError(w, r, err)
 		return
 	}
-	out, err := c.authService.Login(*body)
+	out, err := c.authService.Login(r.Context(), *body)
 	if err != nil {
-		ResponseError(w, http.StatusBadRequest, err.Error())
+		c.renderError(w, r, err)
 		return
 	}
 	http.SetCookie(w, &http.Cookie{
@@ -41,9 +61,9 @@ func (c *AuthenticationController) Login(w http.ResponseWriter, r *http.Request)
 		Value:    *out.Cookie,
 		Expires:  out.ExpiresIn,
 		Path:     "/",
-		Domain:   os.Getenv("app_host"),
+		Domain:   c.config.AppHost,
 		HttpOnly: true,
-		Secure:   os.Getenv("environment") == "prod",
+		Secure:   c.config.SecureCookies,
 	})
 	fmt.Println(out.Link)
 	ResponseMessage(w, http.StatusOK, out.Message)
@@ -60,12 +80,28 @@ func (c *AuthenticationController) Verify(w http.ResponseWriter, r *http.Request
 	token := r.URL.Query().Get("code")
 	fingerprint, err := r.Cookie("_fingerprint")
 	if err != nil {
-		ResponseError(w, http.StatusBadRequest, "fingerprint not found")
+		c.renderError(w, r, errMissingFingerprint)
 		return
 	}
-	out, err := c.authService.Verify(token, fingerprint.Value, r.RemoteAddr, r.Header.Get("User-Agent"))
+	out, err := c.authService.Verify(r.Context(), token, fingerprint.Value, middlewares.ClientIP(r), r.Header.Get("User-Agent"))
 	if err != nil {
-		ResponseError(w, http.StatusBadRequest, err.Error())
+		c.renderError(w, r, err)
+		return
+	}
+	if out.StepUp != nil {
+		// the confirmation link is bound to a new fingerprint
+		http.SetCookie(w, &http.Cookie{
+			Name:     "_fingerprint",
+			Value:    *out.StepUp.Cookie,
+			Expires:  out.StepUp.ExpiresIn,
+			Path:     "/",
+			Domain:   c.config.AppHost,
+			HttpOnly: true,
+			Secure:   c.config.SecureCookies,
+		})
+		stepUp := *errStepUpRequired
+		stepUp.Message = out.StepUp.Message
+		c.renderError(w, r, &stepUp)
 		return
 	}
 	http.SetCookie(w, &http.Cookie{
@@ -73,12 +109,53 @@ func (c *AuthenticationController) Verify(w http.ResponseWriter, r *http.Request
 		Value:    out.RefreshToken,
 		Expires:  out.ExpiresIn,
 		Path:     "/",
-		Domain:   os.Getenv("app_host"),
+		Domain:   c.config.AppHost,
 		HttpOnly: true,
-		Secure:   os.Getenv("environment") == "prod",
+		Secure:   c.config.SecureCookies,
 	})
-	res := map[string]interface{}{"user": out.User, "access_token": out.AccessToken}
-	ResponseJson(w, http.StatusOK, res)
+	ResponseJson(w, http.StatusOK, dtos.SignInOutputDTO{User: out.User, AccessToken: out.AccessToken})
+}
+
+// notMePage asks to confirm the "this wasn't me" link, posting its code back:
+// mail scanners open the links of emails and must not sign the device out.
+var notMePage = template.Must(template.New("not-me").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign out the new device</title>
+</head>
+<body>
+<h1>Wasn't you?</h1>
+<p>Signing out the device of the email also pauses new sign-in links for a while.</p>
+<form method="post">
+<input type="hidden" name="code" value="{{.}}">
+<button type="submit">Sign out the device</button>
+</form>
+</body>
+</html>
+`))
+
+// NotMePage answers the "this wasn't me" link of a new device notification
+// with a page confirming it, without signing anything out.
+func (c *AuthenticationController) NotMePage(w http.ResponseWriter, r *http.Request) {
+	defaultHeaders(w)
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// the code is in the URL
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+	notMePage.Execute(w, r.URL.Query().Get("code"))
+}
+
+// NotMe signs out the session reported by the code form field of a "this
+// wasn't me" link.
+func (c *AuthenticationController) NotMe(w http.ResponseWriter, r *http.Request) {
+	if err := c.authService.RejectSession(r.Context(), r.PostFormValue("code")); err != nil {
+		c.renderError(w, r, err)
+		return
+	}
+	ResponseMessage(w, http.StatusOK, "the device was signed out and new sign-in links are paused for a while")
 }
 
 // Logout logs out the user by revoking the session and deleting the refresh cookie.
@@ -96,19 +173,48 @@ func (c *AuthenticationController) Logout(w http.ResponseWriter, r *http.Request
 			Value:    "",
 			Expires:  time.Unix(0, 0),
 			Path:     "/",
-			Domain:   os.Getenv("app_host"),
+			Domain:   c.config.AppHost,
 			HttpOnly: true,
-			Secure:   os.Getenv("environment") == "prod",
+			Secure:   c.config.SecureCookies,
 		})
 	}
-	err := c.authService.Revoke(session, r.Context().Value("user").(*token.UserClaims).UserId)
+	err := c.authService.Revoke(r.Context(), session, r.Context().Value("user").(*token.UserClaims).UserId)
 	if err != nil {
-		ResponseError(w, http.StatusInternalServerError, err.Error())
+		c.renderError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// RevokeOthers signs the user out of every other device, keeping the session
+// of the _refresh cookie.
+func (c *AuthenticationController) RevokeOthers(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("user").(*token.UserClaims).UserId
+	refresh, err := r.Cookie("_refresh")
+	if err != nil {
+		c.renderError(w, r, errMissingRefreshToken)
+		return
+	}
+	out, err := c.authService.RevokeOthers(r.Context(), userId, refresh.Value)
+	if err != nil {
+		c.renderError(w, r, err)
+		return
+	}
+	ResponseJson(w, http.StatusOK, out)
+}
+
+// RevokeUserSessions signs the user of the {id} path parameter out everywhere,
+// for admins or that user.
+func (c *AuthenticationController) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	actor := dtos.ActorDTO{UserId: r.Context().Value("user").(*token.UserClaims).UserId}
+	out, err := c.authService.RevokeAll(r.Context(), chi.URLParam(r, "id"), actor)
+	if err != nil {
+		c.renderError(w, r, err)
+		return
+	}
+	ResponseJson(w, http.StatusOK, out)
+}
+
 // Refresh handles the refreshing of authentication tokens.
 //
 // It takes a http.ResponseWriter and a http.Request as parameters.
@@ -116,12 +222,12 @@ func (c *AuthenticationController) Logout(w http.ResponseWriter, r *http.Request
 func (c *AuthenticationController) Refresh(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("_refresh")
 	if err != nil {
-		ResponseError(w, http.StatusBadRequest, errors.New("Refresh token not found").Error())
+		c.renderError(w, r, errMissingRefreshToken)
 		return
 	}
-	out, err := c.authService.Refresh(cookie.Value)
+	out, err := c.authService.Refresh(r.Context(), cookie.Value, middlewares.ClientIP(r), r.Header.Get("User-Agent"))
 	if err != nil {
-		ResponseError(w, http.StatusInternalServerError, err.Error())
+		c.renderError(w, r, err)
 		return
 	}
 	ResponseJson(w, http.StatusOK, out)
@@ -135,12 +241,12 @@ func (c *AuthenticationController) Sessions(w http.ResponseWriter, r *http.Reque
 	userId := r.Context().Value("user").(*token.UserClaims).UserId
 	refresh, err := r.Cookie("_refresh")
 	if err != nil {
-		ResponseError(w, http.StatusBadRequest, errors.New("Refresh token not found").Error())
+		c.renderError(w, r, errMissingRefreshToken)
 		return
 	}
-	out, err := c.authService.Sessions(userId, refresh.Value)
+	out, err := c.authService.Sessions(r.Context(), userId, refresh.Value)
 	if err != nil {
-		ResponseError(w, http.StatusInternalServerError, err.Error())
+		c.renderError(w, r, err)
 		return
 	}
 	ResponseJson(w, http.StatusOK, out)
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAuthService answers Verify with out and records the codes of
+// RejectSession; the other methods are not used.
+type fakeAuthService struct {
+	ports.AuthService
+	out      *dtos.VerifyOutputDTO
+	rejected []string
+}
+
+func (s *fakeAuthService) RejectSession(ctx context.Context, code string) error {
+	s.rejected = append(s.rejected, code)
+	return nil
+}
+
+func (s *fakeAuthService) Verify(ctx context.Context, code, cookie, ip, ua string) (*dtos.VerifyOutputDTO, error) {
+	return s.out, nil
+}
+
+func verify(t *testing.T, out *dtos.VerifyOutputDTO, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	cfg := &config.Config{MaxBodySize: 1024}
+	c := NewAuthenticationController(cfg, &fakeAuthService{out: out})
+	r := httptest.NewRequest(http.MethodGet, "/auth/verify?code=abc", nil)
+	r.AddCookie(&http.Cookie{Name: "_fingerprint", Value: "old-fingerprint"})
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	c.Verify(rec, r)
+	return rec
+}
+
+func cookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestVerifySignsIn(t *testing.T) {
+	rec := verify(t, &dtos.VerifyOutputDTO{
+		User:         &entities.User{ID: "user-1"},
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresIn:    time.Now().Add(time.Hour),
+	}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if c := cookie(rec, "_refresh"); c == nil || c.Value != "refresh" {
+		t.Fatalf("_refresh cookie = %+v, want the refresh token", c)
+	}
+	var out dtos.SignInOutputDTO
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil || out.AccessToken != "access" {
+		t.Fatalf("body = %+v (%v), want the access token", out, err)
+	}
+}
+
+func TestVerifyStepUp(t *testing.T) {
+	fingerprint := "new-fingerprint"
+	out := &dtos.VerifyOutputDTO{
+		User: &entities.User{ID: "user-1"},
+		StepUp: &dtos.LoginOutputDTO{
+			Message:   "this sign-in must be confirmed, a new link was sent to user@hyperzoop.com",
+			Cookie:    &fingerprint,
+			ExpiresIn: time.Now().Add(5 * time.Minute),
+		},
+	}
+	for _, accept := range []string{"", problemJSON} {
+		rec := verify(t, out, accept)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("Accept %q: status = %d, want 403", accept, rec.Code)
+		}
+		if c := cookie(rec, "_fingerprint"); c == nil || c.Value != fingerprint {
+			t.Fatalf("Accept %q: _fingerprint cookie = %+v, want the one of the confirmation link", accept, c)
+		}
+		if c := cookie(rec, "_refresh"); c != nil {
+			t.Fatalf("Accept %q: _refresh cookie set on a step-up", accept)
+		}
+		var body struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Title   string `json:"title"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		message := body.Message
+		if accept == problemJSON {
+			message = body.Title
+		}
+		if body.Code != "step_up_required" || message != out.StepUp.Message {
+			t.Fatalf("Accept %q: body = %+v, want step_up_required and the message of the service", accept, body)
+		}
+	}
+}
+
+func TestResponseMessageStatus(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ResponseMessage(rec, http.StatusAccepted, "queued")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+}
+
+func TestNotMeConfirmsBeforeSigningOut(t *testing.T) {
+	service := &fakeAuthService{}
+	c := NewAuthenticationController(&config.Config{}, service)
+
+	// opening the link, as mail scanners do, signs nothing out
+	rec := httptest.NewRecorder()
+	c.NotMePage(rec, httptest.NewRequest(http.MethodGet, "/auth/not-me?code=%22%3E%3Cscript%3E", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("GET status = %d, Content-Type = %q, want the confirmation page", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if len(service.rejected) != 0 {
+		t.Fatalf("GET rejected %v, want nothing signed out", service.rejected)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `method="post"`) || !strings.Contains(body, `value="&#34;&gt;&lt;script&gt;"`) {
+		t.Fatalf("GET body = %s, want a form posting the escaped code", body)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/auth/not-me", strings.NewReader(url.Values{"code": {"abc"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	c.NotMe(rec, r)
+	if rec.Code != http.StatusOK || len(service.rejected) != 1 || service.rejected[0] != "abc" {
+		t.Fatalf("POST status = %d, rejected %v, want the session of abc signed out", rec.Code, service.rejected)
+	}
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"github.com/jmjp/gopasswordless/internal/infra/health"
+	"net/http"
+)
+
+type HealthController struct {
+	checker *health.Checker
+}
+
+func NewHealthController(checker *health.Checker) *HealthController {
+	return &HealthController{
+		checker,
+	}
+}
+
+// Liveness reports that the process is running and able to serve requests.
+//
+// It never checks dependencies, so an outage of Postgres or Redis does not get the pod restarted.
+func (c *HealthController) Liveness(w http.ResponseWriter, r *http.Request) {
+	ResponseJson(w, http.StatusOK, map[string]string{"status": health.StatusUp})
+}
+
+// Readiness runs every registered check and answers 503 with the report when any of them fails,
+// including while the server is shutting down.
+func (c *HealthController) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := c.checker.Run(r.Context())
+	if !report.Healthy() {
+		ResponseJson(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	ResponseJson(w, http.StatusOK, report)
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"github.com/jmjp/gopasswordless/internal/core/errs"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/scheduler"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"net/http"
+)
+
+var errAdminRequired = errs.New("forbidden", http.StatusForbidden, "only admins may see the background jobs")
+
+type JobsController struct {
+	config    *config.Config
+	scheduler *scheduler.Scheduler
+}
+
+func NewJobsController(config *config.Config, scheduler *scheduler.Scheduler) *JobsController {
+	return &JobsController{
+		config,
+		scheduler,
+	}
+}
+
+// Stats reports the last run of each background job on this replica, to
+// admins only.
+func (c *JobsController) Stats(w http.ResponseWriter, r *http.Request) {
+	if !r.Context().Value("user").(*token.UserClaims).HasScope(token.ScopeAdmin) {
+		RenderError(w, r, errAdminRequired, c.config.ProblemDetails)
+		return
+	}
+	ResponseJson(w, http.StatusOK, c.scheduler.Stats())
+}
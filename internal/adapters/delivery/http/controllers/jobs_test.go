@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/scheduler"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJobsStatsRequiresAdmin(t *testing.T) {
+	s := scheduler.NewScheduler(nil)
+	s.Register(&scheduler.Job{Name: "purge", Interval: time.Minute})
+	c := NewJobsController(&config.Config{}, s)
+	for scope, want := range map[string]int{
+		token.ScopeUser:                          http.StatusForbidden,
+		token.ScopeUser + " " + token.ScopeAdmin: http.StatusOK,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/healthz/jobs", nil)
+		r = r.WithContext(context.WithValue(r.Context(), "user", &token.UserClaims{UserId: "user", Scope: scope}))
+		rec := httptest.NewRecorder()
+		c.Stats(rec, r)
+		if rec.Code != want {
+			t.Fatalf("scope %q: status = %d, want %d", scope, rec.Code, want)
+		}
+	}
+}
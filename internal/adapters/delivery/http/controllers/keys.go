@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"net/http"
+)
+
+type KeysController struct {
+	keys *token.Keyring
+}
+
+func NewKeysController(keys *token.Keyring) *KeysController {
+	return &KeysController{
+		keys,
+	}
+}
+
+// JWKS serves the public keys that verify access tokens, for the services
+// using pkg/authz. They follow the keys file, so rotations are picked up
+// within token_keys_reload.
+func (c *KeysController) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	ResponseJson(w, http.StatusOK, c.keys.JWKS())
+}
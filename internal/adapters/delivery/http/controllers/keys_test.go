@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJWKSServesPublicKeysOnly(t *testing.T) {
+	set, err := token.NewKeySet(token.AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := set.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := token.OpenKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		keys *token.Keyring
+		want int
+	}{
+		{name: "ES256 keys file", keys: keys, want: 2},
+		{name: "token_secret", keys: token.NewStaticKeyring("secret"), want: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			NewKeysController(tt.keys).JWKS(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			body := rec.Body.String()
+			if strings.Contains(body, "secret") || strings.Contains(body, "PRIVATE") || strings.Contains(body, `"d"`) {
+				t.Fatalf("body = %s, leaks private key material", body)
+			}
+			var jwks token.JWKSet
+			if err := json.Unmarshal(rec.Body.Bytes(), &jwks); err != nil || len(jwks.Keys) != tt.want {
+				t.Fatalf("JWKS() = %s, %v, want %d keys", body, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/adapters/delivery/http/middlewares"
+	"github.com/jmjp/gopasswordless/internal/core/errs"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// OAuthController serves the endpoints resource servers use to check and
+// revoke tokens, behind middlewares.ClientAuthMiddleware. The token_type_hint
+// parameter is accepted but not needed: access tokens are JWTs and refresh
+// tokens session ids, so their shape tells them apart.
+type OAuthController struct {
+	authService ports.AuthService
+}
+
+func NewOAuthController(authService ports.AuthService) *OAuthController {
+	return &OAuthController{
+		authService,
+	}
+}
+
+// Introspect answers an RFC 7662 introspection request.
+func (c *OAuthController) Introspect(w http.ResponseWriter, r *http.Request) {
+	tok := r.PostFormValue("token")
+	if tok == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+	out, err := c.authService.Introspect(r.Context(), tok)
+	if err != nil {
+		renderOAuthError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	ResponseJson(w, http.StatusOK, out)
+}
+
+// Revoke answers an RFC 7009 revocation request, which succeeds for unknown
+// tokens too.
+func (c *OAuthController) Revoke(w http.ResponseWriter, r *http.Request) {
+	tok := r.PostFormValue("token")
+	if tok == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+	if err := c.authService.RevokeToken(r.Context(), tok, middlewares.ClientId(r)); err != nil {
+		renderOAuthError(w, err)
+		return
+	}
+	ResponseSendStatus(w, http.StatusOK)
+}
+
+// renderOAuthError answers an *errs.Error with its code, which the services
+// pick among the OAuth ones, and the other errors as an outage of the stores.
+func renderOAuthError(w http.ResponseWriter, err error) {
+	var e *errs.Error
+	if errors.As(err, &e) {
+		oauthError(w, e.Status, e.Code, e.Message)
+		return
+	}
+	zap.L().Error("oauth request failed", zap.Error(err))
+	oauthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "the token store is unavailable")
+}
+
+// oauthError writes the error response of RFC 6749 section 5.2.
+func oauthError(w http.ResponseWriter, status int, code, description string) {
+	ResponseJson(w, status, dtos.OAuthErrorOutputDTO{Error: code, ErrorDescription: description})
+}
@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"github.com/jmjp/gopasswordless/internal/infra/openapi"
+	"net/http"
+)
+
+type OpenAPIController struct {
+	document *openapi.Document
+}
+
+func NewOpenAPIController(document *openapi.Document) *OpenAPIController {
+	return &OpenAPIController{
+		document,
+	}
+}
+
+// Document serves the OpenAPI document of the API.
+func (c *OpenAPIController) Document(w http.ResponseWriter, r *http.Request) {
+	ResponseJson(w, http.StatusOK, c.document)
+}
@@ -2,35 +2,91 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/core/errs"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/validation"
 	"net/http"
 	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
 )
 
-// ParseBody parses the body of an HTTP request and unmarshals it into the provided value.
-//
-// It takes a pointer to an http.Request and a value of any type as parameters.
-// It returns an error.
-func RequestParseBody(r *http.Request, v any) error {
-	return json.NewDecoder(r.Body).Decode(v)
+// BodyOptions bounds the JSON bodies RequestParseBody decodes.
+type BodyOptions struct {
+	MaxBytes              int64
+	DisallowUnknownFields bool
 }
 
-func ResponseJson(w http.ResponseWriter, code int, body interface{}) {
-	defaultHeaders(w)
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(body)
+// NewBodyOptions reads max_body_size and disallow_unknown_fields.
+func NewBodyOptions(config *config.Config) BodyOptions {
+	return BodyOptions{
+		MaxBytes:              int64(config.MaxBodySize),
+		DisallowUnknownFields: config.DisallowUnknownFields,
+	}
+}
+
+// RequestParseBody decodes the JSON body of an HTTP request into v and checks
+// it against its validate tags. Its errors are answered by RenderError.
+func RequestParseBody(w http.ResponseWriter, r *http.Request, v any, opts BodyOptions) error {
+	return validation.DecodeJSON(http.MaxBytesReader(w, r.Body, opts.MaxBytes), v, opts.DisallowUnknownFields)
 }
 
-func ResponseError(w http.ResponseWriter, code int, message string) {
+// problemJSON is the media type of RFC 7807 problem details.
+const problemJSON = "application/problem+json"
+
+var (
+	errBodyTooLarge = errs.New("body_too_large", http.StatusRequestEntityTooLarge, "body is larger than max_body_size")
+	errInvalidBody  = errs.New("invalid_input", http.StatusUnprocessableEntity, "invalid request body")
+)
+
+// RenderError answers the error of a handler with the status, code and
+// message of its *errs.Error: 422 with the field errors of validation.Errors,
+// 413 for a body over max_body_size and 500 for the other errors, which are
+// only logged. The body is problem details when problemDetails is set or the
+// client accepts them.
+func RenderError(w http.ResponseWriter, r *http.Request, err error, problemDetails bool) {
+	var tooLarge *http.MaxBytesError
+	var fields validation.Errors
+	e := errs.From(err)
+	switch {
+	case errors.As(err, &tooLarge):
+		e = errBodyTooLarge
+	case errors.As(err, &fields):
+		e = errInvalidBody
+	}
+	if e.Status >= http.StatusInternalServerError {
+		zap.L().Error("request failed", zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Error(err))
+	}
+	if problemDetails || strings.Contains(r.Header.Get("Accept"), problemJSON) {
+		defaultHeaders(w)
+		w.Header().Set("Content-Type", problemJSON)
+		w.WriteHeader(e.Status)
+		json.NewEncoder(w).Encode(dtos.ProblemOutputDTO{
+			Type:     "urn:hyperzoop:problem:" + e.Code,
+			Title:    e.Message,
+			Status:   e.Status,
+			Instance: r.URL.Path,
+			Code:     e.Code,
+			Errors:   fields,
+		})
+		return
+	}
+	ResponseJson(w, e.Status, dtos.ErrorOutputDTO{Message: e.Message, StatusCode: strconv.Itoa(e.Status), Code: e.Code, Errors: fields})
+}
+
+func ResponseJson(w http.ResponseWriter, code int, body interface{}) {
 	defaultHeaders(w)
 	w.WriteHeader(code)
-	body := map[string]string{"message": message, "status_code": strconv.Itoa(code)}
 	json.NewEncoder(w).Encode(body)
 }
 
 func ResponseMessage(w http.ResponseWriter, code int, message string) {
 	defaultHeaders(w)
-	body := map[string]string{"message": message}
-	json.NewEncoder(w).Encode(body)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(dtos.MessageOutputDTO{Message: message})
 }
 
 func ResponseSendStatus(w http.ResponseWriter, code int) {
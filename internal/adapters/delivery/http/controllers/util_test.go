@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmjp/gopasswordless/internal/core/errs"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/validation"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRequestParseBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		opts       BodyOptions
+		wantStatus int
+		wantErrors validation.Errors
+	}{
+		{name: "valid", body: `{"email":"User@HyperZoop.com"}`, opts: BodyOptions{MaxBytes: 64}, wantStatus: http.StatusOK},
+		{name: "too large", body: `{"email":"user@hyperzoop.com","avatar":"https://hyperzoop.com/avatar.png"}`, opts: BodyOptions{MaxBytes: 32}, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "unknown field", body: `{"email":"user@hyperzoop.com","admin":true}`, opts: BodyOptions{MaxBytes: 64, DisallowUnknownFields: true}, wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: validation.Errors{{Field: "admin", Rule: "unknown", Message: "is not a field of the request"}}},
+		{name: "invalid fields", body: `{"email":"user","username":"a b"}`, opts: BodyOptions{MaxBytes: 64}, wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: validation.Errors{
+				{Field: "email", Rule: "email", Message: "must be an email address"},
+				{Field: "username", Rule: "username", Message: "must only contain letters, numbers, underscores and hyphens"},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(tt.body))
+			body := new(dtos.LoginInputDTO)
+			if err := RequestParseBody(rec, r, body, tt.opts); err != nil {
+				RenderError(rec, r, err, false)
+			} else {
+				if body.Email != "user@hyperzoop.com" {
+					t.Fatalf("email = %q, want it normalized", body.Email)
+				}
+				rec.WriteHeader(http.StatusOK)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantErrors == nil {
+				return
+			}
+			var out dtos.ErrorOutputDTO
+			if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+				t.Fatal(err)
+			}
+			if out.StatusCode != "422" || out.Code != "invalid_input" || !reflect.DeepEqual(out.Errors, tt.wantErrors) {
+				t.Fatalf("body = %+v, want the errors %+v", out, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	notFound := errs.New("session_not_found", http.StatusNotFound, "session not found")
+	tests := []struct {
+		name        string
+		err         error
+		accept      string
+		problem     bool
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{name: "domain error", err: notFound, wantStatus: http.StatusNotFound, wantCode: "session_not_found", wantMessage: "session not found"},
+		{name: "wrapped domain error", err: fmt.Errorf("revoking: %w", notFound.Wrap(errors.New("sql: no rows"))), wantStatus: http.StatusNotFound, wantCode: "session_not_found", wantMessage: "session not found"},
+		{name: "other errors are hidden", err: errors.New("pq: connection refused"), wantStatus: http.StatusInternalServerError, wantCode: "internal_error", wantMessage: errs.Internal.Message},
+		{name: "problem details asked for", err: notFound, accept: "application/problem+json, application/json", wantStatus: http.StatusNotFound, wantCode: "session_not_found", wantMessage: "session not found"},
+		{name: "problem details configured", err: notFound, problem: true, wantStatus: http.StatusNotFound, wantCode: "session_not_found", wantMessage: "session not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/auth/logout", nil)
+			r.Header.Set("Accept", tt.accept)
+			RenderError(rec, r, tt.err, tt.problem)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.accept == "" && !tt.problem {
+				var out dtos.ErrorOutputDTO
+				json.NewDecoder(rec.Body).Decode(&out)
+				if out.Code != tt.wantCode || out.Message != tt.wantMessage || out.StatusCode != strconv.Itoa(tt.wantStatus) {
+					t.Fatalf("body = %+v", out)
+				}
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Fatalf("Content-Type = %q", got)
+			}
+			var out dtos.ProblemOutputDTO
+			json.NewDecoder(rec.Body).Decode(&out)
+			want := dtos.ProblemOutputDTO{Type: "urn:hyperzoop:problem:" + tt.wantCode, Title: tt.wantMessage, Status: tt.wantStatus, Instance: "/auth/logout", Code: tt.wantCode}
+			if !reflect.DeepEqual(out, want) {
+				t.Fatalf("body = %+v, want %+v", out, want)
+			}
+		})
+	}
+}
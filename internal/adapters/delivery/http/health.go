@@ -0,0 +1,32 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmjp/gopasswordless/internal/infra/migrate"
+	"strings"
+)
+
+func (s *HTTPServer) setupHealthChecks() {
+	s.health.Register("postgres", s.app.DB.PingContext)
+	s.health.Register("redis", func(ctx context.Context) error {
+		return s.app.Redis.Ping(ctx).Err()
+	})
+	s.health.Register("migrations", func(ctx context.Context) error {
+		migrator, err := migrate.NewMigratorFor(ctx, s.app.DB, s.config.DatabaseDialect)
+		if err != nil {
+			return err
+		}
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations: %s", len(pending), strings.Join(pending, ", "))
+		}
+		return nil
+	})
+	s.health.Register("signing_key", func(ctx context.Context) error {
+		return s.app.Keys.Available()
+	})
+}
@@ -2,34 +2,57 @@ package middlewares
 
 import (
 	"context"
-	"hyperzoop/internal/infra/token"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
 	"net/http"
 	"strings"
+	"time"
+
+	"go.uber.org/zap"
 )
 
-func AutheMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		authorization := r.Header.Get("Authorization")
-		if len(authorization) == 0 {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-		tks := strings.Replace(authorization, "Bearer ", "", 1)
-		tks = strings.Trim(tks, " ")
-		if len(tks) == 0 {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+// AutheMiddleware returns a middleware that only lets requests through with an
+// access token signed by one of the keys, storing its claims in the "user" context value.
+// Tokens in the denylist are refused; when it can't be checked requests fail
+// with 503 rather than risk letting a revoked token through. A nil denylist
+// accepts every signed token.
+func AutheMiddleware(keys *token.Keyring, denylist ports.TokenDenylist) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			authorization := r.Header.Get("Authorization")
+			if len(authorization) == 0 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tks := strings.Replace(authorization, "Bearer ", "", 1)
+			tks = strings.Trim(tks, " ")
+			if len(tks) == 0 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
 
-		payload, err := token.ParseJwtAccessToken(tks)
-		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+			payload, err := token.ParseJwtAccessToken(keys, tks)
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if denylist != nil {
+				revoked, err := denylist.IsRevoked(r.Context(), payload.Id, payload.SessionId, payload.UserId, time.Unix(payload.IssuedAt, 0))
+				if err != nil {
+					zap.L().Error("error checking the token denylist", zap.Error(err))
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				if revoked {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+			}
 
-		ctx := context.WithValue(r.Context(), "user", payload)
-		r = r.WithContext(ctx)
+			ctx := context.WithValue(r.Context(), "user", payload)
+			r = r.WithContext(ctx)
 
-		next(w, r)
+			next(w, r)
+		}
 	}
 }
@@ -0,0 +1,63 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type stubDenylist struct {
+	revoked bool
+	err     error
+}
+
+func (d stubDenylist) RevokeToken(ctx context.Context, tokenId string) error { return nil }
+
+func (d stubDenylist) RevokeSessions(ctx context.Context, sessionIds ...string) error { return nil }
+
+func (d stubDenylist) RevokeUser(ctx context.Context, userId string, at time.Time) error { return nil }
+
+func (d stubDenylist) IsRevoked(ctx context.Context, tokenId, sessionId, userId string, issuedAt time.Time) (bool, error) {
+	return d.revoked, d.err
+}
+
+func TestAutheMiddlewareDenylist(t *testing.T) {
+	keys := token.NewStaticKeyring("test-secret")
+	accessToken, err := token.NewJwtAccessToken(keys, token.UserClaims{
+		UserId:         "user",
+		SessionId:      "session",
+		StandardClaims: jwt.StandardClaims{Id: "token", IssuedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Minute).Unix()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		denylist stubDenylist
+		want     int
+	}{
+		{name: "lets valid tokens through", want: http.StatusOK},
+		{name: "refuses revoked tokens", denylist: stubDenylist{revoked: true}, want: http.StatusUnauthorized},
+		{name: "fails closed when the denylist is down", denylist: stubDenylist{err: errors.New("down")}, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := AutheMiddleware(keys, tt.denylist)(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			r := httptest.NewRequest(http.MethodGet, "/auth/session", nil)
+			r.Header.Set("Authorization", "Bearer "+accessToken)
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
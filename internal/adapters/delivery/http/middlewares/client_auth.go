@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+)
+
+type clientIdKey struct{}
+
+// ClientAuthMiddleware returns a middleware that only lets through the OAuth
+// clients in secrets, authenticated with HTTP Basic or with the client_id and
+// client_secret form parameters as RFC 6749 section 2.3.1 allows.
+func ClientAuthMiddleware(secrets map[string]string) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id, secret, ok := r.BasicAuth()
+			if !ok {
+				id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+			}
+			want, known := secrets[id]
+			// compare anyway so unknown clients take as long as wrong secrets
+			if !known {
+				want = secret + "x"
+			}
+			if id == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(want)) != 1 || !known {
+				w.Header().Set("WWW-Authenticate", `Basic realm="hyperzoop"`)
+				w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"invalid_client"}` + "\n"))
+				return
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), clientIdKey{}, id)))
+		}
+	}
+}
+
+// ClientId returns the id of the client authenticated by ClientAuthMiddleware.
+func ClientId(r *http.Request) string {
+	id, _ := r.Context().Value(clientIdKey{}).(string)
+	return id
+}
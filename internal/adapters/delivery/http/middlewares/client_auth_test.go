@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestClientAuthMiddleware(t *testing.T) {
+	handler := ClientAuthMiddleware(map[string]string{"gateway": "secret"})(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ClientId(r)))
+	})
+	tests := []struct {
+		name   string
+		basic  []string
+		form   url.Values
+		want   int
+		client string
+	}{
+		{name: "accepts basic credentials", basic: []string{"gateway", "secret"}, want: http.StatusOK, client: "gateway"},
+		{name: "accepts form credentials", form: url.Values{"client_id": {"gateway"}, "client_secret": {"secret"}}, want: http.StatusOK, client: "gateway"},
+		{name: "refuses a wrong secret", basic: []string{"gateway", "wrong"}, want: http.StatusUnauthorized},
+		{name: "refuses an unknown client", basic: []string{"other", "secret"}, want: http.StatusUnauthorized},
+		{name: "refuses missing credentials", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/oauth/introspect", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.basic != nil {
+				r.SetBasicAuth(tt.basic[0], tt.basic[1])
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != tt.client {
+				t.Fatalf("client = %q, want %q", w.Body.String(), tt.client)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{name: "strips the port", remote: "203.0.113.7:51234", want: "203.0.113.7"},
+		{name: "strips the port of an ipv6 peer", remote: "[2001:db9::1]:443", want: "2001:db9::1"},
+		{name: "ignores headers from an untrusted peer", remote: "203.0.113.7:1", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, want: "203.0.113.7"},
+		{name: "uses x-forwarded-for from a trusted proxy", remote: "10.0.0.2:1", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "skips trusted hops", remote: "10.0.0.2:1", headers: map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.3"}, want: "198.51.100.1"},
+		{name: "stops at the first untrusted hop", remote: "10.0.0.2:1", headers: map[string]string{"X-Forwarded-For": "192.0.2.9, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "stops at an invalid hop", remote: "10.0.0.2:1", headers: map[string]string{"X-Forwarded-For": "garbage"}, want: "10.0.0.2"},
+		{name: "prefers forwarded", remote: "10.0.0.2:1", headers: map[string]string{"Forwarded": `for="[2001:db9::17]:4711";proto=https, for=10.0.0.3`, "X-Forwarded-For": "198.51.100.1"}, want: "2001:db9::17"},
+		{name: "falls back to x-real-ip", remote: "10.0.0.2:1", headers: map[string]string{"X-Real-IP": "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "unmaps ipv4 in ipv6", remote: "[::ffff:203.0.113.7]:1", want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := resolveClientIP(r, trusted); got != tt.want {
+				t.Fatalf("resolveClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
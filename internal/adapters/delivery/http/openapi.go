@@ -0,0 +1,242 @@
+package delivery
+
+import (
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/health"
+	"github.com/jmjp/gopasswordless/internal/infra/openapi"
+	"github.com/jmjp/gopasswordless/internal/infra/scheduler"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"net/http"
+)
+
+// Security schemes of the document.
+const (
+	securityBearer      = "bearer"
+	securityRefresh     = "refresh_cookie"
+	securityFingerprint = "fingerprint_cookie"
+	securityClient      = "oauth_client"
+)
+
+// apiDocument describes the routes of setupRoutes; routes_test.go fails when
+// a route is missing.
+func apiDocument() *openapi.Document {
+	d := openapi.New(openapi.Info{
+		Title:       "HyperZoop",
+		Version:     "0.0.1",
+		Description: "Passwordless authentication with magic links, sessions and OAuth token introspection.",
+	})
+	d.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		securityBearer:      {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "Access token returned by /auth/verify and /auth/refresh."},
+		securityRefresh:     {Type: "apiKey", In: "cookie", Name: "_refresh", Description: "Refresh token set by /auth/verify."},
+		securityFingerprint: {Type: "apiKey", In: "cookie", Name: "_fingerprint", Description: "Binds the magic link to the browser that asked for it; set by /auth/login."},
+		securityClient:      {Type: "http", Scheme: "basic", Description: "OAuth client credentials of oauth_clients, also accepted as the client_id and client_secret form fields."},
+	}
+
+	// clients get problem details when they accept them or problem_details is set
+	errorBody := openapi.JSON(d.Schema(dtos.ErrorOutputDTO{}))
+	errorBody["application/problem+json"] = openapi.MediaType{Schema: d.Schema(dtos.ProblemOutputDTO{})}
+	failure := func(description string) openapi.Response {
+		return openapi.Response{Description: description, Content: errorBody}
+	}
+	unexpected := failure("An unexpected error, whose details are logged.")
+	message := openapi.JSON(d.Schema(dtos.MessageOutputDTO{}))
+	oauthFailure := openapi.Response{Description: "invalid_request, unsupported_token_type or temporarily_unavailable.", Content: openapi.JSON(d.Schema(dtos.OAuthErrorOutputDTO{}))}
+	// the middleware answers without a body, the handlers with refresh_token_missing or session_expired
+	unauthorized := openapi.Response{Description: "The access token is missing, invalid or revoked, or the _refresh cookie is missing or expired.", Content: errorBody}
+	invalidClient := openapi.Response{
+		Description: "The client credentials are missing or wrong.",
+		Headers:     map[string]openapi.Header{"WWW-Authenticate": {Schema: &openapi.Schema{Type: "string"}}},
+		Content:     openapi.JSON(d.Schema(dtos.OAuthErrorOutputDTO{})),
+	}
+	bearer := []openapi.SecurityRequirement{{securityBearer: {}}}
+	code := openapi.Parameter{Name: "code", In: "query", Required: true, Description: "Code of the emailed link.", Schema: &openapi.Schema{Type: "string"}}
+	// RFC 7662 and RFC 7009 requests share their parameters
+	tokenForm := &openapi.RequestBody{Required: true, Content: openapi.Form(d.Schema(struct {
+		Token         string `json:"token"`
+		TokenTypeHint string `json:"token_type_hint,omitempty"`
+	}{}))}
+
+	d.Add(http.MethodGet, "/openapi.json", &openapi.Operation{
+		Summary:   "This document.",
+		Tags:      []string{"meta"},
+		Responses: map[string]openapi.Response{"200": {Description: "The OpenAPI document.", Content: openapi.JSON(&openapi.Schema{Type: "object"})}},
+	})
+	d.Add(http.MethodGet, "/.well-known/jwks.json", &openapi.Operation{
+		Summary:     "Public keys of the access tokens.",
+		Description: "The ES256 keys of token_keys_file as a JSON Web Key Set, looked up by the kid header of the tokens. HS256 keys are secrets and are never listed.",
+		Tags:        []string{"meta"},
+		Responses:   map[string]openapi.Response{"200": {Description: "The key set.", Content: openapi.JSON(d.Schema(token.JWKSet{}))}},
+	})
+
+	d.Add(http.MethodGet, "/healthz", &openapi.Operation{
+		Summary:     "Liveness.",
+		Description: "Never checks dependencies.",
+		Tags:        []string{"health"},
+		Responses: map[string]openapi.Response{"200": {Description: "The process is serving requests.", Content: openapi.JSON(d.Schema(struct {
+			Status string `json:"status"`
+		}{}))}},
+	})
+	report := openapi.JSON(d.Schema(health.Report{}))
+	d.Add(http.MethodGet, "/readyz", &openapi.Operation{
+		Summary: "Readiness, with the report of every dependency check.",
+		Tags:    []string{"health"},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "Every check succeeded.", Content: report},
+			"503": {Description: "A check failed or the server is shutting down.", Content: report},
+		},
+	})
+	d.Add(http.MethodGet, "/healthz/jobs", &openapi.Operation{
+		Summary:  "Last runs of the background jobs on this replica.",
+		Tags:     []string{"health"},
+		Security: bearer,
+		Responses: map[string]openapi.Response{
+			"200":     {Description: "The job statistics.", Content: openapi.JSON(d.Schema([]scheduler.Stats{}))},
+			"401":     unauthorized,
+			"403":     failure("forbidden: the access token lacks the admin scope."),
+			"default": unexpected,
+		},
+	})
+
+	d.Add(http.MethodPost, "/auth/login", &openapi.Operation{
+		Summary:     "Email a magic link.",
+		Description: "Sets the _fingerprint cookie the link must be opened with.",
+		Tags:        []string{"auth"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JSON(d.Schema(dtos.LoginInputDTO{}))},
+		Responses: map[string]openapi.Response{
+			"200":     {Description: "The link was sent.", Content: message},
+			"400":     failure("user_not_created: the user could not be created."),
+			"403":     failure("user_blocked: the user is blocked."),
+			"413":     failure("body_too_large: the body is larger than max_body_size."),
+			"422":     failure("invalid_input: the body is not valid JSON or breaks the rules of its fields, listed in errors."),
+			"429":     failure("links_paused: a session of the user was reported a moment ago."),
+			"default": unexpected,
+		},
+	})
+	d.Add(http.MethodGet, "/auth/verify", &openapi.Operation{
+		Summary:     "Sign in with the code of a magic link.",
+		Description: "Sets the _refresh cookie. A risky sign-in is refused with step_up_required and emails a confirmation link bound to a new _fingerprint cookie.",
+		Tags:        []string{"auth"},
+		Parameters:  []openapi.Parameter{code},
+		Security:    []openapi.SecurityRequirement{{securityFingerprint: {}}},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "The user and the access token.", Content: openapi.JSON(d.Schema(dtos.SignInOutputDTO{}))},
+			"400": failure("invalid_link or fingerprint_missing: the code or the fingerprint is invalid."),
+			"403": {
+				Description: "step_up_required: the sign-in must be confirmed with the link just emailed. user_blocked or sign_in_blocked: the user is blocked or the sign-in looks suspicious.",
+				Headers:     map[string]openapi.Header{"Set-Cookie": {Description: "The _fingerprint cookie of the confirmation link, on step_up_required.", Schema: &openapi.Schema{Type: "string"}}},
+				Content:     errorBody,
+			},
+			"404":     failure("link_not_found: the link expired, was used or belongs to another browser."),
+			"default": unexpected,
+		},
+	})
+	d.Add(http.MethodGet, "/auth/not-me", &openapi.Operation{
+		Summary:     "Confirm signing out the device of a new device notification.",
+		Description: "The link of the email. Opening it changes nothing, so mail scanners can follow it: the page posts the code to POST /auth/not-me once the user confirms.",
+		Tags:        []string{"auth"},
+		Parameters:  []openapi.Parameter{code},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "The confirmation page.", Content: map[string]openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}}},
+		},
+	})
+	d.Add(http.MethodPost, "/auth/not-me", &openapi.Operation{
+		Summary: "Sign out the device of a new device notification.",
+		Tags:    []string{"auth"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Form(d.Schema(struct {
+			Code string `json:"code"`
+		}{}))},
+		Responses: map[string]openapi.Response{
+			"200":     {Description: "The device was signed out.", Content: message},
+			"410":     failure("link_expired: the link expired or was already used."),
+			"default": unexpected,
+		},
+	})
+	d.Add(http.MethodPut, "/auth/logout", &openapi.Operation{
+		Summary:     "Sign a session out.",
+		Description: "Without the session parameter the _refresh cookie is deleted.",
+		Tags:        []string{"sessions"},
+		Parameters:  []openapi.Parameter{{Name: "session", In: "query", Description: "Id of the session.", Schema: &openapi.Schema{Type: "string"}}},
+		Security:    bearer,
+		Responses: map[string]openapi.Response{
+			"200":     {Description: "The session was revoked."},
+			"401":     unauthorized,
+			"403":     failure("forbidden: the session belongs to another user."),
+			"404":     failure("session_not_found: the session doesn't exist."),
+			"default": unexpected,
+		},
+	})
+	d.Add(http.MethodPost, "/auth/refresh", &openapi.Operation{
+		Summary:     "Get a new access token.",
+		Description: "refresh_token and expires_in are set when the session was extended.",
+		Tags:        []string{"auth"},
+		Security:    []openapi.SecurityRequirement{{securityRefresh: {}}},
+		Responses: map[string]openapi.Response{
+			"200":     {Description: "The new access token.", Content: openapi.JSON(d.Schema(dtos.RefreshOutputDTO{}))},
+			"401":     failure("refresh_token_missing, session_expired or reauthentication_required: the user must sign in again."),
+			"403":     failure("user_blocked or sign_in_blocked: the user is blocked or the refresh looks suspicious."),
+			"default": unexpected,
+		},
+	})
+	d.Add(http.MethodGet, "/auth/session", &openapi.Operation{
+		Summary:  "Sessions of the user.",
+		Tags:     []string{"sessions"},
+		Security: []openapi.SecurityRequirement{{securityBearer: {}, securityRefresh: {}}},
+		Responses: map[string]openapi.Response{
+			"200":     {Description: "The sessions, flagging the one of the _refresh cookie.", Content: openapi.JSON(d.Schema([]dtos.SessionsOutput{}))},
+			"401":     unauthorized,
+			"default": unexpected,
+		},
+	})
+	revoked := openapi.JSON(d.Schema(dtos.RevokeOutputDTO{}))
+	d.Add(http.MethodDelete, "/auth/session/others", &openapi.Operation{
+		Summary:  "Sign out every other session of the user.",
+		Tags:     []string{"sessions"},
+		Security: []openapi.SecurityRequirement{{securityBearer: {}, securityRefresh: {}}},
+		Responses: map[string]openapi.Response{
+			"200":     {Description: "The number of revoked sessions.", Content: revoked},
+			"401":     unauthorized,
+			"403":     failure("forbidden: the _refresh cookie is expired or belongs to another user."),
+			"default": unexpected,
+		},
+	})
+	d.Add(http.MethodDelete, "/admin/users/{id}/sessions", &openapi.Operation{
+		Summary:    "Sign a user out everywhere.",
+		Tags:       []string{"sessions"},
+		Parameters: []openapi.Parameter{{Name: "id", In: "path", Required: true, Description: "Id of the user.", Schema: &openapi.Schema{Type: "string"}}},
+		Security:   bearer,
+		Responses: map[string]openapi.Response{
+			"200":     {Description: "The number of revoked sessions.", Content: revoked},
+			"401":     unauthorized,
+			"403":     failure("forbidden: only admins and the user may do this."),
+			"default": unexpected,
+		},
+	})
+
+	d.Add(http.MethodPost, "/oauth/introspect", &openapi.Operation{
+		Summary:     "RFC 7662 token introspection.",
+		Description: "Inactive tokens only have active set.",
+		Tags:        []string{"oauth"},
+		RequestBody: tokenForm,
+		Security:    []openapi.SecurityRequirement{{securityClient: {}}},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "The state of the token.", Content: openapi.JSON(d.Schema(dtos.IntrospectionOutputDTO{}))},
+			"400": oauthFailure,
+			"401": invalidClient,
+			"503": oauthFailure,
+		},
+	})
+	d.Add(http.MethodPost, "/oauth/revoke", &openapi.Operation{
+		Summary:     "RFC 7009 token revocation.",
+		Description: "Succeeds for unknown tokens too.",
+		Tags:        []string{"oauth"},
+		RequestBody: tokenForm,
+		Security:    []openapi.SecurityRequirement{{securityClient: {}}},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "The token is no longer valid."},
+			"400": oauthFailure,
+			"401": invalidClient,
+			"503": oauthFailure,
+		},
+	})
+	return d
+}
@@ -1,32 +1,40 @@
 package delivery
 
 import (
-	"hyperzoop/internal/adapters/delivery/http/controllers"
-	"hyperzoop/internal/adapters/delivery/http/middlewares"
-	repositories "hyperzoop/internal/adapters/repositories/pg"
-	redisRepositories "hyperzoop/internal/adapters/repositories/redis"
-	"hyperzoop/internal/core/ports"
-	"hyperzoop/internal/core/services"
-	"os"
+	"github.com/jmjp/gopasswordless/internal/adapters/delivery/http/controllers"
+	"github.com/jmjp/gopasswordless/internal/adapters/delivery/http/middlewares"
 )
 
 func (s *HTTPServer) setupRoutes() {
-	userRepository := repositories.NewUserPostgresRepository(s.db)
-	var magicRepository ports.MagicLinkRepository
-	if os.Getenv("env") == "prod" {
-		magicRepository = redisRepositories.NewMagicLinkRedisRepository(s.redis)
-	} else {
-		magicRepository = repositories.NewMagicLinkPostgresRepository(s.db)
-	}
-	sessionRepository := repositories.NewSessionPostgresRepository(s.db)
+	authController := controllers.NewAuthenticationController(s.config, s.app.AuthService)
+	healthController := controllers.NewHealthController(s.health)
+	jobsController := controllers.NewJobsController(s.config, s.app.Scheduler)
+	keysController := controllers.NewKeysController(s.app.Keys)
+	oauthController := controllers.NewOAuthController(s.app.AuthService)
+	openAPIController := controllers.NewOpenAPIController(apiDocument())
 
-	authService := services.NewAuthService(userRepository, magicRepository, sessionRepository)
-	authController := controllers.NewAuthenticationController(authService)
+	s.router.Get("/openapi.json", openAPIController.Document)
+	s.router.Get("/.well-known/jwks.json", keysController.JWKS)
+
+	s.router.Get("/healthz", healthController.Liveness)
+	s.router.Get("/readyz", healthController.Readiness)
+
+	auth := middlewares.AutheMiddleware(s.app.Keys, s.app.Denylist)
+	s.router.Get("/healthz/jobs", auth(jobsController.Stats))
 
 	s.router.Post("/auth/login", authController.Login)
 	s.router.Get("/auth/verify", authController.Verify)
-	s.router.Put("/auth/logout", middlewares.AutheMiddleware(authController.Logout))
+	s.router.Get("/auth/not-me", authController.NotMePage)
+	s.router.Post("/auth/not-me", authController.NotMe)
+	s.router.Put("/auth/logout", auth(authController.Logout))
 	s.router.Post("/auth/refresh", authController.Refresh)
-	s.router.Get("/auth/session", middlewares.AutheMiddleware(authController.Sessions))
+	s.router.Get("/auth/session", auth(authController.Sessions))
+	s.router.Delete("/auth/session/others", auth(authController.RevokeOthers))
+	s.router.Delete("/admin/users/{id}/sessions", auth(authController.RevokeUserSessions))
 
+	// validated with the configuration
+	clientSecrets, _ := s.config.OAuthClientSecrets()
+	client := middlewares.ClientAuthMiddleware(clientSecrets)
+	s.router.Post("/oauth/introspect", client(oauthController.Introspect))
+	s.router.Post("/oauth/revoke", client(oauthController.Revoke))
 }
@@ -0,0 +1,98 @@
+package delivery
+
+import (
+	"encoding/json"
+	"github.com/jmjp/gopasswordless/internal/app"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/health"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func newTestServer() *HTTPServer {
+	cfg := &config.Config{}
+	return &HTTPServer{
+		app:    &app.App{Config: cfg},
+		config: cfg,
+		router: chi.NewRouter(),
+		health: health.NewChecker(time.Second),
+	}
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	s := newTestServer()
+	s.setupRoutes()
+	document := apiDocument()
+
+	routes := map[string]bool{}
+	err := chi.Walk(s.router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes[method+" "+route] = true
+		if document.Operation(method, route) == nil {
+			t.Errorf("%s %s is not in the OpenAPI document", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, item := range document.Paths {
+		for method := range item {
+			if !routes[strings.ToUpper(method)+" "+path] {
+				t.Errorf("%s %s is documented but not routed", method, path)
+			}
+		}
+	}
+}
+
+func TestServeOpenAPIDocument(t *testing.T) {
+	s := newTestServer()
+	s.setupRoutes()
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var document struct {
+		OpenAPI    string                    `json:"openapi"`
+		Paths      map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas         map[string]any `json:"schemas"`
+			SecuritySchemes map[string]any `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&document); err != nil {
+		t.Fatal(err)
+	}
+	if document.OpenAPI == "" || document.Paths["/auth/login"]["post"] == nil {
+		t.Fatalf("document = %+v", document)
+	}
+	for _, name := range []string{"LoginInputDTO", "ErrorOutputDTO", "SessionsOutput", "User"} {
+		if document.Components.Schemas[name] == nil {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+	for _, name := range []string{securityBearer, securityRefresh, securityFingerprint, securityClient} {
+		if document.Components.SecuritySchemes[name] == nil {
+			t.Errorf("security scheme %s is missing", name)
+		}
+	}
+}
+
+func TestStepUpIsDocumented(t *testing.T) {
+	verify := apiDocument().Operation(http.MethodGet, "/auth/verify")
+	forbidden, ok := verify.Responses["403"]
+	if !ok || !strings.Contains(forbidden.Description, "step_up_required") {
+		t.Fatalf("403 = %+v, want step_up_required", forbidden)
+	}
+	if _, ok := forbidden.Content["application/problem+json"]; !ok {
+		t.Fatal("403 has no problem details")
+	}
+	if _, ok := forbidden.Headers["Set-Cookie"]; !ok {
+		t.Fatal("403 doesn't document the new _fingerprint cookie")
+	}
+}
@@ -2,7 +2,10 @@ package delivery
 
 import (
 	"context"
-	"database/sql"
+	"github.com/jmjp/gopasswordless/internal/adapters/delivery/http/middlewares"
+	"github.com/jmjp/gopasswordless/internal/app"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/health"
 	"log"
 	"net/http"
 	"os"
@@ -15,35 +18,39 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
-	"github.com/redis/go-redis/v9"
 )
 
 type HTTPServer struct {
-	port   int
-	db     *sql.DB
-	redis  *redis.Client
+	app    *app.App
+	config *config.Config
 	router *chi.Mux
+	health *health.Checker
 }
 
-func NewHTTPServer(port int, db *sql.DB, redis *redis.Client) *HTTPServer {
+func NewHTTPServer(app *app.App) *HTTPServer {
 	router := chi.NewRouter()
 	return &HTTPServer{
-		port:   port,
-		db:     db,
-		redis:  redis,
+		app:    app,
+		config: app.Config,
 		router: router,
+		health: health.NewChecker(app.Config.HealthCheckTimeout),
 	}
 }
 func (s *HTTPServer) Start() {
 	server := &http.Server{
-		Addr:    ":" + strconv.Itoa(s.port),
-		Handler: s.router,
+		Addr:              ":" + strconv.Itoa(s.config.Port),
+		Handler:           s.router,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       s.config.RequestTimeout,
+		WriteTimeout:      s.config.RequestTimeout + 5*time.Second,
+		IdleTimeout:       2 * time.Minute,
 	}
 	s.setupMiddlewares()
+	s.setupHealthChecks()
 	s.setupRoutes()
 
 	go func() {
-		log.Printf("Starting HTTP server on port %d\n", s.port)
+		log.Printf("Starting HTTP server on port %d\n", s.config.Port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("HTTP server error: %v", err)
 		}
@@ -53,7 +60,13 @@ func (s *HTTPServer) Start() {
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM)
 	<-sc
-	ctx, shutdown := context.WithTimeout(context.Background(), 10*time.Minute)
+	// fail readiness first and give load balancers time to stop sending traffic
+	s.health.ShutDown()
+	// let a running background job finish its batch while the server drains
+	s.app.Scheduler.Stop()
+	log.Printf("HTTP server draining for %s\n", s.config.ShutdownDrainDelay)
+	time.Sleep(s.config.ShutdownDrainDelay)
+	ctx, shutdown := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
 	defer shutdown()
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("HTTP server error: %v", err)
@@ -62,14 +75,22 @@ func (s *HTTPServer) Start() {
 }
 
 func (s *HTTPServer) setupMiddlewares() {
-	s.router.Use(httprate.LimitByIP(100, 1*time.Minute))
+	// validated with the configuration
+	trustedProxies, _ := s.config.TrustedProxyPrefixes()
+	s.router.Use(middlewares.ClientIPMiddleware(trustedProxies))
+	s.router.Use(middlewares.TracingMiddleware)
+	s.router.Use(httprate.Limit(100, 1*time.Minute, httprate.WithKeyFuncs(func(r *http.Request) (string, error) {
+		return middlewares.ClientIP(r), nil
+	})))
 	s.router.Use(middleware.CleanPath)
-	if os.Getenv("env") == "dev" {
+	// every handler, and the queries it runs with r.Context(), is cancelled once the deadline expires
+	s.router.Use(middleware.Timeout(s.config.RequestTimeout))
+	if s.config.IsDev() {
 		s.router.Use(middleware.Logger)
 		s.router.Use(cors.AllowAll().Handler)
 	} else {
 		s.router.Use(cors.Handler(cors.Options{
-			AllowedOrigins:   []string{"https://*.hyperzoop.com"},
+			AllowedOrigins:   s.config.CORSOrigins,
 			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 			ExposedHeaders:   []string{"Link"},
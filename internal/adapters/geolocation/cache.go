@@ -0,0 +1,46 @@
+package geolocation
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const cachePrefix = "hyperzoop:cache:geolocation:"
+
+// CachedLocator remembers the answers of another locator, unknown addresses
+// included, so a slow or rate limited provider is asked once per address and ttl.
+type CachedLocator struct {
+	next  ports.GeoLocator
+	cache ports.RedisCacheRepository
+	ttl   time.Duration
+}
+
+func NewCachedLocator(next ports.GeoLocator, cache ports.RedisCacheRepository, ttl time.Duration) *CachedLocator {
+	return &CachedLocator{next: next, cache: cache, ttl: ttl}
+}
+
+func (l *CachedLocator) Locate(ctx context.Context, ip string) (*dtos.GeoLocationOutputDTO, error) {
+	raw, err := l.cache.Get(ctx, cachePrefix+ip)
+	if err == nil {
+		var out *dtos.GeoLocationOutputDTO
+		if err := json.Unmarshal([]byte(raw), &out); err == nil {
+			return out, nil
+		}
+	} else if err != ports.ErrCacheMiss {
+		zap.L().Error("error reading geolocation cache", zap.Error(err))
+	}
+	out, err := l.next.Locate(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	bytes, _ := json.Marshal(out)
+	if err := l.cache.Set(ctx, cachePrefix+ip, string(bytes), l.ttl); err != nil {
+		zap.L().Error("error writing geolocation cache", zap.Error(err))
+	}
+	return out, nil
+}
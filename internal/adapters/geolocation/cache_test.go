@@ -0,0 +1,89 @@
+package geolocation
+
+import (
+	"context"
+	"errors"
+	repositories "github.com/jmjp/gopasswordless/internal/adapters/repositories/memory"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"testing"
+	"time"
+)
+
+// failingCache fails every call, like a Redis that is down.
+type failingCache struct{}
+
+func (failingCache) Set(ctx context.Context, key, value string, expiration time.Duration) error {
+	return errors.New("redis is down")
+}
+
+func (failingCache) Get(ctx context.Context, key string) (string, error) {
+	return "", errors.New("redis is down")
+}
+
+func (failingCache) Take(ctx context.Context, key string) (string, error) {
+	return "", errors.New("redis is down")
+}
+
+func (failingCache) Invalidate(ctx context.Context, key string) error {
+	return errors.New("redis is down")
+}
+
+var _ ports.RedisCacheRepository = failingCache{}
+
+func TestCachedLocator(t *testing.T) {
+	ctx := context.Background()
+	clk := clock.NewFake(time.Now())
+	next := NewFakeLocator(map[string]*dtos.GeoLocationOutputDTO{"203.0.113.7": {Ip: "203.0.113.7", Country: "FR"}})
+	l := NewCachedLocator(next, repositories.NewRedisCacheMemoryRepository(clk), time.Hour)
+
+	for i := 0; i < 2; i++ {
+		out, err := l.Locate(ctx, "203.0.113.7")
+		if err != nil || out == nil || out.Country != "FR" {
+			t.Fatalf("Locate() = %+v, %v", out, err)
+		}
+		// unknown addresses are remembered too
+		if out, err := l.Locate(ctx, "198.51.100.1"); out != nil || err != nil {
+			t.Fatalf("Locate() of an unknown address = %+v, %v, want nothing", out, err)
+		}
+	}
+	if lookups := next.Lookups(); len(lookups) != 2 {
+		t.Fatalf("looked up %v, want each address once", lookups)
+	}
+
+	clk.Advance(time.Hour + time.Second)
+	if _, err := l.Locate(ctx, "203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	if lookups := next.Lookups(); len(lookups) != 3 {
+		t.Fatalf("looked up %v, want the address looked up again once its ttl passed", lookups)
+	}
+}
+
+func TestCachedLocatorErrors(t *testing.T) {
+	ctx := context.Background()
+	next := NewFakeLocator(map[string]*dtos.GeoLocationOutputDTO{"203.0.113.7": {Ip: "203.0.113.7", Country: "FR"}})
+
+	// a failing cache is a miss
+	l := NewCachedLocator(next, failingCache{}, time.Hour)
+	for i := 0; i < 2; i++ {
+		if out, err := l.Locate(ctx, "203.0.113.7"); err != nil || out == nil || out.Country != "FR" {
+			t.Fatalf("Locate() with a failing cache = %+v, %v, want the location", out, err)
+		}
+	}
+	if lookups := next.Lookups(); len(lookups) != 2 {
+		t.Fatalf("looked up %v, want every lookup passed to the locator", lookups)
+	}
+
+	// failures of the locator are not cached
+	cached := NewCachedLocator(next, repositories.NewRedisCacheMemoryRepository(clock.System), time.Hour)
+	next.Fail(errors.New("rate limited"))
+	if _, err := cached.Locate(ctx, "203.0.113.7"); err == nil {
+		t.Fatal("Locate() error = nil, want the error of the locator")
+	}
+	next.Fail(nil)
+	if out, err := cached.Locate(ctx, "203.0.113.7"); err != nil || out == nil {
+		t.Fatalf("Locate() after a failure = %+v, %v, want the location", out, err)
+	}
+}
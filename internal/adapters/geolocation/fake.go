@@ -0,0 +1,43 @@
+package geolocation
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"sync"
+)
+
+// FakeLocator answers from a fixed table, for tests.
+type FakeLocator struct {
+	mu        sync.Mutex
+	locations map[string]*dtos.GeoLocationOutputDTO
+	err       error
+	lookups   []string
+}
+
+func NewFakeLocator(locations map[string]*dtos.GeoLocationOutputDTO) *FakeLocator {
+	return &FakeLocator{locations: locations}
+}
+
+// Fail makes every following lookup return err.
+func (l *FakeLocator) Fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+}
+
+// Lookups returns the addresses looked up so far.
+func (l *FakeLocator) Lookups() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lookups...)
+}
+
+func (l *FakeLocator) Locate(ctx context.Context, ip string) (*dtos.GeoLocationOutputDTO, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lookups = append(l.lookups, ip)
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.locations[ip], nil
+}
@@ -0,0 +1,75 @@
+package geolocation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+type geoJsLocation struct {
+	Ip               string  `json:"ip"`
+	Latitude         string  `json:"latitude"`
+	Longitude        string  `json:"longitude"`
+	City             *string `json:"city"`
+	Region           *string `json:"region"`
+	Country          string  `json:"country"`
+	OrganizationName string  `json:"organization_name"`
+}
+
+// HTTPLocator asks the geojs.io API, one request per lookup.
+type HTTPLocator struct {
+	client  *http.Client
+	baseURL string
+}
+
+func NewHTTPLocator(timeout time.Duration) *HTTPLocator {
+	return &HTTPLocator{
+		// traces every lookup and propagates the trace context to the provider
+		client: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   timeout,
+		},
+		baseURL: "https://get.geojs.io/v1/ip/geo/",
+	}
+}
+
+func (l *HTTPLocator) Locate(ctx context.Context, ip string) (out *dtos.GeoLocationOutputDTO, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "HTTPLocator.Locate")
+	defer func() { telemetry.EndSpan(span, err) }()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.baseURL+ip+".json", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geolocation provider answered %s", resp.Status)
+	}
+	var loc geoJsLocation
+	if err := json.NewDecoder(resp.Body).Decode(&loc); err != nil {
+		return nil, err
+	}
+	if loc.Latitude == "" && loc.Longitude == "" {
+		return nil, nil
+	}
+	out = &dtos.GeoLocationOutputDTO{
+		Ip:               loc.Ip,
+		City:             loc.City,
+		Region:           loc.Region,
+		Country:          loc.Country,
+		OrganizationName: loc.OrganizationName,
+	}
+	out.Latitude, _ = strconv.ParseFloat(loc.Latitude, 64)
+	out.Longitude, _ = strconv.ParseFloat(loc.Longitude, 64)
+	return out, nil
+}
@@ -0,0 +1,90 @@
+package geolocation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestHTTPLocator points an HTTPLocator with timeout at handler.
+func newTestHTTPLocator(t *testing.T, timeout time.Duration, handler http.HandlerFunc) *HTTPLocator {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	l := NewHTTPLocator(timeout)
+	l.baseURL = server.URL + "/v1/ip/geo/"
+	return l
+}
+
+func TestHTTPLocator(t *testing.T) {
+	var path string
+	l := newTestHTTPLocator(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.URL.Path == "/v1/ip/geo/198.51.100.1.json" {
+			// geojs answers unknown addresses without coordinates
+			w.Write([]byte(`{"ip":"198.51.100.1","country":""}`))
+			return
+		}
+		w.Write([]byte(`{"ip":"203.0.113.7","latitude":"48.85","longitude":"2.35","city":"Paris","region":"Ile-de-France","country":"FR","organization_name":"Example ISP"}`))
+	})
+	out, err := l.Locate(context.Background(), "203.0.113.7")
+	if err != nil || out == nil {
+		t.Fatalf("Locate() = %+v, %v", out, err)
+	}
+	if path != "/v1/ip/geo/203.0.113.7.json" {
+		t.Fatalf("asked %s", path)
+	}
+	if out.Latitude != 48.85 || out.Longitude != 2.35 || out.City == nil || *out.City != "Paris" || out.Country != "FR" || out.OrganizationName != "Example ISP" {
+		t.Fatalf("Locate() = %+v", out)
+	}
+	if out, err := l.Locate(context.Background(), "198.51.100.1"); out != nil || err != nil {
+		t.Fatalf("Locate() of an unknown address = %+v, %v, want nothing", out, err)
+	}
+}
+
+func TestHTTPLocatorFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{name: "error status", handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}},
+		{name: "invalid body", handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<html>"))
+		}},
+		{name: "timeout", handler: func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestHTTPLocator(t, 50*time.Millisecond, tt.handler)
+			start := time.Now()
+			out, err := l.Locate(context.Background(), "203.0.113.7")
+			if err == nil || out != nil {
+				t.Fatalf("Locate() = %+v, %v, want an error", out, err)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Fatalf("Locate() took %s, want it cut at the timeout", elapsed)
+			}
+		})
+	}
+}
+
+func TestHTTPLocatorCanceled(t *testing.T) {
+	l := newTestHTTPLocator(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Locate(ctx, "203.0.113.7"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Locate() error = %v, want the deadline of the context", err)
+	}
+}
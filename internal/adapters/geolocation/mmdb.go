@@ -0,0 +1,167 @@
+package geolocation
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"go.uber.org/zap"
+)
+
+// cityRecord holds the fields shared by the MaxMind GeoIP2/GeoLite2 City and
+// DB-IP City databases.
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// asnRecord holds the fields of the MaxMind GeoLite2 ASN and DB-IP ASN databases.
+type asnRecord struct {
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// mmdbFile is a database file reloaded whenever its modification time changes.
+type mmdbFile struct {
+	path    string
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+}
+
+func openMMDBFile(path string) (*mmdbFile, error) {
+	f := &mmdbFile{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reload reads the file again if it changed. The whole file is loaded in
+// memory, so replacing it on disk never affects lookups in progress.
+func (f *mmdbFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	f.mu.RLock()
+	unchanged := f.reader != nil && info.ModTime().Equal(f.modTime)
+	f.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	reader, err := maxminddb.FromBytes(content)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", f.path, err)
+	}
+	f.mu.Lock()
+	f.reader, f.modTime = reader, info.ModTime()
+	f.mu.Unlock()
+	zap.L().Info("geolocation database loaded", zap.String("path", f.path), zap.String("type", reader.Metadata.DatabaseType))
+	return nil
+}
+
+func (f *mmdbFile) lookup(ip net.IP, record any) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok, err := f.reader.LookupNetwork(ip, record)
+	return ok, err
+}
+
+// MMDBLocator reads MaxMind or DB-IP .mmdb files locally: a city database and,
+// optionally, an ASN database for the organization name.
+type MMDBLocator struct {
+	city *mmdbFile
+	asn  *mmdbFile
+}
+
+func NewMMDBLocator(cityPath, asnPath string) (*MMDBLocator, error) {
+	city, err := openMMDBFile(cityPath)
+	if err != nil {
+		return nil, err
+	}
+	l := &MMDBLocator{city: city}
+	if asnPath != "" {
+		if l.asn, err = openMMDBFile(asnPath); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Watch reloads the files every interval when they changed on disk, until ctx is done.
+func (l *MMDBLocator) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, f := range []*mmdbFile{l.city, l.asn} {
+				if f == nil {
+					continue
+				}
+				if err := f.reload(); err != nil {
+					zap.L().Error("error reloading geolocation database", zap.Error(err), zap.String("path", f.path))
+				}
+			}
+		}
+	}
+}
+
+func (l *MMDBLocator) Locate(ctx context.Context, ip string) (out *dtos.GeoLocationOutputDTO, err error) {
+	_, span := telemetry.StartSpan(ctx, "MMDBLocator.Locate")
+	defer func() { telemetry.EndSpan(span, err) }()
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid ip address %q", ip)
+	}
+	var city cityRecord
+	found, err := l.city.lookup(addr, &city)
+	if err != nil || !found || city.Location.Latitude == nil || city.Location.Longitude == nil {
+		return nil, err
+	}
+	out = &dtos.GeoLocationOutputDTO{
+		Ip:        ip,
+		Latitude:  *city.Location.Latitude,
+		Longitude: *city.Location.Longitude,
+		Country:   city.Country.IsoCode,
+	}
+	if name, ok := city.City.Names["en"]; ok {
+		out.City = &name
+	}
+	if len(city.Subdivisions) > 0 {
+		if name, ok := city.Subdivisions[0].Names["en"]; ok {
+			out.Region = &name
+		}
+	}
+	if l.asn != nil {
+		var asn asnRecord
+		if _, err := l.asn.lookup(addr, &asn); err != nil {
+			return nil, err
+		}
+		out.OrganizationName = asn.Organization
+	}
+	return out, nil
+}
@@ -0,0 +1,160 @@
+package geolocation
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// writeMMDB writes a database of databaseType mapping 203.0.113.0/24 to record.
+func writeMMDB(t *testing.T, path, databaseType string, record mmdbtype.Map) {
+	t.Helper()
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: databaseType, IncludeReservedNetworks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, network, _ := net.ParseCIDR("203.0.113.0/24")
+	if err := tree.Insert(network, record); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := tree.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func cityMMDB(city string) mmdbtype.Map {
+	return mmdbtype.Map{
+		"city":         mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(city)}},
+		"subdivisions": mmdbtype.Slice{mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String("Ile-de-France")}}},
+		"country":      mmdbtype.Map{"iso_code": mmdbtype.String("FR")},
+		"location":     mmdbtype.Map{"latitude": mmdbtype.Float64(48.85), "longitude": mmdbtype.Float64(2.35)},
+	}
+}
+
+// touch moves the modification time of path forward, as a new download would.
+func touch(t *testing.T, path string, at time.Time) {
+	t.Helper()
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMMDBLocator(t *testing.T) {
+	dir := t.TempDir()
+	cityPath, asnPath := filepath.Join(dir, "city.mmdb"), filepath.Join(dir, "asn.mmdb")
+	writeMMDB(t, cityPath, "GeoLite2-City", cityMMDB("Paris"))
+	writeMMDB(t, asnPath, "GeoLite2-ASN", mmdbtype.Map{"autonomous_system_organization": mmdbtype.String("Example ISP")})
+	l, err := NewMMDBLocator(cityPath, asnPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	out, err := l.Locate(ctx, "203.0.113.7")
+	if err != nil || out == nil {
+		t.Fatalf("Locate() = %+v, %v", out, err)
+	}
+	if out.City == nil || *out.City != "Paris" || out.Region == nil || *out.Region != "Ile-de-France" || out.Country != "FR" || out.Latitude != 48.85 || out.Longitude != 2.35 || out.OrganizationName != "Example ISP" {
+		t.Fatalf("Locate() = %+v", out)
+	}
+	if out, err := l.Locate(ctx, "198.51.100.1"); out != nil || err != nil {
+		t.Fatalf("Locate() of an unknown address = %+v, %v, want nothing", out, err)
+	}
+	if _, err := l.Locate(ctx, "not an ip"); err == nil {
+		t.Fatal("Locate() of an invalid address error = nil")
+	}
+	if _, err := NewMMDBLocator(filepath.Join(dir, "missing.mmdb"), ""); err == nil {
+		t.Fatal("NewMMDBLocator() of a missing file error = nil")
+	}
+}
+
+func TestMMDBFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeMMDB(t, path, "GeoLite2-City", cityMMDB("Paris"))
+	loaded := time.Now().Add(-time.Hour)
+	touch(t, path, loaded)
+	l, err := NewMMDBLocator(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	city := func() string {
+		t.Helper()
+		out, err := l.Locate(context.Background(), "203.0.113.7")
+		if err != nil || out == nil || out.City == nil {
+			t.Fatalf("Locate() = %+v, %v", out, err)
+		}
+		return *out.City
+	}
+
+	// the same modification time keeps the loaded database
+	writeMMDB(t, path, "GeoLite2-City", cityMMDB("Lyon"))
+	touch(t, path, loaded)
+	if err := l.city.reload(); err != nil || city() != "Paris" {
+		t.Fatalf("reload() of an unchanged file = %v, located in %s, want Paris", err, city())
+	}
+
+	touch(t, path, loaded.Add(time.Minute))
+	if err := l.city.reload(); err != nil || city() != "Lyon" {
+		t.Fatalf("reload() of a changed file = %v, located in %s, want Lyon", err, city())
+	}
+
+	// a corrupt download keeps the previous database in use
+	if err := os.WriteFile(path, []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, path, loaded.Add(2*time.Minute))
+	if err := l.city.reload(); err == nil {
+		t.Fatal("reload() of a corrupt file error = nil")
+	}
+	if got := city(); got != "Lyon" {
+		t.Fatalf("located in %s after a corrupt reload, want Lyon", got)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.city.reload(); err == nil || city() != "Lyon" {
+		t.Fatalf("reload() of a deleted file = %v, want an error and the database kept", err)
+	}
+}
+
+func TestMMDBLocatorWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeMMDB(t, path, "GeoLite2-City", cityMMDB("Paris"))
+	touch(t, path, time.Now().Add(-time.Hour))
+	l, err := NewMMDBLocator(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Watch(ctx, time.Millisecond)
+		close(done)
+	}()
+	writeMMDB(t, path, "GeoLite2-City", cityMMDB("Lyon"))
+	touch(t, path, time.Now())
+	deadline := time.Now().Add(time.Second)
+	for {
+		out, err := l.Locate(context.Background(), "203.0.113.7")
+		if err == nil && out != nil && *out.City == "Lyon" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Watch() didn't reload the changed file")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,37 @@
+package notifier
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+
+	"go.uber.org/zap"
+)
+
+// LogNotifier writes notifications to the log instead of delivering them,
+// for development and deployments without a mail server.
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) RiskDetected(ctx context.Context, user *entities.User, session *entities.Session, risk *dtos.RiskAssessmentDTO) error {
+	zap.L().Warn("risky session notification", zap.String("user_id", user.ID), zap.String("session_id", session.Id), zap.Int("score", risk.Score), zap.Strings("signals", risk.Signals))
+	return nil
+}
+
+func (n *LogNotifier) StepUpRequired(ctx context.Context, user *entities.User, link *dtos.LoginOutputDTO) error {
+	zap.L().Warn("step-up verification notification", zap.String("user_id", user.ID), zap.String("link", link.Link))
+	return nil
+}
+
+func (n *LogNotifier) NewDevice(ctx context.Context, user *entities.User, session *entities.Session, notMeLink string) error {
+	zap.L().Info("new device notification", zap.String("user_id", user.ID), zap.String("session_id", session.Id), zap.String("not_me_link", notMeLink))
+	return nil
+}
+
+func (n *LogNotifier) SessionsRevoked(ctx context.Context, user *entities.User, revoked int64, everywhere bool) error {
+	zap.L().Info("sessions revoked notification", zap.String("user_id", user.ID), zap.Int64("revoked", revoked), zap.Bool("everywhere", everywhere))
+	return nil
+}
@@ -0,0 +1,94 @@
+package notifier
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveSMTP accepts one connection on a local listener, speaking just enough
+// SMTP to receive a message, and sends what it received on the returned channel.
+func serveSMTP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ready")
+		var transcript strings.Builder
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line + "\n")
+			switch cmd := strings.ToUpper(strings.Fields(line + " x")[0]); cmd {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, _ := tp.ReadDotLines()
+				transcript.WriteString(strings.Join(data, "\n"))
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				received <- transcript.String()
+				return
+			default:
+				tp.PrintfLine("502 unknown")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTPNotifierNewDevice(t *testing.T) {
+	addr, received := serveSMTP(t)
+	n, err := NewSMTPNotifier("smtp://"+addr, "HyperZoop <no-reply@hyperzoop.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ua, city, country := "Firefox on Linux", "Paris", "FR"
+	session := &entities.Session{Id: "session", UserAgent: &ua, City: &city, Country: &country, CreatedAt: time.Now()}
+	user := &entities.User{ID: "user", Email: "user@hyperzoop.com"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := n.NewDevice(ctx, user, session, "http://localhost:3000/auth/not-me?code=abc"); err != nil {
+		t.Fatalf("NewDevice() error = %v", err)
+	}
+	transcript := <-received
+	for _, want := range []string{
+		"MAIL FROM:<no-reply@hyperzoop.com>",
+		"RCPT TO:<user@hyperzoop.com>",
+		"Subject: New sign-in to your account",
+		"Device: Firefox on Linux",
+		"Location: Paris, FR",
+		"http://localhost:3000/auth/not-me?code=abc",
+	} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("message is missing %q:\n%s", want, transcript)
+		}
+	}
+}
+
+func TestNewSMTPNotifierRejectsInvalidURLs(t *testing.T) {
+	for _, raw := range []string{"mail.hyperzoop.com:587", "http://mail.hyperzoop.com", "smtp://"} {
+		if _, err := NewSMTPNotifier(raw, "no-reply@hyperzoop.com"); err == nil {
+			t.Errorf("NewSMTPNotifier(%q) accepted an invalid url", raw)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// lookups counts cache reads by cache and result, the hit ratio being
+// hits over all lookups of a cache.
+var lookups, _ = telemetry.Meter().Int64Counter("hyperzoop.cache.lookups",
+	metric.WithDescription("Repository cache lookups, by cache and result (hit or miss)"),
+)
+
+// jsonCache stores values as JSON in the cache repository. Cache failures are
+// logged and treated as misses so the decorated repository keeps answering.
+type jsonCache struct {
+	name   string
+	prefix string
+	cache  ports.RedisCacheRepository
+}
+
+func (c *jsonCache) get(ctx context.Context, id string, value any) bool {
+	raw, err := c.cache.Get(ctx, c.prefix+id)
+	if err == nil {
+		err = json.Unmarshal([]byte(raw), value)
+	} else if err != ports.ErrCacheMiss {
+		zap.L().Error("error reading cache", zap.Error(err), zap.String("cache", c.name))
+	}
+	result := "hit"
+	if err != nil {
+		result = "miss"
+	}
+	lookups.Add(ctx, 1, metric.WithAttributes(attribute.String("cache", c.name), attribute.String("result", result)))
+	return err == nil
+}
+
+func (c *jsonCache) set(ctx context.Context, id string, value any, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	raw, err := json.Marshal(value)
+	if err == nil {
+		err = c.cache.Set(ctx, c.prefix+id, string(raw), ttl)
+	}
+	if err != nil {
+		zap.L().Error("error writing cache", zap.Error(err), zap.String("cache", c.name))
+	}
+}
+
+// invalidate drops a cached value. A failure could leave stale data behind,
+// so it is returned to the caller.
+func (c *jsonCache) invalidate(ctx context.Context, id string) error {
+	if err := c.cache.Invalidate(ctx, c.prefix+id); err != nil {
+		zap.L().Error("error invalidating cache", zap.Error(err), zap.String("cache", c.name))
+		return err
+	}
+	return nil
+}
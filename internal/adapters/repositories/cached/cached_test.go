@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/adapters/repositories/conformance"
+	memoryRepositories "github.com/jmjp/gopasswordless/internal/adapters/repositories/memory"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"testing"
+	"time"
+)
+
+func TestSessionCachedRepository(t *testing.T) {
+	conformance.SessionRepository(t, func(t *testing.T) (ports.SessionRepository, ports.UserRepository) {
+		next := memoryRepositories.NewSessionMemoryRepository(clock.System)
+		cache := memoryRepositories.NewRedisCacheMemoryRepository(clock.System)
+		return NewSessionCachedRepository(next, cache), memoryRepositories.NewUserMemoryRepository(clock.System)
+	})
+}
+
+func TestUserCachedRepository(t *testing.T) {
+	conformance.UserRepository(t, func(t *testing.T) ports.UserRepository {
+		next := memoryRepositories.NewUserMemoryRepository(clock.System)
+		cache := memoryRepositories.NewRedisCacheMemoryRepository(clock.System)
+		return NewUserCachedRepository(next, cache, time.Minute)
+	})
+}
+
+func TestUserCachedRepositoryInvalidatesOnBlock(t *testing.T) {
+	ctx := context.Background()
+	next := memoryRepositories.NewUserMemoryRepository(clock.System)
+	repo := NewUserCachedRepository(next, memoryRepositories.NewRedisCacheMemoryRepository(clock.System), time.Minute)
+	user, _ := entities.NewUser("user@hyperzoop.com", nil, nil)
+	user, _ = repo.Create(ctx, user)
+	if _, err := repo.FindById(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	user.Block()
+	if err := repo.Update(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	found, err := repo.FindById(ctx, user.ID)
+	if err != nil || !found.Blocked {
+		t.Fatalf("FindById() = %+v, %v, want the blocked user", found, err)
+	}
+}
+
+func TestTokenDenylistCachedRepository(t *testing.T) {
+	conformance.TokenDenylist(t, func(t *testing.T) ports.TokenDenylist {
+		return NewTokenDenylistCachedRepository(memoryRepositories.NewTokenDenylistMemoryRepository(clock.System, time.Hour), 100, time.Minute)
+	})
+}
+
+func TestTokenDenylistCachedRepositoryServesFromCache(t *testing.T) {
+	ctx := context.Background()
+	next := memoryRepositories.NewTokenDenylistMemoryRepository(clock.System, time.Hour)
+	repo := NewTokenDenylistCachedRepository(next, 100, time.Minute)
+	issuedAt := time.Now()
+	if revoked, err := repo.IsRevoked(ctx, "token", "session", "user", issuedAt); err != nil || revoked {
+		t.Fatalf("IsRevoked() = %v, %v, want false", revoked, err)
+	}
+	// Another replica revoking the session goes unnoticed until the entry expires
+	next.RevokeSessions(ctx, "session")
+	if revoked, _ := repo.IsRevoked(ctx, "token", "session", "user", issuedAt); revoked {
+		t.Fatal("IsRevoked() = true, want the cached answer")
+	}
+	// Revoking through this replica applies at once
+	repo.RevokeToken(ctx, "other")
+	if revoked, _ := repo.IsRevoked(ctx, "token", "session", "user", issuedAt); !revoked {
+		t.Fatal("IsRevoked() = false after a local revocation")
+	}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	now := time.Now()
+	cache := newLRU[int](2)
+	cache.set("a", 1, time.Time{})
+	cache.set("b", 2, time.Time{})
+	cache.get("a", now)
+	cache.set("c", 3, time.Time{})
+	if _, ok := cache.get("b", now); ok {
+		t.Error("b was kept, want it evicted")
+	}
+	if value, ok := cache.get("a", now); !ok || value != 1 {
+		t.Errorf("get(a) = %d, %v, want 1", value, ok)
+	}
+	cache.set("d", 4, now.Add(time.Second))
+	if _, ok := cache.get("d", now.Add(time.Second)); ok {
+		t.Error("d was returned after it expired")
+	}
+}
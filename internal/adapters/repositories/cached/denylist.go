@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// TokenDenylistCachedRepository answers IsRevoked from a local LRU so most
+// requests don't reach Redis. Revoked tokens stay revoked until they expire,
+// so they are cached until evicted; tokens found valid are only cached for
+// ttl, which bounds how long a revocation made by another replica goes
+// unnoticed here.
+type TokenDenylistCachedRepository struct {
+	ports.TokenDenylist
+	ttl   time.Duration
+	local *lru[bool]
+}
+
+func NewTokenDenylistCachedRepository(next ports.TokenDenylist, size int, ttl time.Duration) *TokenDenylistCachedRepository {
+	return &TokenDenylistCachedRepository{TokenDenylist: next, ttl: ttl, local: newLRU[bool](size)}
+}
+
+// The Revoke methods purge the local cache, so revocations made by this
+// replica apply at once.
+
+func (r *TokenDenylistCachedRepository) RevokeToken(ctx context.Context, tokenId string) error {
+	defer r.local.purge()
+	return r.TokenDenylist.RevokeToken(ctx, tokenId)
+}
+
+func (r *TokenDenylistCachedRepository) RevokeSessions(ctx context.Context, sessionIds ...string) error {
+	defer r.local.purge()
+	return r.TokenDenylist.RevokeSessions(ctx, sessionIds...)
+}
+
+func (r *TokenDenylistCachedRepository) RevokeUser(ctx context.Context, userId string, at time.Time) error {
+	defer r.local.purge()
+	return r.TokenDenylist.RevokeUser(ctx, userId, at)
+}
+
+func (r *TokenDenylistCachedRepository) IsRevoked(ctx context.Context, tokenId, sessionId, userId string, issuedAt time.Time) (bool, error) {
+	key := strings.Join([]string{tokenId, sessionId, userId, strconv.FormatInt(issuedAt.Unix(), 10)}, "|")
+	now := time.Now()
+	if revoked, ok := r.local.get(key, now); ok {
+		lookups.Add(ctx, 1, metric.WithAttributes(attribute.String("cache", "denylist"), attribute.String("result", "hit")))
+		return revoked, nil
+	}
+	lookups.Add(ctx, 1, metric.WithAttributes(attribute.String("cache", "denylist"), attribute.String("result", "miss")))
+	revoked, err := r.TokenDenylist.IsRevoked(ctx, tokenId, sessionId, userId, issuedAt)
+	if err != nil {
+		return false, err
+	}
+	if revoked {
+		r.local.set(key, true, time.Time{})
+	} else if r.ttl > 0 {
+		r.local.set(key, false, now.Add(r.ttl))
+	}
+	return revoked, nil
+}
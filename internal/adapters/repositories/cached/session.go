@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"time"
+)
+
+// SessionCachedRepository caches sessions by id until they expire, writing
+// through on Create and invalidating on every change.
+type SessionCachedRepository struct {
+	ports.SessionRepository
+	cache *jsonCache
+}
+
+func NewSessionCachedRepository(next ports.SessionRepository, cache ports.RedisCacheRepository) *SessionCachedRepository {
+	return &SessionCachedRepository{
+		SessionRepository: next,
+		cache:             &jsonCache{name: "session", prefix: "hyperzoop:cache:session:", cache: cache},
+	}
+}
+
+func (r *SessionCachedRepository) Create(ctx context.Context, session *entities.Session) (*entities.Session, error) {
+	created, err := r.SessionRepository.Create(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.set(ctx, created.Id, created, time.Until(created.ValidUntil))
+	return created, nil
+}
+
+func (r *SessionCachedRepository) One(ctx context.Context, id string) (*entities.Session, error) {
+	var session entities.Session
+	if r.cache.get(ctx, id, &session) {
+		return &session, nil
+	}
+	found, err := r.SessionRepository.One(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.set(ctx, id, found, time.Until(found.ValidUntil))
+	return found, nil
+}
+
+func (r *SessionCachedRepository) UpdateGeoLocation(ctx context.Context, session *entities.Session) error {
+	if err := r.SessionRepository.UpdateGeoLocation(ctx, session); err != nil {
+		return err
+	}
+	return r.cache.invalidate(ctx, session.Id)
+}
+
+func (r *SessionCachedRepository) Update(ctx context.Context, session *entities.Session) error {
+	if err := r.SessionRepository.Update(ctx, session); err != nil {
+		return err
+	}
+	return r.cache.invalidate(ctx, session.Id)
+}
+
+func (r *SessionCachedRepository) Touch(ctx context.Context, sessionId string, usedAt time.Time, ip string, refreshes int64) error {
+	if err := r.SessionRepository.Touch(ctx, sessionId, usedAt, ip, refreshes); err != nil {
+		return err
+	}
+	return r.cache.invalidate(ctx, sessionId)
+}
+
+func (r *SessionCachedRepository) Disconnect(ctx context.Context, sessionId string) error {
+	if err := r.SessionRepository.Disconnect(ctx, sessionId); err != nil {
+		return err
+	}
+	return r.cache.invalidate(ctx, sessionId)
+}
+
+func (r *SessionCachedRepository) DisconnectAll(ctx context.Context, userId string) (int64, error) {
+	return r.disconnectAllExcept(ctx, userId, "", r.SessionRepository.DisconnectAll)
+}
+
+func (r *SessionCachedRepository) DisconnectAllExcept(ctx context.Context, userId, sessionId string) (int64, error) {
+	return r.disconnectAllExcept(ctx, userId, sessionId, func(ctx context.Context, userId string) (int64, error) {
+		return r.SessionRepository.DisconnectAllExcept(ctx, userId, sessionId)
+	})
+}
+
+// disconnectAllExcept lists the sessions first to know which cache entries
+// to invalidate once they are removed.
+func (r *SessionCachedRepository) disconnectAllExcept(ctx context.Context, userId, keep string, disconnect func(ctx context.Context, userId string) (int64, error)) (int64, error) {
+	sessions, err := r.SessionRepository.All(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := disconnect(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	for _, session := range sessions {
+		if session.Id != keep {
+			errs = append(errs, r.cache.invalidate(ctx, session.Id))
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"time"
+)
+
+// UserCachedRepository caches users by id for ttl, invalidating on Update so
+// blocking or unblocking a user takes effect right away.
+type UserCachedRepository struct {
+	ports.UserRepository
+	cache *jsonCache
+	ttl   time.Duration
+}
+
+func NewUserCachedRepository(next ports.UserRepository, cache ports.RedisCacheRepository, ttl time.Duration) *UserCachedRepository {
+	return &UserCachedRepository{
+		UserRepository: next,
+		cache:          &jsonCache{name: "user", prefix: "hyperzoop:cache:user:", cache: cache},
+		ttl:            ttl,
+	}
+}
+
+func (r *UserCachedRepository) FindById(ctx context.Context, id string) (*entities.User, error) {
+	var user entities.User
+	if r.cache.get(ctx, id, &user) {
+		return &user, nil
+	}
+	found, err := r.UserRepository.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.set(ctx, id, found, r.ttl)
+	return found, nil
+}
+
+func (r *UserCachedRepository) Update(ctx context.Context, user *entities.User) error {
+	if err := r.UserRepository.Update(ctx, user); err != nil {
+		return err
+	}
+	return r.cache.invalidate(ctx, user.ID)
+}
@@ -0,0 +1,95 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// CacheRepository checks an implementation of ports.RedisCacheRepository.
+func CacheRepository(t *testing.T, newRepo func(t *testing.T) ports.RedisCacheRepository) {
+	ctx := context.Background()
+
+	t.Run("Set and Get", func(t *testing.T) {
+		repo := newRepo(t)
+		key := randomString(t)
+		if err := repo.Set(ctx, key, "value", time.Minute); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+		if value, err := repo.Get(ctx, key); err != nil || value != "value" {
+			t.Fatalf("Get() = %q, %v", value, err)
+		}
+	})
+
+	t.Run("Get of a missing key", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.Get(ctx, randomString(t)); !errors.Is(err, ports.ErrCacheMiss) {
+			t.Fatalf("Get() error = %v, want ports.ErrCacheMiss", err)
+		}
+	})
+
+	t.Run("Take", func(t *testing.T) {
+		repo := newRepo(t)
+		key := randomString(t)
+		repo.Set(ctx, key, "value", time.Minute)
+		if value, err := repo.Take(ctx, key); err != nil || value != "value" {
+			t.Fatalf("Take() = %q, %v", value, err)
+		}
+		if _, err := repo.Take(ctx, key); !errors.Is(err, ports.ErrCacheMiss) {
+			t.Fatalf("Take() again error = %v, want ports.ErrCacheMiss", err)
+		}
+		if _, err := repo.Get(ctx, key); !errors.Is(err, ports.ErrCacheMiss) {
+			t.Fatalf("Get() after Take() error = %v, want ports.ErrCacheMiss", err)
+		}
+	})
+
+	t.Run("Take succeeds once under concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		key := randomString(t)
+		repo.Set(ctx, key, "value", time.Minute)
+		const attempts = 20
+		var wg sync.WaitGroup
+		var taken atomic.Int32
+		errs := make(chan error, attempts)
+		start := make(chan struct{})
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				_, err := repo.Take(ctx, key)
+				switch {
+				case err == nil:
+					taken.Add(1)
+				case !errors.Is(err, ports.ErrCacheMiss):
+					errs <- err
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("Take() error = %v", err)
+		}
+		if n := taken.Load(); n != 1 {
+			t.Fatalf("%d of %d concurrent Take() succeeded, want 1", n, attempts)
+		}
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		repo := newRepo(t)
+		key := randomString(t)
+		repo.Set(ctx, key, "value", 0)
+		if err := repo.Invalidate(ctx, key); err != nil {
+			t.Fatalf("Invalidate() error = %v", err)
+		}
+		if _, err := repo.Get(ctx, key); !errors.Is(err, ports.ErrCacheMiss) {
+			t.Fatalf("Get() after Invalidate() error = %v, want ports.ErrCacheMiss", err)
+		}
+	})
+}
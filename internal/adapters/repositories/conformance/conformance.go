@@ -0,0 +1,56 @@
+// Package conformance holds the behaviour every implementation of the
+// repository ports must share, so the Postgres, Redis and in-memory adapters
+// can be swapped without the services noticing.
+//
+// Lookups that find nothing must fail with sql.ErrNoRows, which is what the
+// services check for; cache misses fail with
+// ports.ErrCacheMiss.
+package conformance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"testing"
+	"time"
+)
+
+// missingId is a well-formed id that no repository ever hands out.
+const missingId = "00000000-0000-0000-0000-000000000000"
+
+// precision is the finest resolution the backends keep timestamps with.
+const precision = time.Millisecond
+
+func randomString(t *testing.T) string {
+	t.Helper()
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func createUser(t *testing.T, users ports.UserRepository) *entities.User {
+	t.Helper()
+	name := randomString(t)
+	user, err := entities.NewUser(name+"@hyperzoop.com", nil, &name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err = users.Create(context.Background(), user)
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return user
+}
+
+func sameTime(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d < precision && d > -precision
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
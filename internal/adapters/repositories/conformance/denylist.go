@@ -0,0 +1,83 @@
+package conformance
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"testing"
+	"time"
+)
+
+// TokenDenylist checks an implementation of ports.TokenDenylist.
+func TokenDenylist(t *testing.T, newRepo func(t *testing.T) ports.TokenDenylist) {
+	ctx := context.Background()
+	issuedAt := time.Now().Add(-time.Minute)
+
+	isRevoked := func(t *testing.T, repo ports.TokenDenylist, tokenId, sessionId, userId string, issuedAt time.Time) bool {
+		t.Helper()
+		revoked, err := repo.IsRevoked(ctx, tokenId, sessionId, userId, issuedAt)
+		if err != nil {
+			t.Fatalf("IsRevoked() error = %v", err)
+		}
+		return revoked
+	}
+
+	t.Run("Nothing revoked", func(t *testing.T) {
+		repo := newRepo(t)
+		if isRevoked(t, repo, randomString(t), randomString(t), randomString(t), issuedAt) {
+			t.Fatal("IsRevoked() = true for a token never revoked")
+		}
+	})
+
+	t.Run("RevokeToken", func(t *testing.T) {
+		repo := newRepo(t)
+		tokenId := randomString(t)
+		if err := repo.RevokeToken(ctx, tokenId); err != nil {
+			t.Fatalf("RevokeToken() error = %v", err)
+		}
+		if !isRevoked(t, repo, tokenId, randomString(t), randomString(t), issuedAt) {
+			t.Fatal("IsRevoked() = false for a revoked token")
+		}
+		if isRevoked(t, repo, randomString(t), randomString(t), randomString(t), issuedAt) {
+			t.Fatal("IsRevoked() = true for another token")
+		}
+	})
+
+	t.Run("RevokeSessions", func(t *testing.T) {
+		repo := newRepo(t)
+		first, second := randomString(t), randomString(t)
+		if err := repo.RevokeSessions(ctx, first, second); err != nil {
+			t.Fatalf("RevokeSessions() error = %v", err)
+		}
+		for _, sessionId := range []string{first, second} {
+			if !isRevoked(t, repo, randomString(t), sessionId, randomString(t), issuedAt) {
+				t.Fatalf("IsRevoked() = false for a token of revoked session %s", sessionId)
+			}
+		}
+		if err := repo.RevokeSessions(ctx); err != nil {
+			t.Fatalf("RevokeSessions() without sessions error = %v", err)
+		}
+	})
+
+	t.Run("RevokeUser denies tokens issued until then", func(t *testing.T) {
+		repo := newRepo(t)
+		userId := randomString(t)
+		at := time.Now()
+		if err := repo.RevokeUser(ctx, userId, at); err != nil {
+			t.Fatalf("RevokeUser() error = %v", err)
+		}
+		if !isRevoked(t, repo, randomString(t), randomString(t), userId, at.Add(-time.Minute)) {
+			t.Fatal("IsRevoked() = false for a token issued before RevokeUser()")
+		}
+		if isRevoked(t, repo, randomString(t), randomString(t), userId, at.Add(time.Minute)) {
+			t.Fatal("IsRevoked() = true for a token issued after RevokeUser()")
+		}
+	})
+
+	t.Run("Empty ids are not checked", func(t *testing.T) {
+		repo := newRepo(t)
+		repo.RevokeSessions(ctx, "")
+		if isRevoked(t, repo, "", "", "", issuedAt) {
+			t.Fatal("IsRevoked() = true without ids")
+		}
+	})
+}
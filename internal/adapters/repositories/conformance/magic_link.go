@@ -0,0 +1,167 @@
+package conformance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// MagicLinkRepository checks an implementation of ports.MagicLinkRepository.
+// newRepos returns the repository under test and one able to create the users
+// the links belong to.
+func MagicLinkRepository(t *testing.T, newRepos func(t *testing.T) (ports.MagicLinkRepository, ports.UserRepository)) {
+	ctx := context.Background()
+	create := func(t *testing.T, repo ports.MagicLinkRepository, userId string, validUntil time.Time) *entities.MagicLink {
+		t.Helper()
+		link := entities.NewMagicLink(userId, randomString(t)+randomString(t), randomString(t)+randomString(t), validUntil)
+		if err := repo.Create(ctx, link); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		return link
+	}
+	notFound := func(t *testing.T, repo ports.MagicLinkRepository, code, cookie string) {
+		t.Helper()
+		if link, err := repo.FindValidByCode(ctx, code, cookie); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("FindValidByCode() = %+v, %v, want sql.ErrNoRows", link, err)
+		}
+	}
+
+	t.Run("Create and FindValidByCode", func(t *testing.T) {
+		repo, users := newRepos(t)
+		user := createUser(t, users)
+		link := create(t, repo, user.ID, time.Now().Add(5*time.Minute))
+		found, err := repo.FindValidByCode(ctx, link.Code, link.Cookie)
+		if err != nil {
+			t.Fatalf("FindValidByCode() error = %v", err)
+		}
+		if found.Code != link.Code || found.UserId != user.ID || found.Cookie != link.Cookie || found.Used || !sameTime(found.ValidUntil, link.ValidUntil) {
+			t.Fatalf("FindValidByCode() = %+v, want %+v", found, link)
+		}
+	})
+
+	t.Run("FindValidByCode of a missing code", func(t *testing.T) {
+		repo, _ := newRepos(t)
+		notFound(t, repo, randomString(t), randomString(t))
+	})
+
+	t.Run("FindValidByCode requires the fingerprint", func(t *testing.T) {
+		repo, users := newRepos(t)
+		link := create(t, repo, createUser(t, users).ID, time.Now().Add(5*time.Minute))
+		notFound(t, repo, link.Code, randomString(t))
+	})
+
+	t.Run("FindValidByCode skips expired links", func(t *testing.T) {
+		repo, users := newRepos(t)
+		link := create(t, repo, createUser(t, users).ID, time.Now().Add(-time.Minute))
+		notFound(t, repo, link.Code, link.Cookie)
+	})
+
+	t.Run("Update marks the link used", func(t *testing.T) {
+		repo, users := newRepos(t)
+		link := create(t, repo, createUser(t, users).ID, time.Now().Add(5*time.Minute))
+		if err := repo.Update(ctx, link.MarkAsUsed()); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		notFound(t, repo, link.Code, link.Cookie)
+	})
+
+	t.Run("Consume marks the link used", func(t *testing.T) {
+		repo, users := newRepos(t)
+		user := createUser(t, users)
+		link := create(t, repo, user.ID, time.Now().Add(5*time.Minute))
+		consumed, err := repo.Consume(ctx, link.Code, link.Cookie)
+		if err != nil {
+			t.Fatalf("Consume() error = %v", err)
+		}
+		if consumed.Code != link.Code || consumed.UserId != user.ID || !consumed.Used {
+			t.Fatalf("Consume() = %+v, want the used link", consumed)
+		}
+		notFound(t, repo, link.Code, link.Cookie)
+		if _, err := repo.Consume(ctx, link.Code, link.Cookie); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("second Consume() error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("Consume requires the fingerprint", func(t *testing.T) {
+		repo, users := newRepos(t)
+		link := create(t, repo, createUser(t, users).ID, time.Now().Add(5*time.Minute))
+		if _, err := repo.Consume(ctx, link.Code, randomString(t)); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("Consume() error = %v, want sql.ErrNoRows", err)
+		}
+		// a wrong fingerprint doesn't use the link up
+		if _, err := repo.Consume(ctx, link.Code, link.Cookie); err != nil {
+			t.Fatalf("Consume() error = %v", err)
+		}
+	})
+
+	t.Run("Consume skips expired links", func(t *testing.T) {
+		repo, users := newRepos(t)
+		link := create(t, repo, createUser(t, users).ID, time.Now().Add(-time.Minute))
+		if _, err := repo.Consume(ctx, link.Code, link.Cookie); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("Consume() error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("Consume succeeds once under concurrency", func(t *testing.T) {
+		repo, users := newRepos(t)
+		link := create(t, repo, createUser(t, users).ID, time.Now().Add(5*time.Minute))
+		const attempts = 20
+		var wg sync.WaitGroup
+		var consumed atomic.Int32
+		errs := make(chan error, attempts)
+		start := make(chan struct{})
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				_, err := repo.Consume(ctx, link.Code, link.Cookie)
+				switch {
+				case err == nil:
+					consumed.Add(1)
+				case !errors.Is(err, sql.ErrNoRows):
+					errs <- err
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("Consume() error = %v", err)
+		}
+		if n := consumed.Load(); n != 1 {
+			t.Fatalf("%d of %d concurrent Consume() succeeded, want 1", n, attempts)
+		}
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		repo, users := newRepos(t)
+		link := create(t, repo, createUser(t, users).ID, time.Now().Add(5*time.Minute))
+		if err := repo.Invalidate(ctx, link.Code); err != nil {
+			t.Fatalf("Invalidate() error = %v", err)
+		}
+		notFound(t, repo, link.Code, link.Cookie)
+	})
+
+	t.Run("DeleteExpired keeps valid links", func(t *testing.T) {
+		repo, users := newRepos(t)
+		user := createUser(t, users)
+		valid := create(t, repo, user.ID, time.Now().Add(5*time.Minute))
+		used := create(t, repo, user.ID, time.Now().Add(5*time.Minute))
+		repo.Update(ctx, used.MarkAsUsed())
+		create(t, repo, user.ID, time.Now().Add(-time.Minute))
+		if _, err := repo.DeleteExpired(ctx, time.Now(), 100); err != nil {
+			t.Fatalf("DeleteExpired() error = %v", err)
+		}
+		if _, err := repo.FindValidByCode(ctx, valid.Code, valid.Cookie); err != nil {
+			t.Fatalf("valid link deleted: %v", err)
+		}
+	})
+}
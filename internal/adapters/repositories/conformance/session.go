@@ -0,0 +1,279 @@
+package conformance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"testing"
+	"time"
+)
+
+// SessionRepository checks an implementation of ports.SessionRepository.
+// newRepos returns the repository under test and one able to create the users
+// the sessions belong to.
+func SessionRepository(t *testing.T, newRepos func(t *testing.T) (ports.SessionRepository, ports.UserRepository)) {
+	ctx := context.Background()
+	create := func(t *testing.T, repo ports.SessionRepository, userId string, validUntil time.Time) *entities.Session {
+		t.Helper()
+		session, err := repo.Create(ctx, entities.NewSession(userId, validUntil, nil))
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		return session
+	}
+
+	t.Run("Create and One", func(t *testing.T) {
+		repo, users := newRepos(t)
+		user := createUser(t, users)
+		validUntil := time.Now().Add(time.Hour)
+		created := create(t, repo, user.ID, validUntil)
+		if created.Id == "" || created.UserId != user.ID || !sameTime(created.ValidUntil, validUntil) || created.CreatedAt.IsZero() {
+			t.Fatalf("Create() = %+v", created)
+		}
+		found, err := repo.One(ctx, created.Id)
+		if err != nil || found.UserId != user.ID || !sameTime(found.ValidUntil, validUntil) {
+			t.Fatalf("One() = %+v, %v", found, err)
+		}
+	})
+
+	t.Run("Create keeps the device", func(t *testing.T) {
+		repo, users := newRepos(t)
+		session := entities.NewSession(createUser(t, users).ID, time.Now().Add(time.Hour), nil)
+		session.UpdateDevice("Firefox", "122", "Linux", "desktop", "Firefox on Linux")
+		created, err := repo.Create(ctx, session)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		found, err := repo.One(ctx, created.Id)
+		if err != nil || found.Browser != "Firefox" || found.BrowserVersion != "122" || found.OS != "Linux" || found.DeviceType != "desktop" || found.DeviceLabel != "Firefox on Linux" {
+			t.Fatalf("One() = %+v, %v, want the device given to Create", found, err)
+		}
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		repo, users := newRepos(t)
+		session := entities.NewSession(createUser(t, users).ID, time.Now().Add(time.Hour), ptr("test-agent"))
+		session.LastUsedAt = time.Now().Add(-time.Minute)
+		session.LastIp = ptr("203.0.113.7")
+		created, err := repo.Create(ctx, session)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		if created.UserAgent == nil || *created.UserAgent != "test-agent" || !sameTime(created.LastUsedAt, session.LastUsedAt) {
+			t.Fatalf("Create() = %+v, want the user agent and last use given", created)
+		}
+		usedAt := time.Now()
+		if err := repo.Touch(ctx, created.Id, usedAt, "198.51.100.9", 3); err != nil {
+			t.Fatalf("Touch() error = %v", err)
+		}
+		// an older use and an unknown address change nothing but the count
+		if err := repo.Touch(ctx, created.Id, usedAt.Add(-time.Hour), "", 2); err != nil {
+			t.Fatalf("Touch() error = %v", err)
+		}
+		found, err := repo.One(ctx, created.Id)
+		if err != nil || found.RefreshCount != 5 || !sameTime(found.LastUsedAt, usedAt) || found.LastIp == nil || *found.LastIp != "198.51.100.9" {
+			t.Fatalf("One() after Touch = %+v, %v", found, err)
+		}
+		if err := repo.Touch(ctx, missingId, usedAt, "", 1); err != nil {
+			t.Fatalf("Touch() of a missing session error = %v", err)
+		}
+	})
+
+	t.Run("One of a missing session", func(t *testing.T) {
+		repo, _ := newRepos(t)
+		if _, err := repo.One(ctx, missingId); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("One() error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("All only lists the user's sessions", func(t *testing.T) {
+		repo, users := newRepos(t)
+		user, other := createUser(t, users), createUser(t, users)
+		first := create(t, repo, user.ID, time.Now().Add(time.Hour))
+		second := create(t, repo, user.ID, time.Now().Add(time.Hour))
+		create(t, repo, other.ID, time.Now().Add(time.Hour))
+		sessions, err := repo.All(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("All() error = %v", err)
+		}
+		found := map[string]bool{}
+		for _, s := range sessions {
+			found[s.Id] = true
+		}
+		if len(sessions) != 2 || !found[first.Id] || !found[second.Id] {
+			t.Fatalf("All() = %d sessions %v", len(sessions), found)
+		}
+		none, err := repo.All(ctx, missingId)
+		if err != nil || len(none) != 0 {
+			t.Fatalf("All() of a user without sessions = %v, %v", none, err)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo, users := newRepos(t)
+		session := create(t, repo, createUser(t, users).ID, time.Now().Add(time.Hour))
+		session.ValidUntil = time.Now().Add(48 * time.Hour)
+		if err := repo.Update(ctx, session); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		found, _ := repo.One(ctx, session.Id)
+		if !sameTime(found.ValidUntil, session.ValidUntil) {
+			t.Fatalf("Update() stored valid_until %v, want %v", found.ValidUntil, session.ValidUntil)
+		}
+	})
+
+	t.Run("UpdateGeoLocation", func(t *testing.T) {
+		repo, users := newRepos(t)
+		session := create(t, repo, createUser(t, users).ID, time.Now().Add(time.Hour))
+		lat, long := 48.85, 2.35
+		ip, city, region, country, org := "203.0.113.7", "Paris", "Ile-de-France", "FR", "Example ISP"
+		session.UpdateLocation(&lat, &long, &ip, &city, &region, &country, &org)
+		if err := repo.UpdateGeoLocation(ctx, session); err != nil {
+			t.Fatalf("UpdateGeoLocation() error = %v", err)
+		}
+		found, _ := repo.One(ctx, session.Id)
+		if found.Ip == nil || *found.Ip != ip || found.City == nil || *found.City != city || found.Latitude == nil || *found.Latitude != lat {
+			t.Fatalf("UpdateGeoLocation() stored %+v", found)
+		}
+	})
+
+	t.Run("Disconnect", func(t *testing.T) {
+		repo, users := newRepos(t)
+		session := create(t, repo, createUser(t, users).ID, time.Now().Add(time.Hour))
+		if err := repo.Disconnect(ctx, session.Id); err != nil {
+			t.Fatalf("Disconnect() error = %v", err)
+		}
+		if _, err := repo.One(ctx, session.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("One() after Disconnect() error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	gone := func(t *testing.T, repo ports.SessionRepository, session *entities.Session) {
+		t.Helper()
+		if found, err := repo.One(ctx, session.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("One() of a disconnected session = %+v, %v, want sql.ErrNoRows", found, err)
+		}
+		if sessions, err := repo.All(ctx, session.UserId); err != nil || len(sessions) != 0 {
+			t.Fatalf("All() after Disconnect() = %d sessions, %v, want none", len(sessions), err)
+		}
+	}
+
+	t.Run("Writes after Disconnect leave the session gone", func(t *testing.T) {
+		repo, users := newRepos(t)
+		session := create(t, repo, createUser(t, users).ID, time.Now().Add(time.Hour))
+		if err := repo.Disconnect(ctx, session.Id); err != nil {
+			t.Fatalf("Disconnect() error = %v", err)
+		}
+		if err := repo.Touch(ctx, session.Id, time.Now(), "203.0.113.7", 1); err != nil {
+			t.Fatalf("Touch() error = %v", err)
+		}
+		session.ValidUntil = time.Now().Add(48 * time.Hour)
+		if err := repo.Update(ctx, session); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		if err := repo.UpdateGeoLocation(ctx, session); err != nil {
+			t.Fatalf("UpdateGeoLocation() error = %v", err)
+		}
+		gone(t, repo, session)
+	})
+
+	t.Run("Disconnect racing Touch leaves the session gone", func(t *testing.T) {
+		repo, users := newRepos(t)
+		user := createUser(t, users)
+		for i := 0; i < 20; i++ {
+			session := create(t, repo, user.ID, time.Now().Add(time.Hour))
+			stop, touching := make(chan struct{}), make(chan struct{})
+			done := make(chan error)
+			go func() {
+				for n := 0; ; n++ {
+					select {
+					case <-stop:
+						close(done)
+						return
+					default:
+					}
+					if err := repo.Touch(ctx, session.Id, time.Now(), "203.0.113.7", 1); err != nil {
+						done <- err
+						return
+					}
+					if n == 0 {
+						close(touching)
+					}
+				}
+			}()
+			<-touching
+			if err := repo.Disconnect(ctx, session.Id); err != nil {
+				t.Fatalf("Disconnect() error = %v", err)
+			}
+			close(stop)
+			if err := <-done; err != nil {
+				t.Fatalf("Touch() error = %v", err)
+			}
+			gone(t, repo, session)
+		}
+	})
+
+	t.Run("DisconnectAllExcept and DisconnectAll", func(t *testing.T) {
+		repo, users := newRepos(t)
+		user, other := createUser(t, users), createUser(t, users)
+		kept := create(t, repo, user.ID, time.Now().Add(time.Hour))
+		for i := 0; i < 2; i++ {
+			create(t, repo, user.ID, time.Now().Add(time.Hour))
+		}
+		untouched := create(t, repo, other.ID, time.Now().Add(time.Hour))
+
+		deleted, err := repo.DisconnectAllExcept(ctx, user.ID, kept.Id)
+		if err != nil || deleted != 2 {
+			t.Fatalf("DisconnectAllExcept() = %d, %v, want 2", deleted, err)
+		}
+		if sessions, _ := repo.All(ctx, user.ID); len(sessions) != 1 || sessions[0].Id != kept.Id {
+			t.Fatalf("All() after DisconnectAllExcept() = %d sessions, want only the kept one", len(sessions))
+		}
+		deleted, err = repo.DisconnectAll(ctx, user.ID)
+		if err != nil || deleted != 1 {
+			t.Fatalf("DisconnectAll() = %d, %v, want 1", deleted, err)
+		}
+		if _, err := repo.One(ctx, kept.Id); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("One() after DisconnectAll() error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := repo.One(ctx, untouched.Id); err != nil {
+			t.Fatalf("session of another user was removed: %v", err)
+		}
+		if deleted, err := repo.DisconnectAll(ctx, user.ID); err != nil || deleted != 0 {
+			t.Fatalf("DisconnectAll() without sessions = %d, %v", deleted, err)
+		}
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		repo, users := newRepos(t)
+		user := createUser(t, users)
+		// far in the past so sessions left by other subtests don't count
+		before := time.Now().Add(-24 * time.Hour)
+		var expired []*entities.Session
+		for i := 0; i < 3; i++ {
+			expired = append(expired, create(t, repo, user.ID, before.Add(-time.Duration(i+1)*time.Hour)))
+		}
+		valid := create(t, repo, user.ID, time.Now().Add(time.Hour))
+
+		// stores that evict expired sessions by themselves may have nothing left to delete
+		for {
+			deleted, err := repo.DeleteExpired(ctx, before, 2)
+			if err != nil || deleted > 2 {
+				t.Fatalf("DeleteExpired() = %d, %v, want at most 2", deleted, err)
+			}
+			if deleted < 2 {
+				break
+			}
+		}
+		for _, s := range expired {
+			if _, err := repo.One(ctx, s.Id); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expired session %s still stored", s.Id)
+			}
+		}
+		if _, err := repo.One(ctx, valid.Id); err != nil {
+			t.Fatalf("valid session deleted: %v", err)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package conformance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"testing"
+)
+
+// UserRepository checks an implementation of ports.UserRepository. newRepo is
+// called for every subtest and may return a repository sharing state with the others.
+func UserRepository(t *testing.T, newRepo func(t *testing.T) ports.UserRepository) {
+	ctx := context.Background()
+
+	t.Run("Create", func(t *testing.T) {
+		repo := newRepo(t)
+		name := randomString(t)
+		user, _ := entities.NewUser(name+"@hyperzoop.com", nil, &name)
+		created, err := repo.Create(ctx, user)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		if created.ID == "" || created.Email != user.Email || created.Username != name || created.Blocked {
+			t.Fatalf("Create() = %+v", created)
+		}
+		if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+			t.Fatalf("Create() didn't set the timestamps: %+v", created)
+		}
+	})
+
+	t.Run("Create rejects a duplicate email", func(t *testing.T) {
+		repo := newRepo(t)
+		user := createUser(t, repo)
+		name := randomString(t)
+		duplicate, _ := entities.NewUser(user.Email, nil, &name)
+		if _, err := repo.Create(ctx, duplicate); err == nil {
+			t.Fatal("Create() accepted a duplicate email")
+		}
+	})
+
+	t.Run("FindByEmail and FindById", func(t *testing.T) {
+		repo := newRepo(t)
+		user := createUser(t, repo)
+		byEmail, err := repo.FindByEmail(ctx, user.Email)
+		if err != nil || byEmail.ID != user.ID {
+			t.Fatalf("FindByEmail() = %+v, %v", byEmail, err)
+		}
+		byId, err := repo.FindById(ctx, user.ID)
+		if err != nil || byId.Email != user.Email {
+			t.Fatalf("FindById() = %+v, %v", byId, err)
+		}
+	})
+
+	t.Run("missing users", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.FindByEmail(ctx, randomString(t)+"@hyperzoop.com"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("FindByEmail() error = %v, want sql.ErrNoRows", err)
+		}
+		if _, err := repo.FindById(ctx, missingId); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("FindById() error = %v, want sql.ErrNoRows", err)
+		}
+	})
+
+	t.Run("FindUserBySliceIds", func(t *testing.T) {
+		repo := newRepo(t)
+		first, second := createUser(t, repo), createUser(t, repo)
+		createUser(t, repo)
+		users, err := repo.FindUserBySliceIds(ctx, []string{first.ID, second.ID, missingId})
+		if err != nil {
+			t.Fatalf("FindUserBySliceIds() error = %v", err)
+		}
+		found := map[string]bool{}
+		for _, u := range users {
+			found[u.ID] = true
+		}
+		if len(users) != 2 || !found[first.ID] || !found[second.ID] {
+			t.Fatalf("FindUserBySliceIds() = %d users %v", len(users), found)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepo(t)
+		user := createUser(t, repo)
+		user.Username = randomString(t)
+		user.Block()
+		if err := repo.Update(ctx, user); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+		updated, err := repo.FindById(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Username != user.Username || !updated.Blocked || !sameTime(updated.UpdatedAt, user.UpdatedAt) {
+			t.Fatalf("Update() stored %+v, want %+v", updated, user)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// RedisCacheMemoryRepository is an in-memory cache that answers misses with
+// ports.ErrCacheMiss, like the Redis repository.
+type RedisCacheMemoryRepository struct {
+	clock   clock.Clock
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func NewRedisCacheMemoryRepository(clock clock.Clock) *RedisCacheMemoryRepository {
+	return &RedisCacheMemoryRepository{
+		clock:   clock,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// Set stores the value; a zero expiration keeps it forever.
+func (r *RedisCacheMemoryRepository) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := cacheEntry{value: value}
+	if expiration > 0 {
+		entry.expiresAt = r.clock.Now().Add(expiration)
+	}
+	r.entries[key] = entry
+	return nil
+}
+
+func (r *RedisCacheMemoryRepository) Get(ctx context.Context, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[key]
+	if !ok {
+		return "", ports.ErrCacheMiss
+	}
+	if !entry.expiresAt.IsZero() && !entry.expiresAt.After(r.clock.Now()) {
+		delete(r.entries, key)
+		return "", ports.ErrCacheMiss
+	}
+	return entry.value, nil
+}
+
+func (r *RedisCacheMemoryRepository) Take(ctx context.Context, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[key]
+	delete(r.entries, key)
+	if !ok || (!entry.expiresAt.IsZero() && !entry.expiresAt.After(r.clock.Now())) {
+		return "", ports.ErrCacheMiss
+	}
+	return entry.value, nil
+}
+
+func (r *RedisCacheMemoryRepository) Invalidate(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, key)
+	return nil
+}
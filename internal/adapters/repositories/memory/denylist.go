@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"sync"
+	"time"
+)
+
+type revocation struct {
+	at        time.Time
+	expiresAt time.Time
+}
+
+// TokenDenylistMemoryRepository forgets revocations after ttl, like the Redis repository.
+type TokenDenylistMemoryRepository struct {
+	clock    clock.Clock
+	ttl      time.Duration
+	mu       sync.Mutex
+	tokens   map[string]revocation
+	sessions map[string]revocation
+	users    map[string]revocation
+}
+
+func NewTokenDenylistMemoryRepository(clock clock.Clock, ttl time.Duration) *TokenDenylistMemoryRepository {
+	return &TokenDenylistMemoryRepository{
+		clock:    clock,
+		ttl:      ttl,
+		tokens:   make(map[string]revocation),
+		sessions: make(map[string]revocation),
+		users:    make(map[string]revocation),
+	}
+}
+
+func (r *TokenDenylistMemoryRepository) RevokeToken(ctx context.Context, tokenId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[tokenId] = r.revocation(r.clock.Now())
+	return nil
+}
+
+func (r *TokenDenylistMemoryRepository) RevokeSessions(ctx context.Context, sessionIds ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range sessionIds {
+		r.sessions[id] = r.revocation(r.clock.Now())
+	}
+	return nil
+}
+
+func (r *TokenDenylistMemoryRepository) RevokeUser(ctx context.Context, userId string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[userId] = r.revocation(at)
+	return nil
+}
+
+func (r *TokenDenylistMemoryRepository) IsRevoked(ctx context.Context, tokenId, sessionId, userId string, issuedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock.Now()
+	live := func(entries map[string]revocation, id string) (revocation, bool) {
+		entry, ok := entries[id]
+		return entry, ok && id != "" && now.Before(entry.expiresAt)
+	}
+	if _, ok := live(r.tokens, tokenId); ok {
+		return true, nil
+	}
+	if _, ok := live(r.sessions, sessionId); ok {
+		return true, nil
+	}
+	if entry, ok := live(r.users, userId); ok && issuedAt.Unix() <= entry.at.Unix() {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *TokenDenylistMemoryRepository) revocation(at time.Time) revocation {
+	return revocation{at: at, expiresAt: r.clock.Now().Add(r.ttl)}
+}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"sync"
+	"time"
+)
+
+type MagicLinkMemoryRepository struct {
+	clock clock.Clock
+	mu    sync.RWMutex
+	links map[string]entities.MagicLink
+}
+
+func NewMagicLinkMemoryRepository(clock clock.Clock) *MagicLinkMemoryRepository {
+	return &MagicLinkMemoryRepository{
+		clock: clock,
+		links: make(map[string]entities.MagicLink),
+	}
+}
+
+func (r *MagicLinkMemoryRepository) Create(ctx context.Context, link *entities.MagicLink) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	created := *link
+	created.Id = newId()
+	r.links[link.Code] = created
+	return nil
+}
+
+// FindValidByCode only returns links that match the cookie and are neither used nor expired.
+func (r *MagicLinkMemoryRepository) FindValidByCode(ctx context.Context, code, cookie string) (*entities.MagicLink, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	link, ok := r.links[code]
+	if !ok || link.Cookie != cookie || link.Used || !link.ValidUntil.After(r.clock.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	return &link, nil
+}
+
+func (r *MagicLinkMemoryRepository) Consume(ctx context.Context, code, cookie string) (*entities.MagicLink, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	link, ok := r.links[code]
+	if !ok || link.Cookie != cookie || link.Used || !link.ValidUntil.After(r.clock.Now()) {
+		return nil, sql.ErrNoRows
+	}
+	link.Used = true
+	r.links[code] = link
+	return &link, nil
+}
+
+func (r *MagicLinkMemoryRepository) Invalidate(ctx context.Context, code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if link, ok := r.links[code]; ok {
+		link.Used = true
+		r.links[code] = link
+	}
+	return nil
+}
+
+func (r *MagicLinkMemoryRepository) Update(ctx context.Context, link *entities.MagicLink) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.links[link.Code]; ok {
+		stored.Used = link.Used
+		r.links[link.Code] = stored
+	}
+	return nil
+}
+
+func (r *MagicLinkMemoryRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for code, link := range r.links {
+		if deleted == int64(limit) {
+			break
+		}
+		if link.Used || link.ValidUntil.Before(before) {
+			delete(r.links, code)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
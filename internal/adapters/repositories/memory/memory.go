@@ -0,0 +1,13 @@
+package repositories
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newId returns a random identifier, standing in for the ids generated by the database.
+func newId() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,39 @@
+package repositories
+
+import (
+	"github.com/jmjp/gopasswordless/internal/adapters/repositories/conformance"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"testing"
+	"time"
+)
+
+func TestUserMemoryRepository(t *testing.T) {
+	conformance.UserRepository(t, func(t *testing.T) ports.UserRepository {
+		return NewUserMemoryRepository(clock.System)
+	})
+}
+
+func TestSessionMemoryRepository(t *testing.T) {
+	conformance.SessionRepository(t, func(t *testing.T) (ports.SessionRepository, ports.UserRepository) {
+		return NewSessionMemoryRepository(clock.System), NewUserMemoryRepository(clock.System)
+	})
+}
+
+func TestMagicLinkMemoryRepository(t *testing.T) {
+	conformance.MagicLinkRepository(t, func(t *testing.T) (ports.MagicLinkRepository, ports.UserRepository) {
+		return NewMagicLinkMemoryRepository(clock.System), NewUserMemoryRepository(clock.System)
+	})
+}
+
+func TestRedisCacheMemoryRepository(t *testing.T) {
+	conformance.CacheRepository(t, func(t *testing.T) ports.RedisCacheRepository {
+		return NewRedisCacheMemoryRepository(clock.System)
+	})
+}
+
+func TestTokenDenylistMemoryRepository(t *testing.T) {
+	conformance.TokenDenylist(t, func(t *testing.T) ports.TokenDenylist {
+		return NewTokenDenylistMemoryRepository(clock.System, time.Hour)
+	})
+}
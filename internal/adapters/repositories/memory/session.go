@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"sync"
+	"time"
+)
+
+type SessionMemoryRepository struct {
+	clock    clock.Clock
+	mu       sync.RWMutex
+	sessions map[string]entities.Session
+	// order keeps the insertion order so All is stable
+	order []string
+}
+
+func NewSessionMemoryRepository(clock clock.Clock) *SessionMemoryRepository {
+	return &SessionMemoryRepository{
+		clock:    clock,
+		sessions: make(map[string]entities.Session),
+	}
+}
+
+func (r *SessionMemoryRepository) Create(ctx context.Context, session *entities.Session) (*entities.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	created := entities.Session{
+		Id:         newId(),
+		UserId:     session.UserId,
+		ValidUntil: session.ValidUntil,
+		UserAgent:  session.UserAgent,
+		CreatedAt:  r.clock.Now(),
+	}
+	created.UpdateDevice(session.Browser, session.BrowserVersion, session.OS, session.DeviceType, session.DeviceLabel)
+	created.LastUsedAt, created.LastIp = session.LastUsedAt, session.LastIp
+	if created.LastUsedAt.IsZero() {
+		created.LastUsedAt = created.CreatedAt
+	}
+	created.UpdatedAt = created.CreatedAt
+	r.sessions[created.Id] = created
+	r.order = append(r.order, created.Id)
+	return &created, nil
+}
+
+func (r *SessionMemoryRepository) All(ctx context.Context, userId string) ([]*entities.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var sessions []*entities.Session
+	for _, id := range r.order {
+		if s, ok := r.sessions[id]; ok && s.UserId == userId {
+			sessions = append(sessions, &s)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *SessionMemoryRepository) One(ctx context.Context, id string) (*entities.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &s, nil
+}
+
+func (r *SessionMemoryRepository) UpdateGeoLocation(ctx context.Context, session *entities.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[session.Id]
+	if !ok {
+		return nil
+	}
+	s.UpdateLocation(session.Latitude, session.Longitude, session.Ip, session.City, session.Region, session.Country, session.OrganizationName)
+	r.sessions[session.Id] = s
+	return nil
+}
+
+func (r *SessionMemoryRepository) Update(ctx context.Context, session *entities.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[session.Id]
+	if !ok {
+		return nil
+	}
+	s.ValidUntil = session.ValidUntil
+	s.UserAgent = session.UserAgent
+	s.UpdateDevice(session.Browser, session.BrowserVersion, session.OS, session.DeviceType, session.DeviceLabel)
+	r.sessions[session.Id] = s
+	return nil
+}
+
+func (r *SessionMemoryRepository) Touch(ctx context.Context, sessionId string, usedAt time.Time, ip string, refreshes int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sessions[sessionId]
+	if !ok {
+		return nil
+	}
+	s.Touch(usedAt, ip, refreshes)
+	r.sessions[sessionId] = s
+	return nil
+}
+
+func (r *SessionMemoryRepository) Disconnect(ctx context.Context, sessionId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, sessionId)
+	return nil
+}
+
+func (r *SessionMemoryRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for _, id := range r.order {
+		if deleted == int64(limit) {
+			break
+		}
+		if s, ok := r.sessions[id]; ok && s.ValidUntil.Before(before) {
+			delete(r.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *SessionMemoryRepository) DisconnectAll(ctx context.Context, userId string) (int64, error) {
+	return r.DisconnectAllExcept(ctx, userId, "")
+}
+
+func (r *SessionMemoryRepository) DisconnectAllExcept(ctx context.Context, userId, sessionId string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for id, s := range r.sessions {
+		if s.UserId == userId && id != sessionId {
+			delete(r.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
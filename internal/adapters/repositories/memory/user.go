@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"sync"
+)
+
+var errDuplicateEmail = errors.New("duplicate key value violates unique constraint \"users_email_key\"")
+
+// UserMemoryRepository keeps users in memory. Like the Postgres repository it
+// returns sql.ErrNoRows when nothing matches and copies on the way in and out.
+type UserMemoryRepository struct {
+	clock clock.Clock
+	mu    sync.RWMutex
+	users map[string]entities.User
+}
+
+func NewUserMemoryRepository(clock clock.Clock) *UserMemoryRepository {
+	return &UserMemoryRepository{
+		clock: clock,
+		users: make(map[string]entities.User),
+	}
+}
+
+func (r *UserMemoryRepository) Create(ctx context.Context, user *entities.User) (*entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Email == user.Email {
+			return nil, errDuplicateEmail
+		}
+	}
+	created := *user
+	created.ID = newId()
+	created.CreatedAt = r.clock.Now()
+	created.UpdatedAt = created.CreatedAt
+	r.users[created.ID] = created
+	return &created, nil
+}
+
+func (r *UserMemoryRepository) FindByEmail(ctx context.Context, email string) (*entities.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, u := range r.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *UserMemoryRepository) FindById(ctx context.Context, id string) (*entities.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &u, nil
+}
+
+func (r *UserMemoryRepository) FindUserBySliceIds(ctx context.Context, ids []string) ([]*entities.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var users []*entities.User
+	for _, id := range ids {
+		if u, ok := r.users[id]; ok {
+			users = append(users, &u)
+		}
+	}
+	return users, nil
+}
+
+func (r *UserMemoryRepository) Update(ctx context.Context, user *entities.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[user.ID]
+	if !ok {
+		return nil
+	}
+	u.Username = user.Username
+	u.Avatar = user.Avatar
+	u.Blocked = user.Blocked
+	u.UpdatedAt = user.UpdatedAt
+	r.users[user.ID] = u
+	return nil
+}
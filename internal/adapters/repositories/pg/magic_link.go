@@ -1,8 +1,10 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
-	"hyperzoop/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"time"
 )
 
 type MagicLinkPostgresRepository struct {
@@ -13,25 +15,52 @@ func NewMagicLinkPostgresRepository(db *sql.DB) *MagicLinkPostgresRepository {
 	return &MagicLinkPostgresRepository{db: db}
 }
 
-func (r *MagicLinkPostgresRepository) Create(link *entities.MagicLink) error {
-	_, err := r.db.Exec("INSERT INTO magic_links (code, user_id, cookie, valid_until, used) VALUES ($1, $2, $3, $4, $5)", link.Code, link.UserId, link.Cookie, link.ValidUntil, link.Used)
+func (r *MagicLinkPostgresRepository) Create(ctx context.Context, link *entities.MagicLink) (err error) {
+	ctx, span := startSpan(ctx, "MagicLinkPostgresRepository.Create", "magic_links", "INSERT")
+	defer func() { endSpan(span, err) }()
+	_, err = r.db.ExecContext(ctx, "INSERT INTO magic_links (code, user_id, cookie, valid_until, used) VALUES ($1, $2, $3, $4, $5)", link.Code, link.UserId, link.Cookie, link.ValidUntil, link.Used)
 	return err
 }
 
-func (r *MagicLinkPostgresRepository) FindValidByCode(code, cookie string) (*entities.MagicLink, error) {
-	row := r.db.QueryRow("SELECT code, user_id, cookie, valid_until, used FROM magic_links WHERE code = $1 AND cookie = $2 AND valid_until > NOW() AND used = false", code, cookie)
+func (r *MagicLinkPostgresRepository) FindValidByCode(ctx context.Context, code, cookie string) (out *entities.MagicLink, err error) {
+	ctx, span := startSpan(ctx, "MagicLinkPostgresRepository.FindValidByCode", "magic_links", "SELECT")
+	defer func() { endSpan(span, err) }()
+	row := r.db.QueryRowContext(ctx, "SELECT code, user_id, cookie, valid_until, used FROM magic_links WHERE code = $1 AND cookie = $2 AND valid_until > NOW() AND used = false", code, cookie)
 	return convertRowToMagicLink(row)
 }
 
-func (r *MagicLinkPostgresRepository) Invalidate(code string) error {
-	_, err := r.db.Exec("UPDATE magic_links SET used = true WHERE code = $1", code)
+func (r *MagicLinkPostgresRepository) Consume(ctx context.Context, code, cookie string) (out *entities.MagicLink, err error) {
+	ctx, span := startSpan(ctx, "MagicLinkPostgresRepository.Consume", "magic_links", "UPDATE")
+	defer func() { endSpan(span, err) }()
+	row := r.db.QueryRowContext(ctx, "UPDATE magic_links SET used = true WHERE code = $1 AND cookie = $2 AND valid_until > NOW() AND used = false RETURNING code, user_id, cookie, valid_until, used", code, cookie)
+	return convertRowToMagicLink(row)
+}
+
+func (r *MagicLinkPostgresRepository) Invalidate(ctx context.Context, code string) (err error) {
+	ctx, span := startSpan(ctx, "MagicLinkPostgresRepository.Invalidate", "magic_links", "UPDATE")
+	defer func() { endSpan(span, err) }()
+	_, err = r.db.ExecContext(ctx, "UPDATE magic_links SET used = true WHERE code = $1", code)
 	return err
 }
 
-func (r *MagicLinkPostgresRepository) Update(link *entities.MagicLink) error {
-	_, err := r.db.Exec("UPDATE magic_links SET used = $1 WHERE code = $2", link.Used, link.Code)
+func (r *MagicLinkPostgresRepository) Update(ctx context.Context, link *entities.MagicLink) (err error) {
+	ctx, span := startSpan(ctx, "MagicLinkPostgresRepository.Update", "magic_links", "UPDATE")
+	defer func() { endSpan(span, err) }()
+	_, err = r.db.ExecContext(ctx, "UPDATE magic_links SET used = $1 WHERE code = $2", link.Used, link.Code)
 	return err
 }
+
+// DeleteExpired removes up to limit links that were used or expired before the given time.
+func (r *MagicLinkPostgresRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (deleted int64, err error) {
+	ctx, span := startSpan(ctx, "MagicLinkPostgresRepository.DeleteExpired", "magic_links", "DELETE")
+	defer func() { endSpan(span, err) }()
+	res, err := r.db.ExecContext(ctx, "DELETE FROM magic_links WHERE id IN (SELECT id FROM magic_links WHERE valid_until < $1 OR used = true LIMIT $2)", before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func convertRowToMagicLink(row *sql.Row) (*entities.MagicLink, error) {
 	var link entities.MagicLink
 	err := row.Scan(&link.Code, &link.UserId, &link.Cookie, &link.ValidUntil, &link.Used)
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmjp/gopasswordless/internal/adapters/repositories/conformance"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/migrate"
+	"os"
+	"sync"
+	"testing"
+)
+
+var (
+	testDB     *sql.DB
+	testDBErr  error
+	testDBOnce sync.Once
+)
+
+// openTestDB connects to the database named by TEST_DATABASE_URL, migrates it
+// and empties the tables once per run. Postgres and CockroachDB are both
+// supported; the tests are skipped when the variable is unset.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	testDBOnce.Do(func() {
+		ctx := context.Background()
+		testDB, testDBErr = sql.Open("postgres", url)
+		if testDBErr != nil {
+			return
+		}
+		migrator, err := migrate.NewMigratorFor(ctx, testDB, os.Getenv("TEST_DATABASE_DIALECT"))
+		if err != nil {
+			testDBErr = err
+			return
+		}
+		if _, testDBErr = migrator.Up(ctx); testDBErr != nil {
+			return
+		}
+		_, testDBErr = testDB.ExecContext(ctx, "TRUNCATE magic_links, sessions, users")
+	})
+	if testDBErr != nil {
+		t.Fatalf("preparing test database: %v", testDBErr)
+	}
+	return testDB
+}
+
+func TestUserPostgresRepository(t *testing.T) {
+	conformance.UserRepository(t, func(t *testing.T) ports.UserRepository {
+		return NewUserPostgresRepository(openTestDB(t))
+	})
+}
+
+func TestSessionPostgresRepository(t *testing.T) {
+	conformance.SessionRepository(t, func(t *testing.T) (ports.SessionRepository, ports.UserRepository) {
+		db := openTestDB(t)
+		return NewSessionPostgresRepository(db), NewUserPostgresRepository(db)
+	})
+}
+
+func TestMagicLinkPostgresRepository(t *testing.T) {
+	conformance.MagicLinkRepository(t, func(t *testing.T) (ports.MagicLinkRepository, ports.UserRepository) {
+		db := openTestDB(t)
+		return NewMagicLinkPostgresRepository(db), NewUserPostgresRepository(db)
+	})
+}
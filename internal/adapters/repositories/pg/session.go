@@ -1,10 +1,17 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
-	"hyperzoop/internal/core/entities"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+const sessionColumns = "id, user_id, valid_until, user_agent, ip, latitude, longitude, city, region, country, isp, browser, browser_version, os, device_type, device_label, last_used_at, last_ip, refresh_count, created_at, updated_at"
+
 type SessionPostgresRepository struct {
 	db *sql.DB
 }
@@ -13,13 +20,17 @@ func NewSessionPostgresRepository(db *sql.DB) *SessionPostgresRepository {
 	return &SessionPostgresRepository{db: db}
 }
 
-func (r *SessionPostgresRepository) Create(session *entities.Session) (*entities.Session, error) {
-	row := r.db.QueryRow("INSERT INTO sessions (user_id, valid_until) VALUES ($1, $2) RETURNING id, user_id, valid_until, user_agent, ip, latitude, longitude, city, region, country, isp, created_at, updated_at", session.UserId, session.ValidUntil)
+func (r *SessionPostgresRepository) Create(ctx context.Context, session *entities.Session) (out *entities.Session, err error) {
+	ctx, span := startSpan(ctx, "SessionPostgresRepository.Create", "sessions", "INSERT")
+	defer func() { endSpan(span, err) }()
+	row := r.db.QueryRowContext(ctx, "INSERT INTO sessions (user_id, valid_until, user_agent, last_used_at, last_ip, browser, browser_version, os, device_type, device_label) VALUES ($1, $2, $3, COALESCE($4, current_timestamp), $5, $6, $7, $8, $9, $10) RETURNING "+sessionColumns, session.UserId, session.ValidUntil, session.UserAgent, nullTime(session.LastUsedAt), session.LastIp, session.Browser, session.BrowserVersion, session.OS, session.DeviceType, session.DeviceLabel)
 	return convertRowToSession(row)
 }
 
-func (r *SessionPostgresRepository) All(userId string) ([]*entities.Session, error) {
-	rows, err := r.db.Query("SELECT id, user_id, valid_until, user_agent, ip, latitude, longitude, city, region, country, isp, created_at, updated_at FROM sessions WHERE user_id = $1", userId)
+func (r *SessionPostgresRepository) All(ctx context.Context, userId string) (out []*entities.Session, err error) {
+	ctx, span := startSpan(ctx, "SessionPostgresRepository.All", "sessions", "SELECT")
+	defer func() { endSpan(span, err) }()
+	rows, err := r.db.QueryContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE user_id = $1 ORDER BY last_used_at DESC", userId)
 	if err != nil {
 		return nil, err
 	}
@@ -36,34 +47,97 @@ func (r *SessionPostgresRepository) All(userId string) ([]*entities.Session, err
 	return sessions, nil
 }
 
-func (r *SessionPostgresRepository) One(id string) (*entities.Session, error) {
-	row := r.db.QueryRow("SELECT id, user_id, valid_until, user_agent, ip, latitude, longitude, city, region, country, isp, created_at, updated_at FROM sessions WHERE id = $1 LIMIT 1", id)
-	return convertRowToSession(row)
+func (r *SessionPostgresRepository) One(ctx context.Context, id string) (out *entities.Session, err error) {
+	ctx, span := startSpan(ctx, "SessionPostgresRepository.One", "sessions", "SELECT")
+	defer func() { endSpan(span, err) }()
+	row := r.db.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = $1 LIMIT 1", id)
+	out, err = convertRowToSession(row)
+	if isInvalidText(err) {
+		// ids come from cookies and clients: one that isn't a uuid can't exist
+		return nil, sql.ErrNoRows
+	}
+	return out, err
+}
+
+func (r *SessionPostgresRepository) UpdateGeoLocation(ctx context.Context, session *entities.Session) (err error) {
+	ctx, span := startSpan(ctx, "SessionPostgresRepository.UpdateGeoLocation", "sessions", "UPDATE")
+	defer func() { endSpan(span, err) }()
+	_, err = r.db.ExecContext(ctx, "UPDATE sessions set ip = $1, latitude = $2, longitude = $3, city = $4, region = $5, country = $6, isp = $7 WHERE id = $8", session.Ip, session.Latitude, session.Longitude, session.City, session.Region, session.Country, session.OrganizationName, session.Id)
+	return err
 }
 
-func (r *SessionPostgresRepository) UpdateGeoLocation(session *entities.Session) error {
-	_, err := r.db.Exec("UPDATE sessions set ip = $1, latitude = $2, longitude = $3, city = $4, region = $5, country = $6, isp = $7 WHERE id = $8", session.Ip, session.Latitude, session.Longitude, session.City, session.Region, session.Country, session.OrganizationName, session.Id)
+func (r *SessionPostgresRepository) Update(ctx context.Context, session *entities.Session) (err error) {
+	ctx, span := startSpan(ctx, "SessionPostgresRepository.Update", "sessions", "UPDATE")
+	defer func() { endSpan(span, err) }()
+	_, err = r.db.ExecContext(ctx, "UPDATE sessions set valid_until = $1, user_agent = $2, browser = $3, browser_version = $4, os = $5, device_type = $6, device_label = $7 WHERE id = $8", session.ValidUntil, session.UserAgent, session.Browser, session.BrowserVersion, session.OS, session.DeviceType, session.DeviceLabel, session.Id)
 	return err
 }
 
-func (r *SessionPostgresRepository) Update(session *entities.Session) error {
-	_, err := r.db.Exec("UPDATE sessions set valid_until = $1, user_agent = $2 WHERE id = $3", session.ValidUntil, session.UserAgent, session.Id)
+func (r *SessionPostgresRepository) Touch(ctx context.Context, sessionId string, usedAt time.Time, ip string, refreshes int64) (err error) {
+	ctx, span := startSpan(ctx, "SessionPostgresRepository.Touch", "sessions", "UPDATE")
+	defer func() { endSpan(span, err) }()
+	_, err = r.db.ExecContext(ctx, "UPDATE sessions set last_used_at = GREATEST(last_used_at, $1), last_ip = COALESCE(NULLIF($2, ''), last_ip), refresh_count = refresh_count + $3 WHERE id = $4", usedAt, ip, refreshes, sessionId)
 	return err
 }
 
-func (r *SessionPostgresRepository) Disconnect(sessionId string) error {
-	_, err := r.db.Exec("DELETE FROM sessions WHERE id = $1", sessionId)
+func (r *SessionPostgresRepository) Disconnect(ctx context.Context, sessionId string) (err error) {
+	ctx, span := startSpan(ctx, "SessionPostgresRepository.Disconnect", "sessions", "DELETE")
+	defer func() { endSpan(span, err) }()
+	_, err = r.db.ExecContext(ctx, "DELETE FROM sessions WHERE id = $1", sessionId)
 	return err
 }
 
+func (r *SessionPostgresRepository) DisconnectAll(ctx context.Context, userId string) (deleted int64, err error) {
+	ctx, span := startSpan(ctx, "SessionPostgresRepository.DisconnectAll", "sessions", "DELETE")
+	defer func() { endSpan(span, err) }()
+	res, err := r.db.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1", userId)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *SessionPostgresRepository) DisconnectAllExcept(ctx context.Context, userId, sessionId string) (deleted int64, err error) {
+	ctx, span := startSpan(ctx, "SessionPostgresRepository.DisconnectAllExcept", "sessions", "DELETE")
+	defer func() { endSpan(span, err) }()
+	res, err := r.db.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1 AND id <> $2", userId, sessionId)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpired removes up to limit sessions that expired before the given time.
+func (r *SessionPostgresRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (deleted int64, err error) {
+	ctx, span := startSpan(ctx, "SessionPostgresRepository.DeleteExpired", "sessions", "DELETE")
+	defer func() { endSpan(span, err) }()
+	res, err := r.db.ExecContext(ctx, "DELETE FROM sessions WHERE id IN (SELECT id FROM sessions WHERE valid_until < $1 LIMIT $2)", before, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func convertRowToSession(row *sql.Row) (*entities.Session, error) {
 	var s entities.Session
-	err := row.Scan(&s.Id, &s.UserId, &s.ValidUntil, &s.UserAgent, &s.Ip, &s.Latitude, &s.Longitude, &s.City, &s.Region, &s.Country, &s.OrganizationName, &s.CreatedAt, &s.UpdatedAt)
+	err := row.Scan(&s.Id, &s.UserId, &s.ValidUntil, &s.UserAgent, &s.Ip, &s.Latitude, &s.Longitude, &s.City, &s.Region, &s.Country, &s.OrganizationName, &s.Browser, &s.BrowserVersion, &s.OS, &s.DeviceType, &s.DeviceLabel, &s.LastUsedAt, &s.LastIp, &s.RefreshCount, &s.CreatedAt, &s.UpdatedAt)
 	return &s, err
 }
 
 func convertRowToSessionSlice(rows *sql.Rows) (*entities.Session, error) {
 	var s entities.Session
-	err := rows.Scan(&s.Id, &s.UserId, &s.ValidUntil, &s.UserAgent, &s.Ip, &s.Latitude, &s.Longitude, &s.City, &s.Region, &s.Country, &s.OrganizationName, &s.CreatedAt, &s.UpdatedAt)
+	err := rows.Scan(&s.Id, &s.UserId, &s.ValidUntil, &s.UserAgent, &s.Ip, &s.Latitude, &s.Longitude, &s.City, &s.Region, &s.Country, &s.OrganizationName, &s.Browser, &s.BrowserVersion, &s.OS, &s.DeviceType, &s.DeviceLabel, &s.LastUsedAt, &s.LastIp, &s.RefreshCount, &s.CreatedAt, &s.UpdatedAt)
 	return &s, err
 }
+
+// isInvalidText reports whether err is the invalid_text_representation error
+// both Postgres and CockroachDB return for a malformed uuid.
+func isInvalidText(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "22P02"
+}
+
+// nullTime stores the zero time as NULL so the column default applies.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
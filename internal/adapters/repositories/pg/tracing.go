@@ -0,0 +1,27 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func startSpan(ctx context.Context, name, table, operation string) (context.Context, trace.Span) {
+	return telemetry.StartClientSpan(ctx, name,
+		semconv.DBSystemPostgreSQL,
+		semconv.DBSQLTable(table),
+		semconv.DBOperation(operation),
+	)
+}
+
+// endSpan ends the span, not flagging sql.ErrNoRows as a failure since the
+// services treat it as a regular "not found" outcome.
+func endSpan(span trace.Span, err error) {
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	telemetry.EndSpan(span, err)
+}
@@ -1,8 +1,9 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
-	"hyperzoop/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
 
 	"github.com/lib/pq"
 )
@@ -15,23 +16,31 @@ func NewUserPostgresRepository(db *sql.DB) *UserPostgresRepository {
 	return &UserPostgresRepository{db: db}
 }
 
-func (r *UserPostgresRepository) Create(user *entities.User) (*entities.User, error) {
-	row := r.db.QueryRow("INSERT INTO users (username, email, avatar, blocked) VALUES ($1, $2, $3, $4) RETURNING id, username, email, avatar, blocked, created_at, updated_at", user.Username, user.Email, user.Avatar, user.Blocked)
+func (r *UserPostgresRepository) Create(ctx context.Context, user *entities.User) (out *entities.User, err error) {
+	ctx, span := startSpan(ctx, "UserPostgresRepository.Create", "users", "INSERT")
+	defer func() { endSpan(span, err) }()
+	row := r.db.QueryRowContext(ctx, "INSERT INTO users (username, email, avatar, blocked) VALUES ($1, $2, $3, $4) RETURNING id, username, email, avatar, blocked, created_at, updated_at", user.Username, user.Email, user.Avatar, user.Blocked)
 	return convertRowToUser(row)
 }
 
-func (r *UserPostgresRepository) FindByEmail(email string) (*entities.User, error) {
-	row := r.db.QueryRow("SELECT id, username, email, avatar, blocked, created_at, updated_at FROM users WHERE email = $1 LIMIT 1", email)
+func (r *UserPostgresRepository) FindByEmail(ctx context.Context, email string) (out *entities.User, err error) {
+	ctx, span := startSpan(ctx, "UserPostgresRepository.FindByEmail", "users", "SELECT")
+	defer func() { endSpan(span, err) }()
+	row := r.db.QueryRowContext(ctx, "SELECT id, username, email, avatar, blocked, created_at, updated_at FROM users WHERE email = $1 LIMIT 1", email)
 	return convertRowToUser(row)
 }
 
-func (r *UserPostgresRepository) FindById(id string) (*entities.User, error) {
-	row := r.db.QueryRow("SELECT id, username, email, avatar, blocked, created_at, updated_at FROM users WHERE id = $1 LIMIT 1", id)
+func (r *UserPostgresRepository) FindById(ctx context.Context, id string) (out *entities.User, err error) {
+	ctx, span := startSpan(ctx, "UserPostgresRepository.FindById", "users", "SELECT")
+	defer func() { endSpan(span, err) }()
+	row := r.db.QueryRowContext(ctx, "SELECT id, username, email, avatar, blocked, created_at, updated_at FROM users WHERE id = $1 LIMIT 1", id)
 	return convertRowToUser(row)
 }
 
-func (r *UserPostgresRepository) FindUserBySliceIds(ids []string) ([]*entities.User, error) {
-	rows, err := r.db.Query("SELECT id, username, email, avatar, blocked, created_at, updated_at FROM users WHERE id = ANY($1)", pq.Array(ids))
+func (r *UserPostgresRepository) FindUserBySliceIds(ctx context.Context, ids []string) (out []*entities.User, err error) {
+	ctx, span := startSpan(ctx, "UserPostgresRepository.FindUserBySliceIds", "users", "SELECT")
+	defer func() { endSpan(span, err) }()
+	rows, err := r.db.QueryContext(ctx, "SELECT id, username, email, avatar, blocked, created_at, updated_at FROM users WHERE id = ANY($1)", pq.Array(ids))
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +48,13 @@ func (r *UserPostgresRepository) FindUserBySliceIds(ids []string) ([]*entities.U
 	return convertRowToUserSlice(rows)
 }
 
+func (r *UserPostgresRepository) Update(ctx context.Context, user *entities.User) (err error) {
+	ctx, span := startSpan(ctx, "UserPostgresRepository.Update", "users", "UPDATE")
+	defer func() { endSpan(span, err) }()
+	_, err = r.db.ExecContext(ctx, "UPDATE users SET username = $1, avatar = $2, blocked = $3, updated_at = $4 WHERE id = $5", user.Username, user.Avatar, user.Blocked, user.UpdatedAt, user.ID)
+	return err
+}
+
 func convertRowToUser(row *sql.Row) (*entities.User, error) {
 	var user entities.User
 	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Avatar, &user.Blocked, &user.CreatedAt, &user.UpdatedAt)
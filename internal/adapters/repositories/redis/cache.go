@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -17,14 +18,34 @@ func NewRedisCacheRepository(redis *redis.Client) *RedisCacheRepository {
 	}
 }
 
-func (r *RedisCacheRepository) Set(key string, value string, expiration time.Duration) error {
-	return r.redis.Set(context.Background(), key, value, expiration).Err()
+func (r *RedisCacheRepository) Set(ctx context.Context, key string, value string, expiration time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "RedisCacheRepository.Set", "SET")
+	defer func() { endSpan(span, err) }()
+	return r.redis.Set(ctx, key, value, expiration).Err()
 }
 
-func (r *RedisCacheRepository) Get(key string) (string, error) {
-	return r.redis.Get(context.Background(), key).Result()
+func (r *RedisCacheRepository) Get(ctx context.Context, key string) (value string, err error) {
+	ctx, span := startSpan(ctx, "RedisCacheRepository.Get", "GET")
+	defer func() { endSpan(span, err) }()
+	value, err = r.redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ports.ErrCacheMiss
+	}
+	return value, err
+}
+
+func (r *RedisCacheRepository) Take(ctx context.Context, key string) (value string, err error) {
+	ctx, span := startSpan(ctx, "RedisCacheRepository.Take", "GETDEL")
+	defer func() { endSpan(span, err) }()
+	value, err = r.redis.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ports.ErrCacheMiss
+	}
+	return value, err
 }
 
-func (r *RedisCacheRepository) Invalidate(key string) error {
-	return r.redis.Del(context.Background(), key).Err()
+func (r *RedisCacheRepository) Invalidate(ctx context.Context, key string) (err error) {
+	ctx, span := startSpan(ctx, "RedisCacheRepository.Invalidate", "DEL")
+	defer func() { endSpan(span, err) }()
+	return r.redis.Del(ctx, key).Err()
 }
@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const denylistPrefix = "hyperzoop:denylist:"
+
+// TokenDenylistRedisRepository keeps revocations for ttl, the lifetime of an
+// access token, after which the tokens they deny have expired anyway.
+type TokenDenylistRedisRepository struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+func NewTokenDenylistRedisRepository(redis *redis.Client, ttl time.Duration) *TokenDenylistRedisRepository {
+	return &TokenDenylistRedisRepository{redis: redis, ttl: ttl}
+}
+
+func tokenDenylistKey(tokenId string) string {
+	return denylistPrefix + "token:" + tokenId
+}
+
+func sessionDenylistKey(sessionId string) string {
+	return denylistPrefix + "session:" + sessionId
+}
+
+func userDenylistKey(userId string) string {
+	return denylistPrefix + "user:" + userId
+}
+
+func (r *TokenDenylistRedisRepository) RevokeToken(ctx context.Context, tokenId string) (err error) {
+	ctx, span := startSpan(ctx, "TokenDenylistRedisRepository.RevokeToken", "SET")
+	defer func() { endSpan(span, err) }()
+	return r.redis.Set(ctx, tokenDenylistKey(tokenId), "1", r.ttl).Err()
+}
+
+func (r *TokenDenylistRedisRepository) RevokeSessions(ctx context.Context, sessionIds ...string) (err error) {
+	ctx, span := startSpan(ctx, "TokenDenylistRedisRepository.RevokeSessions", "SET")
+	defer func() { endSpan(span, err) }()
+	if len(sessionIds) == 0 {
+		return nil
+	}
+	pipe := r.redis.Pipeline()
+	for _, id := range sessionIds {
+		pipe.Set(ctx, sessionDenylistKey(id), "1", r.ttl)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RevokeUser stores the second of the revocation: tokens issued during that
+// second are denied too, since their issue time has no finer precision.
+func (r *TokenDenylistRedisRepository) RevokeUser(ctx context.Context, userId string, at time.Time) (err error) {
+	ctx, span := startSpan(ctx, "TokenDenylistRedisRepository.RevokeUser", "SET")
+	defer func() { endSpan(span, err) }()
+	return r.redis.Set(ctx, userDenylistKey(userId), at.Unix(), r.ttl).Err()
+}
+
+func (r *TokenDenylistRedisRepository) IsRevoked(ctx context.Context, tokenId, sessionId, userId string, issuedAt time.Time) (revoked bool, err error) {
+	ctx, span := startSpan(ctx, "TokenDenylistRedisRepository.IsRevoked", "MGET")
+	defer func() { endSpan(span, err) }()
+	var keys []string
+	if tokenId != "" {
+		keys = append(keys, tokenDenylistKey(tokenId))
+	}
+	if sessionId != "" {
+		keys = append(keys, sessionDenylistKey(sessionId))
+	}
+	if userId != "" {
+		keys = append(keys, userDenylistKey(userId))
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+	values, err := r.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if keys[i] != userDenylistKey(userId) {
+			return true, nil
+		}
+		revokedAt, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return false, err
+		}
+		if issuedAt.Unix() <= revokedAt {
+			return true, nil
+		}
+	}
+	return false, nil
+}
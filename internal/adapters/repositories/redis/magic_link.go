@@ -2,15 +2,21 @@ package repositories
 
 import (
 	"context"
+	"crypto/subtle"
+	"database/sql"
 	"encoding/json"
-	"errors"
-	"fmt"
-	"hyperzoop/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// magicLinkPrefix namespaces the link keys, which are looked up by code.
+const magicLinkPrefix = "hyperzoop:magic_link:"
+
+// MagicLinkRedisRepository stores each link as JSON under its code, expiring
+// with the link itself. Lookups follow the Postgres repository: they miss with
+// sql.ErrNoRows unless the fingerprint matches and the link is neither used nor expired.
 type MagicLinkRedisRepository struct {
 	redis *redis.Client
 }
@@ -21,36 +27,98 @@ func NewMagicLinkRedisRepository(redis *redis.Client) *MagicLinkRedisRepository
 	}
 }
 
-func (r *MagicLinkRedisRepository) Create(link *entities.MagicLink) error {
-	var bytes, err = json.Marshal(link)
+func magicLinkKey(code string) string {
+	return magicLinkPrefix + code
+}
+
+func (r *MagicLinkRedisRepository) Create(ctx context.Context, link *entities.MagicLink) (err error) {
+	ctx, span := startSpan(ctx, "MagicLinkRedisRepository.Create", "SET")
+	defer func() { endSpan(span, err) }()
+	if link.IsExpired() {
+		// nothing could ever find it
+		return nil
+	}
+	bytes, err := json.Marshal(link)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
-	_, err = r.redis.Set(context.Background(), link.Code, string(bytes), time.Duration(time.Minute*15)).Result()
-	return err
+	return r.redis.SetArgs(ctx, magicLinkKey(link.Code), bytes, redis.SetArgs{ExpireAt: link.ValidUntil}).Err()
 }
 
-func (r *MagicLinkRedisRepository) FindValidByCode(code, cookie string) (*entities.MagicLink, error) {
-	out, err := r.redis.Get(context.Background(), code).Result()
+func (r *MagicLinkRedisRepository) FindValidByCode(ctx context.Context, code, cookie string) (link *entities.MagicLink, err error) {
+	ctx, span := startSpan(ctx, "MagicLinkRedisRepository.FindValidByCode", "GET")
+	defer func() { endSpan(span, err) }()
+	out, err := r.redis.Get(ctx, magicLinkKey(code)).Bytes()
 	if err != nil {
+		if err == redis.Nil {
+			return nil, sql.ErrNoRows
+		}
 		return nil, err
 	}
-	if out == "" {
-		return nil, errors.New("magic link not found")
+	if err := json.Unmarshal(out, &link); err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(link.Cookie), []byte(cookie)) != 1 || !link.IsValidYet() {
+		return nil, sql.ErrNoRows
+	}
+	return link, nil
+}
+
+// consumeScript deletes the link stored under KEYS[1] when its fingerprint is
+// ARGV[1] and it is unused, returning it.
+var consumeScript = redis.NewScript(`local value = redis.call("GET", KEYS[1])
+if not value then return false end
+local link = cjson.decode(value)
+if link.cookie ~= ARGV[1] or link.used then return false end
+redis.call("DEL", KEYS[1])
+return value`)
+
+// Consume removes the link as it returns it, so a second call misses.
+func (r *MagicLinkRedisRepository) Consume(ctx context.Context, code, cookie string) (link *entities.MagicLink, err error) {
+	ctx, span := startSpan(ctx, "MagicLinkRedisRepository.Consume", "EVALSHA")
+	defer func() { endSpan(span, err) }()
+	out, err := consumeScript.Run(ctx, r.redis, []string{magicLinkKey(code)}, cookie).Text()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
 	}
-	var link entities.MagicLink
 	if err := json.Unmarshal([]byte(out), &link); err != nil {
 		return nil, err
 	}
-	return &link, nil
+	// redis may not have evicted it yet
+	if link.IsExpired() {
+		return nil, sql.ErrNoRows
+	}
+	link.Used = true
+	return link, nil
 }
 
-func (r *MagicLinkRedisRepository) Invalidate(code string) error {
-	_, err := r.redis.Del(context.Background(), code).Result()
-	return err
+// Invalidate removes the link, a used link can't be found anymore anyway.
+func (r *MagicLinkRedisRepository) Invalidate(ctx context.Context, code string) (err error) {
+	ctx, span := startSpan(ctx, "MagicLinkRedisRepository.Invalidate", "DEL")
+	defer func() { endSpan(span, err) }()
+	return r.redis.Del(ctx, magicLinkKey(code)).Err()
 }
 
-func (r *MagicLinkRedisRepository) Update(link *entities.MagicLink) error {
-	_, err := r.redis.Set(context.Background(), link.Code, link, 0).Result()
+// DeleteExpired is a no-op, redis evicts links on its own once their TTL passes.
+func (r *MagicLinkRedisRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
+// Update rewrites a stored link, keeping its expiry. Links that already
+// expired are not recreated.
+func (r *MagicLinkRedisRepository) Update(ctx context.Context, link *entities.MagicLink) (err error) {
+	ctx, span := startSpan(ctx, "MagicLinkRedisRepository.Update", "SET")
+	defer func() { endSpan(span, err) }()
+	bytes, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	err = r.redis.SetArgs(ctx, magicLinkKey(link.Code), bytes, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return nil
+	}
 	return err
 }
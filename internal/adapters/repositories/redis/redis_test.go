@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"github.com/jmjp/gopasswordless/internal/adapters/repositories/conformance"
+	memoryRepositories "github.com/jmjp/gopasswordless/internal/adapters/repositories/memory"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestClient connects to TEST_REDIS_URL, or to an embedded miniredis when unset.
+func newTestClient(t *testing.T) *redis.Client {
+	t.Helper()
+	if url := os.Getenv("TEST_REDIS_URL"); url != "" {
+		opt, err := redis.ParseURL(url)
+		if err != nil {
+			t.Fatalf("parsing TEST_REDIS_URL: %v", err)
+		}
+		client := redis.NewClient(opt)
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRedisCacheRepository(t *testing.T) {
+	conformance.CacheRepository(t, func(t *testing.T) ports.RedisCacheRepository {
+		return NewRedisCacheRepository(newTestClient(t))
+	})
+}
+
+func TestMagicLinkRedisRepository(t *testing.T) {
+	conformance.MagicLinkRepository(t, func(t *testing.T) (ports.MagicLinkRepository, ports.UserRepository) {
+		return NewMagicLinkRedisRepository(newTestClient(t)), memoryRepositories.NewUserMemoryRepository(clock.System)
+	})
+}
+
+func TestSessionRedisRepository(t *testing.T) {
+	conformance.SessionRepository(t, func(t *testing.T) (ports.SessionRepository, ports.UserRepository) {
+		return NewSessionRedisRepository(newTestClient(t)), memoryRepositories.NewUserMemoryRepository(clock.System)
+	})
+}
+
+func TestTokenDenylistRedisRepository(t *testing.T) {
+	conformance.TokenDenylist(t, func(t *testing.T) ports.TokenDenylist {
+		return NewTokenDenylistRedisRepository(newTestClient(t), time.Hour)
+	})
+}
@@ -0,0 +1,268 @@
+package repositories
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionPrefix      = "hyperzoop:session:"
+	userSessionsPrefix = "hyperzoop:user_sessions:"
+)
+
+// SessionRedisRepository keeps sessions in Redis only, for deployments without
+// the Postgres sessions table. Each session is stored as JSON expiring with the
+// session, and a set per user indexes its session ids.
+type SessionRedisRepository struct {
+	redis *redis.Client
+}
+
+func NewSessionRedisRepository(redis *redis.Client) *SessionRedisRepository {
+	return &SessionRedisRepository{
+		redis: redis,
+	}
+}
+
+func sessionKey(id string) string {
+	return sessionPrefix + id
+}
+
+func userSessionsKey(userId string) string {
+	return userSessionsPrefix + userId
+}
+
+// newSessionId returns a random version 4 UUID, the format Postgres generates.
+func newSessionId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func (r *SessionRedisRepository) Create(ctx context.Context, session *entities.Session) (out *entities.Session, err error) {
+	ctx, span := startSpan(ctx, "SessionRedisRepository.Create", "EVALSHA")
+	defer func() { endSpan(span, err) }()
+	id, err := newSessionId()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out = &entities.Session{
+		Id:         id,
+		UserId:     session.UserId,
+		ValidUntil: session.ValidUntil,
+		UserAgent:  session.UserAgent,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	out.UpdateDevice(session.Browser, session.BrowserVersion, session.OS, session.DeviceType, session.DeviceLabel)
+	out.LastUsedAt, out.LastIp = session.LastUsedAt, session.LastIp
+	if out.LastUsedAt.IsZero() {
+		out.LastUsedAt = now
+	}
+	if out.IsExpired() {
+		// redis would drop it right away
+		return out, nil
+	}
+	return out, r.save(ctx, out, "NX")
+}
+
+func (r *SessionRedisRepository) All(ctx context.Context, userId string) (out []*entities.Session, err error) {
+	ctx, span := startSpan(ctx, "SessionRedisRepository.All", "SMEMBERS")
+	defer func() { endSpan(span, err) }()
+	ids, err := r.redis.SMembers(ctx, userSessionsKey(userId)).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = sessionKey(id)
+	}
+	values, err := r.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	var expired []any
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			expired = append(expired, ids[i])
+			continue
+		}
+		var session entities.Session
+		if err := json.Unmarshal([]byte(raw), &session); err != nil {
+			return nil, err
+		}
+		out = append(out, &session)
+	}
+	if len(expired) > 0 {
+		// prune the ids of sessions redis already evicted
+		if err := r.redis.SRem(ctx, userSessionsKey(userId), expired...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (r *SessionRedisRepository) One(ctx context.Context, id string) (out *entities.Session, err error) {
+	ctx, span := startSpan(ctx, "SessionRedisRepository.One", "GET")
+	defer func() { endSpan(span, err) }()
+	return r.load(ctx, id)
+}
+
+func (r *SessionRedisRepository) UpdateGeoLocation(ctx context.Context, session *entities.Session) (err error) {
+	ctx, span := startSpan(ctx, "SessionRedisRepository.UpdateGeoLocation", "EVALSHA")
+	defer func() { endSpan(span, err) }()
+	return r.update(ctx, session.Id, func(stored *entities.Session) {
+		stored.UpdateLocation(session.Latitude, session.Longitude, session.Ip, session.City, session.Region, session.Country, session.OrganizationName)
+		stored.UpdatedAt = time.Now()
+	})
+}
+
+func (r *SessionRedisRepository) Update(ctx context.Context, session *entities.Session) (err error) {
+	ctx, span := startSpan(ctx, "SessionRedisRepository.Update", "EVALSHA")
+	defer func() { endSpan(span, err) }()
+	return r.update(ctx, session.Id, func(stored *entities.Session) {
+		stored.ValidUntil = session.ValidUntil
+		stored.UserAgent = session.UserAgent
+		stored.UpdateDevice(session.Browser, session.BrowserVersion, session.OS, session.DeviceType, session.DeviceLabel)
+		stored.UpdatedAt = time.Now()
+	})
+}
+
+// Touch reads and rewrites the session, so two replicas touching it at the
+// same time may lose some refreshes of the count.
+func (r *SessionRedisRepository) Touch(ctx context.Context, sessionId string, usedAt time.Time, ip string, refreshes int64) (err error) {
+	ctx, span := startSpan(ctx, "SessionRedisRepository.Touch", "EVALSHA")
+	defer func() { endSpan(span, err) }()
+	return r.update(ctx, sessionId, func(stored *entities.Session) {
+		stored.Touch(usedAt, ip, refreshes)
+	})
+}
+
+func (r *SessionRedisRepository) Disconnect(ctx context.Context, sessionId string) (err error) {
+	ctx, span := startSpan(ctx, "SessionRedisRepository.Disconnect", "DEL")
+	defer func() { endSpan(span, err) }()
+	stored, err := r.load(ctx, sessionId)
+	if err != nil {
+		return ignoreMissing(err)
+	}
+	pipe := r.redis.TxPipeline()
+	pipe.Del(ctx, sessionKey(sessionId))
+	pipe.SRem(ctx, userSessionsKey(stored.UserId), sessionId)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *SessionRedisRepository) DisconnectAll(ctx context.Context, userId string) (int64, error) {
+	return r.disconnectAllExcept(ctx, "SessionRedisRepository.DisconnectAll", userId, "")
+}
+
+func (r *SessionRedisRepository) DisconnectAllExcept(ctx context.Context, userId, sessionId string) (int64, error) {
+	return r.disconnectAllExcept(ctx, "SessionRedisRepository.DisconnectAllExcept", userId, sessionId)
+}
+
+func (r *SessionRedisRepository) disconnectAllExcept(ctx context.Context, name, userId, keep string) (deleted int64, err error) {
+	ctx, span := startSpan(ctx, name, "DEL")
+	defer func() { endSpan(span, err) }()
+	ids, err := r.redis.SMembers(ctx, userSessionsKey(userId)).Result()
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	var members []any
+	for _, id := range ids {
+		if id != keep {
+			keys = append(keys, sessionKey(id))
+			members = append(members, id)
+		}
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	pipe := r.redis.TxPipeline()
+	del := pipe.Del(ctx, keys...)
+	pipe.SRem(ctx, userSessionsKey(userId), members...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	// ids of evicted sessions are in the set too, DEL only counts live ones
+	return del.Val(), nil
+}
+
+// DeleteExpired is a no-op, redis evicts sessions on its own once their TTL passes.
+func (r *SessionRedisRepository) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
+func (r *SessionRedisRepository) load(ctx context.Context, id string) (*entities.Session, error) {
+	raw, err := r.redis.Get(ctx, sessionKey(id)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	var session entities.Session
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// update changes a stored session with change. A session disconnected after
+// it was read stays gone, like with an UPDATE of the row in Postgres.
+func (r *SessionRedisRepository) update(ctx context.Context, id string, change func(stored *entities.Session)) error {
+	stored, err := r.load(ctx, id)
+	if err != nil {
+		return ignoreMissing(err)
+	}
+	change(stored)
+	return r.save(ctx, stored, "XX")
+}
+
+// save writes the session with its expiry when condition, NX or XX, holds and
+// then keeps the user's index alive at least as long as the session.
+func (r *SessionRedisRepository) save(ctx context.Context, session *entities.Session, condition string) error {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(session.ValidUntil).Milliseconds()
+	return saveScript.Run(ctx, r.redis, []string{sessionKey(session.Id), userSessionsKey(session.UserId)}, raw, ttl, condition, session.Id).Err()
+}
+
+// saveScript sets KEYS[1] to ARGV[1] for ARGV[2] milliseconds if the ARGV[3]
+// condition holds, then adds ARGV[4] to the KEYS[2] index, extending its TTL
+// unless it already lives longer. A session expiring right away is deleted.
+var saveScript = redis.NewScript(`
+if tonumber(ARGV[2]) <= 0 then
+	redis.call("DEL", KEYS[1])
+	redis.call("SREM", KEYS[2], ARGV[4])
+	return 0
+end
+if not redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2], ARGV[3]) then
+	return 0
+end
+redis.call("SADD", KEYS[2], ARGV[4])
+if redis.call("PTTL", KEYS[2]) < tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[2], ARGV[2])
+end
+return 1`)
+
+func ignoreMissing(err error) error {
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+package repositories
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+
+	"github.com/redis/go-redis/v9"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func startSpan(ctx context.Context, name, operation string) (context.Context, trace.Span) {
+	return telemetry.StartClientSpan(ctx, name,
+		semconv.DBSystemRedis,
+		semconv.DBOperation(operation),
+	)
+}
+
+// endSpan ends the span, not flagging redis.Nil and ports.ErrCacheMiss as
+// failures since a missing key is an expected outcome for lookups.
+func endSpan(span trace.Span, err error) {
+	if err == redis.Nil || err == ports.ErrCacheMiss {
+		err = nil
+	}
+	telemetry.EndSpan(span, err)
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmjp/gopasswordless/internal/adapters/audit"
+	"github.com/jmjp/gopasswordless/internal/adapters/geolocation"
+	"github.com/jmjp/gopasswordless/internal/adapters/notifier"
+	cachedRepositories "github.com/jmjp/gopasswordless/internal/adapters/repositories/cached"
+	repositories "github.com/jmjp/gopasswordless/internal/adapters/repositories/pg"
+	redisRepositories "github.com/jmjp/gopasswordless/internal/adapters/repositories/redis"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/core/services"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/scheduler"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// janitorTimeout bounds a purge run and the lock held for it.
+const janitorTimeout = 5 * time.Minute
+
+// App wires the connections, repositories and services shared by the HTTP
+// server and the administrative commands.
+type App struct {
+	Config *config.Config
+	DB     *sql.DB
+	Redis  *redis.Client
+	Keys   *token.Keyring
+
+	UserRepository      ports.UserRepository
+	MagicLinkRepository ports.MagicLinkRepository
+	SessionRepository   ports.SessionRepository
+	GeoLocator          ports.GeoLocator
+	// Denylist holds the access tokens revoked before they expire.
+	Denylist ports.TokenDenylist
+
+	AuthService  *services.AuthService
+	UserService  *services.UserService
+	PurgeService *services.PurgeService
+
+	// Activity batches the writes of session refreshes; only the server runs it.
+	Activity *services.ActivityRecorder
+	// Scheduler runs the background jobs; only the server starts it.
+	Scheduler *scheduler.Scheduler
+}
+
+// New connects to Postgres and Redis, checking both are reachable, and builds the services.
+func New(ctx context.Context, cfg *config.Config) (*App, error) {
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	opt, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("parsing redis_url: %w", err)
+	}
+	client := redis.NewClient(opt)
+	if err := client.Ping(ctx).Err(); err != nil {
+		db.Close()
+		client.Close()
+		return nil, fmt.Errorf("connecting to redis: %w", err)
+	}
+	keys, err := openKeyring(cfg)
+	if err != nil {
+		db.Close()
+		client.Close()
+		return nil, err
+	}
+
+	a := &App{Config: cfg, DB: db, Redis: client, Keys: keys}
+	a.UserRepository = repositories.NewUserPostgresRepository(db)
+	if cfg.MagicLinkStore == "redis" {
+		a.MagicLinkRepository = redisRepositories.NewMagicLinkRedisRepository(client)
+	} else {
+		a.MagicLinkRepository = repositories.NewMagicLinkPostgresRepository(db)
+	}
+	if cfg.SessionStore == "redis" {
+		a.SessionRepository = redisRepositories.NewSessionRedisRepository(client)
+	} else {
+		a.SessionRepository = repositories.NewSessionPostgresRepository(db)
+	}
+	if cfg.CacheRepositories {
+		cache := redisRepositories.NewRedisCacheRepository(client)
+		a.UserRepository = cachedRepositories.NewUserCachedRepository(a.UserRepository, cache, cfg.UserCacheTTL)
+		if cfg.SessionStore != "redis" {
+			a.SessionRepository = cachedRepositories.NewSessionCachedRepository(a.SessionRepository, cache)
+		}
+	}
+
+	a.Denylist = cachedRepositories.NewTokenDenylistCachedRepository(
+		redisRepositories.NewTokenDenylistRedisRepository(client, cfg.AccessTokenTTL),
+		cfg.TokenDenylistCacheSize, cfg.TokenDenylistCacheTTL,
+	)
+
+	a.GeoLocator, err = newGeoLocator(cfg, client)
+	if err != nil {
+		db.Close()
+		client.Close()
+		return nil, err
+	}
+
+	var notifications ports.Notifier = notifier.NewLogNotifier()
+	if cfg.SMTPURL != "" {
+		notifications, err = notifier.NewSMTPNotifier(cfg.SMTPURL, cfg.MailFrom)
+		if err != nil {
+			db.Close()
+			client.Close()
+			return nil, fmt.Errorf("smtp_url: %w", err)
+		}
+	}
+	a.Activity = services.NewActivityRecorder(a.SessionRepository, cfg.SessionActivityInterval)
+	authOptions := []services.AuthOption{
+		services.WithNotifier(notifications, redisRepositories.NewRedisCacheRepository(client)),
+		services.WithActivity(a.Activity),
+		services.WithAudit(audit.NewLogAuditLog()),
+		services.WithDenylist(a.Denylist),
+	}
+	if cfg.RiskEnabled() {
+		authOptions = append(authOptions, services.WithRisk(services.NewRiskEngine(services.RiskPolicy{
+			NotifyScore: cfg.RiskNotifyScore,
+			StepUpScore: cfg.RiskStepUpScore,
+			BlockScore:  cfg.RiskBlockScore,
+			MaxSpeed:    float64(cfg.RiskMaxSpeed),
+			History:     cfg.RiskHistory,
+		})))
+	}
+	a.AuthService = services.NewAuthService(cfg, keys, a.UserRepository, a.MagicLinkRepository, a.SessionRepository, a.GeoLocator, authOptions...)
+	a.UserService = services.NewUserService(a.UserRepository, a.Denylist)
+	a.PurgeService = services.NewPurgeService(a.MagicLinkRepository, a.SessionRepository)
+	a.Scheduler = newScheduler(a)
+	return a, nil
+}
+
+func newScheduler(a *App) *scheduler.Scheduler {
+	var locker scheduler.Locker = scheduler.NewRedisLocker(a.Redis)
+	if a.Config.JanitorLock == "postgres" {
+		locker = scheduler.NewPostgresLocker(a.DB)
+	}
+	s := scheduler.NewScheduler(locker)
+	s.Register(&scheduler.Job{
+		Name:     "purge_expired",
+		Interval: a.Config.JanitorInterval,
+		Timeout:  janitorTimeout,
+		Run: func(ctx context.Context) (any, error) {
+			return a.PurgeService.PurgeExpired(ctx, time.Now().Add(-a.Config.JanitorGrace))
+		},
+	})
+	return s
+}
+
+func (a *App) Close() error {
+	return errors.Join(a.DB.Close(), a.Redis.Close())
+}
+
+// newGeoLocator returns the locator selected by geoip_provider, nil when disabled.
+func newGeoLocator(cfg *config.Config, client *redis.Client) (ports.GeoLocator, error) {
+	switch cfg.GeoIPProvider {
+	case "mmdb":
+		locator, err := geolocation.NewMMDBLocator(cfg.GeoIPFile, cfg.GeoIPASNFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading geoip_file: %w", err)
+		}
+		return locator, nil
+	case "http":
+		cache := redisRepositories.NewRedisCacheRepository(client)
+		return geolocation.NewCachedLocator(geolocation.NewHTTPLocator(cfg.GeoIPTimeout), cache, cfg.GeoIPCacheTTL), nil
+	}
+	return nil, nil
+}
+
+func openKeyring(cfg *config.Config) (*token.Keyring, error) {
+	if cfg.TokenKeysFile == "" {
+		return token.NewStaticKeyring(cfg.TokenSecret), nil
+	}
+	keys, err := token.OpenKeyring(cfg.TokenKeysFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading token keys: %w", err)
+	}
+	return keys, nil
+}
@@ -15,15 +15,15 @@ type MagicLink struct {
 
 // NewMagicLink creates a new MagicLink object.
 //
-// It takes four parameters: token (string), userId (string), cookieToken (string), and validUntil (time.Time).
+// It takes four parameters: userId (string), Code (string), Cookie (string), and validUntil (time.Time).
 //
-// It returns a pointer to a MagicLink object and an error.
-func NewMagicLink(userId, Code, Cookie string) *MagicLink {
+// It returns a pointer to a MagicLink object.
+func NewMagicLink(userId, Code, Cookie string, validUntil time.Time) *MagicLink {
 	return &MagicLink{
 		UserId:     userId,
 		Code:       Code,
 		Cookie:     Cookie,
-		ValidUntil: time.Now().Add(time.Minute * 5),
+		ValidUntil: validUntil,
 		Used:       false,
 	}
 }
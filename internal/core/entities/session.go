@@ -16,6 +16,14 @@ type Session struct {
 	Region           *string   `json:"region" bson:"state"`
 	Country          *string   `json:"country" bson:"country"`
 	OrganizationName *string   `json:"organization_name" bson:"organization_name"`
+	Browser          string    `json:"browser" bson:"browser"`
+	BrowserVersion   string    `json:"browser_version" bson:"browser_version"`
+	OS               string    `json:"os" bson:"os"`
+	DeviceType       string    `json:"device_type" bson:"device_type"`
+	DeviceLabel      string    `json:"device_label" bson:"device_label"`
+	LastUsedAt       time.Time `json:"last_used_at" bson:"last_used_at"`
+	LastIp           *string   `json:"last_ip" bson:"last_ip"`
+	RefreshCount     int64     `json:"refresh_count" bson:"refresh_count"`
 	CreatedAt        time.Time `json:"created_at" bson:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at" bson:"updated_at"`
 }
@@ -35,7 +43,12 @@ func NewSession(userId string, validUntil time.Time, userAgent *string) *Session
 // No parameters.
 // Returns a boolean.
 func (s *Session) IsExpired() bool {
-	return s.ValidUntil.Before(time.Now())
+	return s.IsExpiredAt(time.Now())
+}
+
+// IsExpiredAt checks if the session is expired at the given time.
+func (s *Session) IsExpiredAt(now time.Time) bool {
+	return s.ValidUntil.Before(now)
 }
 
 func (s *Session) UpdateLocation(latitude, longitude *float64, ip, city, region, country, organizationName *string) {
@@ -47,3 +60,23 @@ func (s *Session) UpdateLocation(latitude, longitude *float64, ip, city, region,
 	s.OrganizationName = organizationName
 	s.Ip = ip
 }
+
+// Touch records that the session was used at usedAt from ip, refreshes more
+// times. An empty ip keeps the last known one.
+func (s *Session) Touch(usedAt time.Time, ip string, refreshes int64) {
+	if usedAt.After(s.LastUsedAt) {
+		s.LastUsedAt = usedAt
+	}
+	if ip != "" {
+		s.LastIp = &ip
+	}
+	s.RefreshCount += refreshes
+}
+
+func (s *Session) UpdateDevice(browser, browserVersion, os, deviceType, deviceLabel string) {
+	s.Browser = browser
+	s.BrowserVersion = browserVersion
+	s.OS = os
+	s.DeviceType = deviceType
+	s.DeviceLabel = deviceLabel
+}
@@ -34,9 +34,22 @@ func NewUser(email string, avatar, username *string) (*User, error) {
 	}
 	return user, nil
 }
+
+// Block prevents the user from signing in or refreshing sessions.
+func (user *User) Block() {
+	user.Blocked = true
+	user.UpdatedAt = time.Now()
+}
+
+func (user *User) Unblock() {
+	user.Blocked = false
+	user.UpdatedAt = time.Now()
+}
+
 func (user *User) isValid() error {
 	usernamePattern := `^[a-zA-Z0-9_-]+$`
-	emailPattern := `^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`
+	// internationalized domains are stored in punycode, top-level ones included
+	emailPattern := `^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.([a-zA-Z]{2,}|xn--[a-zA-Z0-9\-]+)$`
 
 	usernameMatch, _ := regexp.MatchString(usernamePattern, user.Username)
 	if !usernameMatch {
@@ -0,0 +1,57 @@
+// Package errs holds the errors the application reports to its clients. Each
+// one has a stable code for programs, the HTTP status it is answered with and
+// a message meant for people; the cause, when there is one, is only logged.
+package errs
+
+import (
+	"errors"
+	"net/http"
+)
+
+type Error struct {
+	Code    string
+	Status  int
+	Message string
+	Cause   error
+}
+
+func New(code string, status int, message string) *Error {
+	return &Error{Code: code, Status: status, Message: message}
+}
+
+// Internal is what clients get for the errors that aren't an *Error.
+var Internal = New("internal_error", http.StatusInternalServerError, "something went wrong, please try again later")
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is matches the errors of the same code, so wrapped copies still match the
+// error they were made from.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Cause = err
+	return &wrapped
+}
+
+// From returns the *Error in the chain of err, or Internal caused by err.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Internal.Wrap(err)
+}
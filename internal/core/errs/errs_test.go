@@ -0,0 +1,35 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestWrapKeepsCode(t *testing.T) {
+	errNotFound := New("thing_not_found", http.StatusNotFound, "no thing found")
+	cause := errors.New("no rows")
+	err := fmt.Errorf("finding: %w", errNotFound.Wrap(cause))
+
+	if !errors.Is(err, errNotFound) {
+		t.Fatalf("errors.Is(%v, errNotFound) = false", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Fatalf("errors.Is(%v, cause) = false", err)
+	}
+	if errNotFound.Cause != nil {
+		t.Fatal("Wrap changed the original error")
+	}
+	if got := From(err); got.Code != "thing_not_found" || got.Status != http.StatusNotFound {
+		t.Fatalf("From() = %+v", got)
+	}
+}
+
+func TestFromUnknownError(t *testing.T) {
+	cause := errors.New("connection refused")
+	got := From(cause)
+	if got.Code != Internal.Code || got.Status != http.StatusInternalServerError || !errors.Is(got, cause) {
+		t.Fatalf("From() = %+v, want Internal caused by the error", got)
+	}
+}
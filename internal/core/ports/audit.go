@@ -0,0 +1,11 @@
+package ports
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+)
+
+// AuditLog keeps track of the security relevant operations on accounts.
+type AuditLog interface {
+	Record(ctx context.Context, event *dtos.AuditEventDTO) error
+}
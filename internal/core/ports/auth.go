@@ -1,30 +1,49 @@
 package ports
 
 import (
-	"hyperzoop/internal/core/entities"
-	"hyperzoop/internal/infra/dtos"
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"time"
 )
 
 type AuthService interface {
-	Login(input dtos.LoginInputDTO) (*dtos.LoginOutputDTO, error)
-	Refresh(refresh string) (out *dtos.RefreshOutputDTO, err error)
-	Revoke(sessionId, loggedUser string) error
-	Verify(code, cookie, ip, ua string) (*dtos.VerifyOutputDTO, error)
-	Sessions(userID, currentToken string) ([]*dtos.SessionsOutput, error)
+	Login(ctx context.Context, input dtos.LoginInputDTO) (*dtos.LoginOutputDTO, error)
+	Refresh(ctx context.Context, refresh, ip, ua string) (out *dtos.RefreshOutputDTO, err error)
+	Revoke(ctx context.Context, sessionId, loggedUser string) error
+	RevokeOthers(ctx context.Context, userId, currentSessionId string) (*dtos.RevokeOutputDTO, error)
+	RevokeAll(ctx context.Context, userId string, actor dtos.ActorDTO) (*dtos.RevokeOutputDTO, error)
+	Verify(ctx context.Context, code, cookie, ip, ua string) (*dtos.VerifyOutputDTO, error)
+	Sessions(ctx context.Context, userID, currentToken string) ([]*dtos.SessionsOutput, error)
+	RejectSession(ctx context.Context, code string) error
+	Introspect(ctx context.Context, token string) (*dtos.IntrospectionOutputDTO, error)
+	RevokeToken(ctx context.Context, token, clientId string) error
 }
 
 type SessionRepository interface {
-	Create(session *entities.Session) (*entities.Session, error)
-	All(userId string) ([]*entities.Session, error)
-	One(id string) (*entities.Session, error)
-	UpdateGeoLocation(session *entities.Session) error
-	Update(session *entities.Session) error
-	Disconnect(sessionId string) error
+	Create(ctx context.Context, session *entities.Session) (*entities.Session, error)
+	All(ctx context.Context, userId string) ([]*entities.Session, error)
+	One(ctx context.Context, id string) (*entities.Session, error)
+	UpdateGeoLocation(ctx context.Context, session *entities.Session) error
+	Update(ctx context.Context, session *entities.Session) error
+	// Touch adds refreshes to the refresh count of the session and records its
+	// last use, at usedAt from ip. Missing sessions are ignored.
+	Touch(ctx context.Context, sessionId string, usedAt time.Time, ip string, refreshes int64) error
+	Disconnect(ctx context.Context, sessionId string) error
+	// DisconnectAll removes every session of the user and returns how many there were.
+	DisconnectAll(ctx context.Context, userId string) (int64, error)
+	// DisconnectAllExcept removes every session of the user but sessionId.
+	DisconnectAllExcept(ctx context.Context, userId, sessionId string) (int64, error)
+	DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error)
 }
 
 type MagicLinkRepository interface {
-	Create(link *entities.MagicLink) error
-	FindValidByCode(code, cookie string) (*entities.MagicLink, error)
-	Invalidate(code string) error
-	Update(link *entities.MagicLink) error
+	Create(ctx context.Context, link *entities.MagicLink) error
+	FindValidByCode(ctx context.Context, code, cookie string) (*entities.MagicLink, error)
+	// Consume finds a valid link like FindValidByCode and marks it used in the
+	// same step, so concurrent calls with the same code succeed only once.
+	Consume(ctx context.Context, code, cookie string) (*entities.MagicLink, error)
+	Invalidate(ctx context.Context, code string) error
+	Update(ctx context.Context, link *entities.MagicLink) error
+	DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error)
 }
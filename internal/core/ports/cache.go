@@ -1,9 +1,19 @@
 package ports
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrCacheMiss is returned by RedisCacheRepository.Get and Take for missing or expired keys.
+var ErrCacheMiss = errors.New("cache miss")
 
 type RedisCacheRepository interface {
-	Set(key string, value string, expiration time.Duration) error
-	Get(key string) (string, error)
-	Invalidate(key string) error
+	Set(ctx context.Context, key string, value string, expiration time.Duration) error
+	Get(ctx context.Context, key string) (string, error)
+	// Take gets the value and deletes the key in the same step, so only one
+	// of concurrent callers gets it.
+	Take(ctx context.Context, key string) (string, error)
+	Invalidate(ctx context.Context, key string) error
 }
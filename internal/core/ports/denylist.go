@@ -0,0 +1,20 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+// TokenDenylist keeps the access tokens revoked before they expire. Entries
+// only need to outlive the access token TTL.
+type TokenDenylist interface {
+	// RevokeToken denies the access token with the given id.
+	RevokeToken(ctx context.Context, tokenId string) error
+	// RevokeSessions denies the access tokens issued for the sessions.
+	RevokeSessions(ctx context.Context, sessionIds ...string) error
+	// RevokeUser denies the access tokens issued to the user until at.
+	RevokeUser(ctx context.Context, userId string, at time.Time) error
+	// IsRevoked reports whether a token with these claims was revoked. Empty
+	// ids are not checked.
+	IsRevoked(ctx context.Context, tokenId, sessionId, userId string, issuedAt time.Time) (bool, error)
+}
@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+)
+
+// GeoLocator finds where an IP address is. It returns a nil location without
+// error when the address is unknown.
+type GeoLocator interface {
+	Locate(ctx context.Context, ip string) (*dtos.GeoLocationOutputDTO, error)
+}
@@ -0,0 +1,21 @@
+package ports
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+)
+
+// Notifier tells users about security events on their account.
+type Notifier interface {
+	// RiskDetected warns the user about a suspicious session that was let through.
+	RiskDetected(ctx context.Context, user *entities.User, session *entities.Session, risk *dtos.RiskAssessmentDTO) error
+	// StepUpRequired sends the link that confirms a sign-in held back as suspicious.
+	StepUpRequired(ctx context.Context, user *entities.User, link *dtos.LoginOutputDTO) error
+	// NewDevice reports a sign-in from a new browser or country, with a link
+	// revoking the session if the user doesn't recognize it.
+	NewDevice(ctx context.Context, user *entities.User, session *entities.Session, notMeLink string) error
+	// SessionsRevoked confirms that revoked sessions of the user were signed
+	// out, everywhere or everywhere but the current device.
+	SessionsRevoked(ctx context.Context, user *entities.User, revoked int64, everywhere bool) error
+}
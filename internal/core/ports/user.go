@@ -1,10 +1,22 @@
 package ports
 
-import "hyperzoop/internal/core/entities"
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+)
 
 type UserRepository interface {
-	Create(user *entities.User) (*entities.User, error)
-	FindByEmail(email string) (*entities.User, error)
-	FindById(id string) (*entities.User, error)
-	FindUserBySliceIds(ids []string) ([]*entities.User, error)
+	Create(ctx context.Context, user *entities.User) (*entities.User, error)
+	FindByEmail(ctx context.Context, email string) (*entities.User, error)
+	FindById(ctx context.Context, id string) (*entities.User, error)
+	FindUserBySliceIds(ctx context.Context, ids []string) ([]*entities.User, error)
+	Update(ctx context.Context, user *entities.User) error
+}
+
+type UserService interface {
+	Create(ctx context.Context, input dtos.LoginInputDTO) (*entities.User, error)
+	Find(ctx context.Context, idOrEmail string) (*entities.User, error)
+	Block(ctx context.Context, idOrEmail string) (*entities.User, error)
+	Unblock(ctx context.Context, idOrEmail string) (*entities.User, error)
 }
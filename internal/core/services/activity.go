@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// sessionActivity is the use of a session not written yet.
+type sessionActivity struct {
+	usedAt    time.Time
+	ip        string
+	refreshes int64
+}
+
+func (a *sessionActivity) merge(other *sessionActivity) {
+	if other.usedAt.After(a.usedAt) {
+		a.usedAt = other.usedAt
+		if other.ip != "" {
+			a.ip = other.ip
+		}
+	}
+	a.refreshes += other.refreshes
+}
+
+// ActivityRecorder coalesces the refreshes of sessions in memory and writes
+// them every interval, so a busy client costs one write per interval instead
+// of one per refresh.
+type ActivityRecorder struct {
+	sessionRepository ports.SessionRepository
+	interval          time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*sessionActivity
+}
+
+func NewActivityRecorder(sessionRepository ports.SessionRepository, interval time.Duration) *ActivityRecorder {
+	return &ActivityRecorder{
+		sessionRepository: sessionRepository,
+		interval:          interval,
+		pending:           make(map[string]*sessionActivity),
+	}
+}
+
+// Record counts a refresh of the session at usedAt from ip.
+func (r *ActivityRecorder) Record(sessionId, ip string, usedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(sessionId, &sessionActivity{usedAt: usedAt, ip: ip, refreshes: 1})
+}
+
+func (r *ActivityRecorder) add(sessionId string, activity *sessionActivity) {
+	if pending, ok := r.pending[sessionId]; ok {
+		pending.merge(activity)
+		return
+	}
+	r.pending[sessionId] = activity
+}
+
+// Apply adds the activity not written yet to session, so this replica shows
+// it up to date.
+func (r *ActivityRecorder) Apply(session *entities.Session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if pending, ok := r.pending[session.Id]; ok {
+		session.Touch(pending.usedAt, pending.ip, pending.refreshes)
+	}
+}
+
+// Flush writes the pending activity. Sessions that fail are kept for the next flush.
+func (r *ActivityRecorder) Flush(ctx context.Context) (written int, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "ActivityRecorder.Flush")
+	defer func() {
+		span.SetAttributes(attribute.Int("sessions", written))
+		telemetry.EndSpan(span, err)
+	}()
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]*sessionActivity)
+	r.mu.Unlock()
+
+	var errs []error
+	for sessionId, activity := range pending {
+		if err := r.sessionRepository.Touch(ctx, sessionId, activity.usedAt, activity.ip, activity.refreshes); err != nil {
+			errs = append(errs, err)
+			r.mu.Lock()
+			r.add(sessionId, activity)
+			r.mu.Unlock()
+			continue
+		}
+		written++
+	}
+	return written, errors.Join(errs...)
+}
+
+// Run flushes every interval until ctx is done.
+func (r *ActivityRecorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			flushCtx, cancel := context.WithTimeout(ctx, backgroundTimeout)
+			if _, err := r.Flush(flushCtx); err != nil {
+				zap.L().Error("error writing session activity", zap.Error(err))
+			}
+			cancel()
+		}
+	}
+}
@@ -1,18 +1,27 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
-	"errors"
 	"fmt"
-	"hyperzoop/internal/core/entities"
-	"hyperzoop/internal/core/ports"
-	"hyperzoop/internal/infra/dtos"
-	"hyperzoop/internal/infra/iplocation"
-	"hyperzoop/internal/infra/token"
-	"os"
-	"strconv"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/errs"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"github.com/jmjp/gopasswordless/internal/infra/useragent"
+	"github.com/jmjp/gopasswordless/internal/infra/validation"
+	"io"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -20,84 +29,208 @@ import (
 )
 
 type AuthService struct {
+	config            *config.Config
+	keys              *token.Keyring
 	userRepository    ports.UserRepository
 	magicRepository   ports.MagicLinkRepository
 	sessionRepository ports.SessionRepository
+	geoLocator        ports.GeoLocator
+	clock             clock.Clock
+	random            io.Reader
+	risk              *RiskEngine
+	notifier          ports.Notifier
+	cache             ports.RedisCacheRepository
+	activity          *ActivityRecorder
+	audit             ports.AuditLog
+	denylist          ports.TokenDenylist
+}
+
+// AuthOption overrides a default dependency of the AuthService.
+type AuthOption func(*AuthService)
+
+// WithClock replaces the wall clock used for expirations.
+func WithClock(clock clock.Clock) AuthOption {
+	return func(u *AuthService) { u.clock = clock }
+}
+
+// WithRandom replaces crypto/rand as the source of link codes and fingerprints.
+func WithRandom(random io.Reader) AuthOption {
+	return func(u *AuthService) { u.random = random }
+}
+
+// WithNotifier tells users about sign-ins from new devices and, with WithRisk,
+// about risky ones. The cache remembers the links sent along and the sessions
+// users were already warned about.
+func WithNotifier(notifier ports.Notifier, cache ports.RedisCacheRepository) AuthOption {
+	return func(u *AuthService) {
+		u.notifier = notifier
+		u.cache = cache
+	}
+}
+
+// WithRisk evaluates every sign-in and refresh with the risk engine. Users are
+// warned and asked to confirm sign-ins through WithNotifier; without it, risky
+// sign-ins are only logged and those needing a confirmation are refused.
+func WithRisk(engine *RiskEngine) AuthOption {
+	return func(u *AuthService) { u.risk = engine }
+}
+
+// WithActivity records the last use of sessions on every refresh.
+func WithActivity(recorder *ActivityRecorder) AuthOption {
+	return func(u *AuthService) { u.activity = recorder }
+}
+
+// WithAudit records session revocations in the audit log.
+func WithAudit(audit ports.AuditLog) AuthOption {
+	return func(u *AuthService) { u.audit = audit }
+}
+
+// WithDenylist revokes the access tokens of disconnected sessions at once
+// instead of letting them live until they expire.
+func WithDenylist(denylist ports.TokenDenylist) AuthOption {
+	return func(u *AuthService) { u.denylist = denylist }
 }
 
 func NewAuthService(
+	config *config.Config,
+	keys *token.Keyring,
 	userRepository ports.UserRepository,
 	magicRepository ports.MagicLinkRepository,
 	sessionRepository ports.SessionRepository,
+	geoLocator ports.GeoLocator,
+	opts ...AuthOption,
 ) *AuthService {
-	return &AuthService{
+	u := &AuthService{
+		config:            config,
+		keys:              keys,
 		userRepository:    userRepository,
 		magicRepository:   magicRepository,
 		sessionRepository: sessionRepository,
+		geoLocator:        geoLocator,
+		clock:             clock.System,
+		random:            rand.Reader,
 	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
 }
 
+// backgroundTimeout bounds the writes that keep running after the response has
+// been sent, so they can't hold a graceful shutdown on a stuck query.
+const backgroundTimeout = 10 * time.Second
+
 var (
-	errCreateUser               = errors.New("error creating user, please verify your email and try again")
-	errInvalidCodeOrFingerprint = errors.New("verification code is invalid or fingerprint is missing")
-	errNoCodeFounded            = errors.New("no magic link found, please login again")
-	errUserNotFound             = errors.New("user not found")
-	errSessionNotFound          = errors.New("session not found or already expired")
-	errUnauthorized             = errors.New("you are not authorized to perform this action")
+	errCreateUser               = errs.New("user_not_created", http.StatusBadRequest, "error creating user, please verify your email and try again")
+	errInvalidCodeOrFingerprint = errs.New("invalid_link", http.StatusBadRequest, "verification code is invalid or fingerprint is missing")
+	errNoCodeFounded            = errs.New("link_not_found", http.StatusNotFound, "no magic link found, please login again")
+	errUserNotFound             = errs.New("user_not_found", http.StatusNotFound, "user not found")
+	errUserBlocked              = errs.New("user_blocked", http.StatusForbidden, "this user is blocked")
+	errSessionNotFound          = errs.New("session_not_found", http.StatusNotFound, "session not found or already expired")
+	// errSessionExpired is errSessionNotFound for the session of the caller,
+	// whose refresh token is no longer valid.
+	errSessionExpired   = errs.New("session_expired", http.StatusUnauthorized, "session not found or already expired")
+	errUnauthorized     = errs.New("forbidden", http.StatusForbidden, "you are not authorized to perform this action")
+	errRiskBlocked      = errs.New("sign_in_blocked", http.StatusForbidden, "sign-in blocked because it looks suspicious")
+	errReauthenticate   = errs.New("reauthentication_required", http.StatusUnauthorized, "please sign in again to confirm it's you")
+	errLinksPaused      = errs.New("links_paused", http.StatusTooManyRequests, "sign-in links are paused after a session was reported, please try again later")
+	errNotMeLinkExpired = errs.New("link_expired", http.StatusGone, "this link has expired or was already used")
 )
 
-func (u *AuthService) Login(input dtos.LoginInputDTO) (*dtos.LoginOutputDTO, error) {
+// invalidUser reports the rule of entities.User a new user broke.
+func invalidUser(err error) error {
+	return errs.New("invalid_user", http.StatusUnprocessableEntity, err.Error())
+}
+
+func (u *AuthService) Login(ctx context.Context, input dtos.LoginInputDTO) (out *dtos.LoginOutputDTO, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.Login")
+	defer func() { telemetry.EndSpan(span, err) }()
 	zap.L().Info("login request", zap.String("email", input.Email))
-	user, err := u.userRepository.FindByEmail(input.Email)
+	if err := validation.Struct(&input); err != nil {
+		return nil, err
+	}
+	user, err := u.userRepository.FindByEmail(ctx, input.Email)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return nil, err
 		}
 		userEntity, err := entities.NewUser(input.Email, input.Avatar, input.Username)
 		if err != nil {
-			return nil, err
+			return nil, invalidUser(err)
 		}
-		user, err = u.userRepository.Create(userEntity)
+		user, err = u.userRepository.Create(ctx, userEntity)
 		if err != nil {
 			return nil, errCreateUser
 		}
 	}
+	if u.linksPaused(ctx, user) {
+		return nil, errLinksPaused
+	}
+	return u.issueLink(ctx, user)
+}
+
+// IssueLink creates a magic link for an existing user without sending it, for
+// support cases where an operator hands it over. The user must present the
+// returned cookie as the _fingerprint cookie when opening the link.
+func (u *AuthService) IssueLink(ctx context.Context, email string) (out *dtos.LoginOutputDTO, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.IssueLink")
+	defer func() { telemetry.EndSpan(span, err) }()
+	zap.L().Info("issue link request", zap.String("email", email))
+	email, err = validation.NormalizeEmail(email)
+	if err != nil {
+		return nil, validation.Errors{{Field: "email", Rule: "email", Message: err.Error()}}
+	}
+	user, err := u.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errUserNotFound
+		}
+		return nil, err
+	}
+	return u.issueLink(ctx, user)
+}
 
+func (u *AuthService) issueLink(ctx context.Context, user *entities.User) (*dtos.LoginOutputDTO, error) {
 	if user.Blocked {
-		return nil, fmt.Errorf("user %s is blocked", user.Username)
+		return nil, errUserBlocked
 	}
 
-	code, fingerprint, err := generateHashedCodes()
+	code, fingerprint, err := generateHashedCodes(u.random)
 	if err != nil {
 		zap.L().Error("error generating code", zap.Error(err))
 		return nil, err
 	}
 
-	if err := u.magicRepository.Create(entities.NewMagicLink(user.ID, *code, *fingerprint)); err != nil {
+	link := entities.NewMagicLink(user.ID, *code, *fingerprint, u.clock.Now().Add(u.config.MagicLinkTTL))
+	if err := u.magicRepository.Create(ctx, link); err != nil {
 		zap.L().Error("error creating magic link", zap.Error(err))
+		return nil, err
 	}
 
 	return &dtos.LoginOutputDTO{
 		Message:   fmt.Sprintf("magic link sent to %s", user.Email),
-		Link:      fmt.Sprintf("%s/auth/verify?code=%s", os.Getenv("verify_host"), *code),
+		Link:      fmt.Sprintf("%s/auth/verify?code=%s", u.config.VerifyHost, *code),
 		Cookie:    fingerprint,
-		ExpiresIn: time.Now().Add(time.Minute * 15),
+		ExpiresIn: link.ValidUntil,
 	}, nil
 }
 
-func (u *AuthService) Refresh(refresh string) (out *dtos.RefreshOutputDTO, err error) {
+func (u *AuthService) Refresh(ctx context.Context, refresh, ip, ua string) (out *dtos.RefreshOutputDTO, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.Refresh")
+	defer func() { telemetry.EndSpan(span, err) }()
 	zap.L().Info("refresh request", zap.String("refresh", refresh))
-	session, err := u.sessionRepository.One(refresh)
+	session, err := u.sessionRepository.One(ctx, refresh)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errSessionNotFound
+			return nil, errSessionExpired
 		}
 		return
 	}
-	if session.IsExpired() {
-		return nil, errSessionNotFound
+	now := u.clock.Now()
+	if session.IsExpiredAt(now) {
+		return nil, errSessionExpired
 	}
-	user, err := u.userRepository.FindById(session.UserId)
+	user, err := u.userRepository.FindById(ctx, session.UserId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errUserNotFound
@@ -106,9 +239,15 @@ func (u *AuthService) Refresh(refresh string) (out *dtos.RefreshOutputDTO, err e
 		return
 	}
 	if user.Blocked {
-		return nil, errUnauthorized
+		return nil, errUserBlocked
+	}
+	if err := u.checkRefreshRisk(ctx, user, session, ip, ua, now); err != nil {
+		return nil, err
 	}
-	accessToken, err := generateAccessToken(user)
+	if u.activity != nil {
+		u.activity.Record(session.Id, ip, now)
+	}
+	accessToken, err := u.generateAccessToken(user, session.Id)
 	if err != nil {
 		return
 	}
@@ -116,23 +255,28 @@ func (u *AuthService) Refresh(refresh string) (out *dtos.RefreshOutputDTO, err e
 		AccessToken: accessToken,
 		User:        *user,
 	}
-	if session.ValidUntil.Add(time.Hour * 12).Before(time.Now()) {
-		session.ValidUntil = time.Now().Add(time.Hour * 24)
-		go func() {
-			err := u.sessionRepository.Update(session)
+	// extend the session once less than half of its lifetime remains
+	if session.ValidUntil.Sub(now) < u.config.SessionTTL/2 {
+		session.ValidUntil = now.Add(u.config.SessionTTL)
+		go func(ctx context.Context) {
+			ctx, cancel := detach(ctx)
+			defer cancel()
+			err := u.sessionRepository.Update(ctx, session)
 			if err != nil {
 				zap.L().Error("failed to update session", zap.Error(err))
 			}
-		}()
+		}(ctx)
 		out.RefreshToken = &session.Id
 		out.ExpiresIn = &session.ValidUntil
 	}
 	return
 }
 
-func (u *AuthService) Revoke(sessionId, loggedUser string) error {
+func (u *AuthService) Revoke(ctx context.Context, sessionId, loggedUser string) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.Revoke")
+	defer func() { telemetry.EndSpan(span, err) }()
 	zap.L().Info("revoke request", zap.String("session_id", sessionId), zap.String("logged_user", loggedUser))
-	session, err := u.sessionRepository.One(sessionId)
+	session, err := u.sessionRepository.One(ctx, sessionId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return errSessionNotFound
@@ -143,20 +287,183 @@ func (u *AuthService) Revoke(sessionId, loggedUser string) error {
 	if session.UserId != loggedUser {
 		return errUnauthorized
 	}
-	err = u.sessionRepository.Disconnect(sessionId)
+	err = u.sessionRepository.Disconnect(ctx, sessionId)
 	if err != nil {
 		zap.L().Error("error disconnecting session", zap.Error(err))
 		return err
 	}
+	if err := u.denySessions(ctx, sessionId); err != nil {
+		return err
+	}
+	u.recordAudit(ctx, &dtos.AuditEventDTO{Action: dtos.AuditSessionRevoked, Actor: dtos.ActorDTO{UserId: loggedUser}, UserId: session.UserId, SessionId: sessionId, Count: 1})
+	return nil
+}
+
+// RevokeOthers signs the user out of every session but the current one, which
+// must be theirs.
+func (u *AuthService) RevokeOthers(ctx context.Context, userId, currentSessionId string) (out *dtos.RevokeOutputDTO, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.RevokeOthers")
+	defer func() { telemetry.EndSpan(span, err) }()
+	zap.L().Info("revoke others request", zap.String("user_id", userId), zap.String("session_id", currentSessionId))
+	current, err := u.sessionRepository.One(ctx, currentSessionId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errSessionExpired
+		}
+		zap.L().Error("error finding session", zap.Error(err))
+		return nil, err
+	}
+	if current.UserId != userId || current.IsExpiredAt(u.clock.Now()) {
+		return nil, errUnauthorized
+	}
+	others, err := u.sessionIds(ctx, userId, currentSessionId)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := u.sessionRepository.DisconnectAllExcept(ctx, userId, currentSessionId)
+	if err != nil {
+		zap.L().Error("error disconnecting sessions", zap.Error(err))
+		return nil, err
+	}
+	if err := u.denySessions(ctx, others...); err != nil {
+		return nil, err
+	}
+	u.recordAudit(ctx, &dtos.AuditEventDTO{Action: dtos.AuditOtherSessionsRevoked, Actor: dtos.ActorDTO{UserId: userId}, UserId: userId, SessionId: currentSessionId, Count: revoked})
+	u.notifyRevoked(ctx, userId, revoked, false)
+	return &dtos.RevokeOutputDTO{Revoked: revoked}, nil
+}
+
+// RevokeAll signs the user out everywhere. Users may do it for themselves,
+// admins and the operator for anyone.
+func (u *AuthService) RevokeAll(ctx context.Context, userId string, actor dtos.ActorDTO) (out *dtos.RevokeOutputDTO, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.RevokeAll")
+	defer func() { telemetry.EndSpan(span, err) }()
+	zap.L().Info("revoke all request", zap.String("user_id", userId), zap.String("actor", actor.UserId), zap.Bool("operator", actor.Operator))
+	if err := u.authorize(ctx, actor, userId); err != nil {
+		return nil, err
+	}
+	sessions, err := u.sessionIds(ctx, userId, "")
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := u.sessionRepository.DisconnectAll(ctx, userId)
+	if err != nil {
+		zap.L().Error("error disconnecting sessions", zap.Error(err))
+		return nil, err
+	}
+	if err := u.denySessions(ctx, sessions...); err != nil {
+		return nil, err
+	}
+	u.recordAudit(ctx, &dtos.AuditEventDTO{Action: dtos.AuditAllSessionsRevoked, Actor: actor, UserId: userId, Count: revoked})
+	u.notifyRevoked(ctx, userId, revoked, true)
+	return &dtos.RevokeOutputDTO{Revoked: revoked}, nil
+}
+
+// sessionIds lists the ids of the user's sessions but except, so their access
+// tokens can be denied once they are disconnected.
+func (u *AuthService) sessionIds(ctx context.Context, userId, except string) ([]string, error) {
+	if u.denylist == nil {
+		return nil, nil
+	}
+	sessions, err := u.sessionRepository.All(ctx, userId)
+	if err != nil {
+		zap.L().Error("error finding sessions", zap.Error(err))
+		return nil, err
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		if session.Id != except {
+			ids = append(ids, session.Id)
+		}
+	}
+	return ids, nil
+}
+
+// denySessions revokes the access tokens issued for the sessions.
+func (u *AuthService) denySessions(ctx context.Context, sessionIds ...string) error {
+	if u.denylist == nil || len(sessionIds) == 0 {
+		return nil
+	}
+	if err := u.denylist.RevokeSessions(ctx, sessionIds...); err != nil {
+		zap.L().Error("error revoking access tokens", zap.Error(err), zap.Strings("session_ids", sessionIds))
+		return err
+	}
+	return nil
+}
+
+// authorize lets the actor manage the sessions of userId when they are the
+// operator, that user or an admin listed in admin_emails.
+func (u *AuthService) authorize(ctx context.Context, actor dtos.ActorDTO, userId string) error {
+	if actor.Operator || actor.UserId != "" && actor.UserId == userId {
+		return nil
+	}
+	if actor.UserId == "" {
+		return errUnauthorized
+	}
+	admin, err := u.userRepository.FindById(ctx, actor.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errUnauthorized
+		}
+		zap.L().Error("error finding user", zap.Error(err))
+		return err
+	}
+	if !u.isAdmin(admin) {
+		return errUnauthorized
+	}
 	return nil
 }
 
-func (u *AuthService) Verify(code, cookie, ip, ua string) (*dtos.VerifyOutputDTO, error) {
+// isAdmin reports whether the user is listed in admin_emails and not blocked.
+func (u *AuthService) isAdmin(user *entities.User) bool {
+	return !user.Blocked && slices.ContainsFunc(u.config.AdminEmails, func(email string) bool { return strings.EqualFold(email, user.Email) })
+}
+
+// scope lists the scopes granted to the tokens of the user.
+func (u *AuthService) scope(user *entities.User) string {
+	if u.isAdmin(user) {
+		return token.ScopeUser + " " + token.ScopeAdmin
+	}
+	return token.ScopeUser
+}
+
+func (u *AuthService) recordAudit(ctx context.Context, event *dtos.AuditEventDTO) {
+	if u.audit == nil {
+		return
+	}
+	event.At = u.clock.Now()
+	if err := u.audit.Record(ctx, event); err != nil {
+		zap.L().Error("error recording audit event", zap.Error(err), zap.String("action", event.Action))
+	}
+}
+
+// notifyRevoked tells the user how many of their sessions were signed out.
+func (u *AuthService) notifyRevoked(ctx context.Context, userId string, revoked int64, everywhere bool) {
+	if u.notifier == nil || revoked == 0 {
+		return
+	}
+	go func(ctx context.Context) {
+		ctx, cancel := detach(ctx)
+		defer cancel()
+		user, err := u.userRepository.FindById(ctx, userId)
+		if err != nil {
+			zap.L().Error("error finding user", zap.Error(err), zap.String("user_id", userId))
+			return
+		}
+		if err := u.notifier.SessionsRevoked(ctx, user, revoked, everywhere); err != nil {
+			zap.L().Error("error sending sessions revoked notification", zap.Error(err), zap.String("user_id", userId))
+		}
+	}(ctx)
+}
+
+func (u *AuthService) Verify(ctx context.Context, code, cookie, ip, ua string) (out *dtos.VerifyOutputDTO, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.Verify")
+	defer func() { telemetry.EndSpan(span, err) }()
 	zap.L().Info("verify request", zap.String("code", code), zap.String("cookie", cookie), zap.String("ip", ip), zap.String("ua", ua))
 	if code == "" || len(code) < 20 || cookie == "" || len(cookie) < 20 {
 		return nil, errInvalidCodeOrFingerprint
 	}
-	magic, err := u.magicRepository.FindValidByCode(code, cookie)
+	magic, err := u.magicRepository.Consume(ctx, code, cookie)
 	if err != nil {
 		zap.L().Error("error finding magic link", zap.Error(err))
 		if err != sql.ErrNoRows {
@@ -164,13 +471,7 @@ func (u *AuthService) Verify(code, cookie, ip, ua string) (*dtos.VerifyOutputDTO
 		}
 		return nil, errNoCodeFounded
 	}
-	go func() {
-		err := u.magicRepository.Update(magic.MarkAsUsed())
-		if err != nil {
-			zap.L().Error("error invalidating magic link", zap.Error(err))
-		}
-	}()
-	user, err := u.userRepository.FindById(magic.UserId)
+	user, err := u.userRepository.FindById(ctx, magic.UserId)
 	if err != nil {
 		zap.L().Error("error finding user", zap.Error(err))
 		if err == sql.ErrNoRows {
@@ -179,14 +480,48 @@ func (u *AuthService) Verify(code, cookie, ip, ua string) (*dtos.VerifyOutputDTO
 		return nil, err
 	}
 	if user.Blocked {
-		return nil, errUnauthorized
+		return nil, errUserBlocked
 	}
-	session, accessToken, err := u.createSessionAndAccessToken(user, ua)
+	now := u.clock.Now()
+	candidate := entities.NewSession(user.ID, now.Add(u.config.SessionTTL), &ua)
+	applyDevice(candidate, ua)
+	candidate.Touch(now, ip, 0)
+	var location *dtos.GeoLocationOutputDTO
+	if u.risk != nil {
+		// the risk engine scores where the sign-in comes from, otherwise the
+		// session is located once the response is sent
+		location = u.locate(ctx, ip)
+		applyLocation(candidate, location)
+	}
+	risk, err := u.assessRisk(ctx, user, candidate, now)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case risk.Action == dtos.RiskBlock:
+		return nil, errRiskBlocked
+	case risk.Action == dtos.RiskStepUp && !u.consumeStepUp(ctx, cookie):
+		link, err := u.issueStepUpLink(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return &dtos.VerifyOutputDTO{User: user, StepUp: link}, nil
+	}
+	session, accessToken, err := u.createSessionAndAccessToken(ctx, user, candidate)
 	if err != nil {
 		zap.L().Error("error creating session and access token", zap.Error(err))
 		return nil, err
 	}
-	u.updateSessionGeoLocation(session, user, ip)
+	switch {
+	case u.risk == nil:
+		u.locateSession(ctx, session, user, ip)
+	case risk.Action == dtos.RiskNotify:
+		u.saveSessionGeoLocation(ctx, session, user, location)
+		u.notifyRisk(ctx, user, session, risk)
+	default:
+		u.saveSessionGeoLocation(ctx, session, user, location)
+		u.notifyNewDevice(ctx, user, session)
+	}
 	return &dtos.VerifyOutputDTO{
 		User:         user,
 		AccessToken:  accessToken,
@@ -195,19 +530,27 @@ func (u *AuthService) Verify(code, cookie, ip, ua string) (*dtos.VerifyOutputDTO
 	}, nil
 }
 
-func (u *AuthService) Sessions(userID, currentToken string) ([]*dtos.SessionsOutput, error) {
+func (u *AuthService) Sessions(ctx context.Context, userID, currentToken string) (output []*dtos.SessionsOutput, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.Sessions")
+	defer func() { telemetry.EndSpan(span, err) }()
 	zap.L().Info("sessions request", zap.String("user_id", userID), zap.String("current_token", currentToken))
-	sessions, err := u.sessionRepository.All(userID)
+	sessions, err := u.sessionRepository.All(ctx, userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errSessionNotFound
+			return nil, errSessionExpired
 		} else {
 			zap.L().Error("error finding sessions", zap.Error(err))
 			return nil, err
 		}
 
 	}
-	var output []*dtos.SessionsOutput
+	for _, session := range sessions {
+		if u.activity != nil {
+			u.activity.Apply(session)
+		}
+	}
+	// most recently used first
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
 	for _, session := range sessions {
 		output = append(output, &dtos.SessionsOutput{
 			Session: *session,
@@ -217,13 +560,13 @@ func (u *AuthService) Sessions(userID, currentToken string) ([]*dtos.SessionsOut
 	return output, nil
 }
 
-func generateHashedCodes() (*string, *string, error) {
+func generateHashedCodes(random io.Reader) (*string, *string, error) {
 	code := make([]byte, 64)
-	if _, err := rand.Read(code); err != nil {
+	if _, err := io.ReadFull(random, code); err != nil {
 		return nil, nil, err
 	}
 	fingerCode := make([]byte, 64)
-	if _, err := rand.Read(fingerCode); err != nil {
+	if _, err := io.ReadFull(random, fingerCode); err != nil {
 		return nil, nil, err
 	}
 	tokenStr := hex.EncodeToString(code)
@@ -231,8 +574,25 @@ func generateHashedCodes() (*string, *string, error) {
 	return &tokenStr, &fingerPrint, nil
 }
 
-func generateAccessToken(user *entities.User) (ac string, err error) {
-	ac, err = token.NewJwtAccessToken(token.UserClaims{UserId: user.ID, Email: user.Email, Blocked: user.Blocked, StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(15 * time.Minute).Unix()}})
+func (u *AuthService) generateAccessToken(user *entities.User, sessionId string) (ac string, err error) {
+	tokenId := make([]byte, 16)
+	if _, err = io.ReadFull(u.random, tokenId); err != nil {
+		zap.L().Error("error generating token id", zap.Error(err))
+		return
+	}
+	now := u.clock.Now()
+	ac, err = token.NewJwtAccessToken(u.keys, token.UserClaims{
+		UserId:    user.ID,
+		Email:     user.Email,
+		Blocked:   user.Blocked,
+		SessionId: sessionId,
+		Scope:     u.scope(user),
+		StandardClaims: jwt.StandardClaims{
+			Id:        hex.EncodeToString(tokenId),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(u.config.AccessTokenTTL).Unix(),
+		},
+	})
 	if err != nil {
 		zap.L().Error("error generating access token", zap.Error(err), zap.String("user_id", user.ID))
 		return
@@ -240,34 +600,325 @@ func generateAccessToken(user *entities.User) (ac string, err error) {
 	return
 }
 
-func (u *AuthService) updateSessionGeoLocation(session *entities.Session, user *entities.User, ip string) {
-	go func() {
-		location, err := iplocation.GetGeoLocationByIp(ip)
-		if err != nil {
-			zap.L().Error("error find geolocation by ip", zap.Error(err), zap.String("ip", ip))
+// locate finds where ip is, returning nil when it can't be located.
+func (u *AuthService) locate(ctx context.Context, ip string) *dtos.GeoLocationOutputDTO {
+	if u.geoLocator == nil {
+		return nil
+	}
+	if u.config.IsDev() && !isPublicAddress(ip) {
+		// local addresses can't be located, pretend the request came from a public one
+		ip = u.config.DevGeoIP
+	}
+	if ip == "" {
+		return nil
+	}
+	location, err := u.geoLocator.Locate(ctx, ip)
+	if err != nil {
+		zap.L().Error("error find geolocation by ip", zap.Error(err), zap.String("ip", ip))
+		return nil
+	}
+	return location
+}
+
+func applyDevice(session *entities.Session, ua string) {
+	device := useragent.Parse(ua)
+	session.UpdateDevice(device.Browser, device.BrowserVersion, device.OS, device.Type, device.Label)
+}
+
+func applyLocation(session *entities.Session, location *dtos.GeoLocationOutputDTO) {
+	if location != nil {
+		session.UpdateLocation(&location.Latitude, &location.Longitude, &location.Ip, location.City, location.Region, &location.Country, &location.OrganizationName)
+	}
+}
+
+func (u *AuthService) saveSessionGeoLocation(ctx context.Context, session *entities.Session, user *entities.User, location *dtos.GeoLocationOutputDTO) {
+	if location == nil {
+		return
+	}
+	applyLocation(session, location)
+	go func(ctx context.Context) {
+		ctx, cancel := detach(ctx)
+		defer cancel()
+		if err := u.sessionRepository.UpdateGeoLocation(ctx, session); err != nil {
+			zap.L().Error("error updating session", zap.Error(err), zap.String("user_id", user.ID))
 		}
-		if location != nil {
-			lat, _ := strconv.ParseFloat(location.Latitude, 64)
-			long, _ := strconv.ParseFloat(location.Longitude, 64)
-			session.UpdateLocation(&lat, &long, &location.Ip, location.City, location.Region, &location.Country, &location.OrganizationName)
-			if err := u.sessionRepository.UpdateGeoLocation(session); err != nil {
+	}(ctx)
+}
+
+// locateSession locates a new session in the background, then looks for a new
+// device, which needs the country of the session.
+func (u *AuthService) locateSession(ctx context.Context, session *entities.Session, user *entities.User, ip string) {
+	if u.geoLocator == nil && !u.newDeviceAlerts() {
+		return
+	}
+	go func(ctx context.Context) {
+		ctx, cancel := detach(ctx)
+		defer cancel()
+		if location := u.locate(ctx, ip); location != nil {
+			applyLocation(session, location)
+			if err := u.sessionRepository.UpdateGeoLocation(ctx, session); err != nil {
 				zap.L().Error("error updating session", zap.Error(err), zap.String("user_id", user.ID))
 			}
 		}
-	}()
+		if u.newDeviceAlerts() {
+			u.warnNewDevice(ctx, user, session)
+		}
+	}(ctx)
 }
 
-func (u *AuthService) createSessionAndAccessToken(user *entities.User, ua string) (*entities.Session, string, error) {
+func isPublicAddress(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+func (u *AuthService) createSessionAndAccessToken(ctx context.Context, user *entities.User, candidate *entities.Session) (*entities.Session, string, error) {
 	var session *entities.Session
 	var accessToken string
 	var err error
-	session, err = u.sessionRepository.Create(entities.NewSession(user.ID, time.Now().Add(time.Hour*24), &ua))
+	session, err = u.sessionRepository.Create(ctx, candidate)
 	if err != nil {
 		return nil, "", err
 	}
-	accessToken, err = generateAccessToken(user)
+	accessToken, err = u.generateAccessToken(user, session.Id)
 	if err != nil {
 		return nil, "", err
 	}
 	return session, accessToken, nil
 }
+
+// assessRisk scores the candidate session against the user's sessions, allowing
+// everything when no risk engine is configured.
+func (u *AuthService) assessRisk(ctx context.Context, user *entities.User, candidate *entities.Session, now time.Time) (*dtos.RiskAssessmentDTO, error) {
+	if u.risk == nil {
+		return &dtos.RiskAssessmentDTO{Action: dtos.RiskAllow}, nil
+	}
+	sessions, err := u.sessionRepository.All(ctx, user.ID)
+	if err != nil {
+		zap.L().Error("error finding sessions", zap.Error(err))
+		return nil, err
+	}
+	risk := u.risk.Evaluate(candidate, sessions, now)
+	if risk.Action != dtos.RiskAllow {
+		zap.L().Warn("risky sign-in", zap.String("user_id", user.ID), zap.String("session_id", candidate.Id), zap.Int("score", risk.Score), zap.Strings("signals", risk.Signals), zap.String("action", risk.Action))
+	}
+	return risk, nil
+}
+
+// checkRefreshRisk evaluates a refresh coming from ip and ua. Sessions that
+// would be blocked or need a step-up are disconnected, so the user signs in again.
+func (u *AuthService) checkRefreshRisk(ctx context.Context, user *entities.User, session *entities.Session, ip, ua string, now time.Time) error {
+	if u.risk == nil || sameClient(session, ip, ua) {
+		return nil
+	}
+	candidate := *session
+	candidate.UserAgent = &ua
+	applyDevice(&candidate, ua)
+	applyLocation(&candidate, u.locate(ctx, ip))
+	risk, err := u.assessRisk(ctx, user, &candidate, now)
+	if err != nil {
+		return err
+	}
+	switch risk.Action {
+	case dtos.RiskBlock, dtos.RiskStepUp:
+		if err := u.sessionRepository.Disconnect(ctx, session.Id); err != nil {
+			zap.L().Error("error disconnecting session", zap.Error(err))
+			return err
+		}
+		if err := u.denySessions(ctx, session.Id); err != nil {
+			return err
+		}
+		if risk.Action == dtos.RiskBlock {
+			return errRiskBlocked
+		}
+		return errReauthenticate
+	case dtos.RiskNotify:
+		u.notifyRisk(ctx, user, session, risk)
+	}
+	return nil
+}
+
+// sameClient reports whether a refresh comes from the address and user agent
+// the session was last seen with, which scores like the session itself.
+func sameClient(session *entities.Session, ip, ua string) bool {
+	sameIp := session.LastIp != nil && *session.LastIp == ip || session.Ip != nil && *session.Ip == ip
+	return sameIp && session.UserAgent != nil && *session.UserAgent == ua
+}
+
+const (
+	stepUpPrefix   = "hyperzoop:risk:step_up:"
+	notifiedPrefix = "hyperzoop:risk:notified:"
+)
+
+// issueStepUpLink sends a new link to the user's email; opening it confirms
+// the sign-in without being held back again.
+func (u *AuthService) issueStepUpLink(ctx context.Context, user *entities.User) (*dtos.LoginOutputDTO, error) {
+	if u.notifier == nil || u.cache == nil {
+		zap.L().Warn("step-up without a notifier, refusing the sign-in", zap.String("user_id", user.ID))
+		return nil, errRiskBlocked
+	}
+	link, err := u.issueLink(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.cache.Set(ctx, stepUpPrefix+*link.Cookie, user.ID, u.config.MagicLinkTTL); err != nil {
+		zap.L().Error("error storing step-up link", zap.Error(err))
+		return nil, err
+	}
+	if err := u.notifier.StepUpRequired(ctx, user, link); err != nil {
+		zap.L().Error("error sending step-up link", zap.Error(err))
+		return nil, err
+	}
+	link.Message = fmt.Sprintf("this sign-in must be confirmed, a new link was sent to %s", user.Email)
+	return link, nil
+}
+
+// consumeStepUp reports whether the link bound to cookie was sent as a step-up
+// link, forgetting it.
+func (u *AuthService) consumeStepUp(ctx context.Context, cookie string) bool {
+	if u.cache == nil {
+		return false
+	}
+	_, err := u.cache.Take(ctx, stepUpPrefix+cookie)
+	if err != nil && err != ports.ErrCacheMiss {
+		zap.L().Error("error reading step-up link", zap.Error(err))
+	}
+	return err == nil
+}
+
+// notifyRisk warns the user about a risky session, once per session.
+func (u *AuthService) notifyRisk(ctx context.Context, user *entities.User, session *entities.Session, risk *dtos.RiskAssessmentDTO) {
+	if u.notifier == nil || u.cache == nil {
+		return
+	}
+	go func(ctx context.Context) {
+		ctx, cancel := detach(ctx)
+		defer cancel()
+		if _, err := u.cache.Get(ctx, notifiedPrefix+session.Id); err == nil {
+			return
+		}
+		if err := u.notifier.RiskDetected(ctx, user, session, risk); err != nil {
+			zap.L().Error("error sending risk notification", zap.Error(err), zap.String("user_id", user.ID))
+			return
+		}
+		if err := u.cache.Set(ctx, notifiedPrefix+session.Id, "1", session.ValidUntil.Sub(u.clock.Now())); err != nil {
+			zap.L().Error("error storing risk notification", zap.Error(err))
+		}
+	}(ctx)
+}
+
+const (
+	notMePrefix  = "hyperzoop:auth:not_me:"
+	pausedPrefix = "hyperzoop:auth:paused:"
+)
+
+// notifyNewDevice tells the user about a sign-in from a browser or a country
+// none of their previous sessions used, with a link to revoke it. The first
+// sign-in of a user is not reported.
+func (u *AuthService) notifyNewDevice(ctx context.Context, user *entities.User, session *entities.Session) {
+	if !u.newDeviceAlerts() {
+		return
+	}
+	go func(ctx context.Context) {
+		ctx, cancel := detach(ctx)
+		defer cancel()
+		u.warnNewDevice(ctx, user, session)
+	}(ctx)
+}
+
+func (u *AuthService) newDeviceAlerts() bool {
+	return u.notifier != nil && u.cache != nil && u.config.NewDeviceAlerts
+}
+
+func (u *AuthService) warnNewDevice(ctx context.Context, user *entities.User, session *entities.Session) {
+	sessions, err := u.sessionRepository.All(ctx, user.ID)
+	if err != nil {
+		zap.L().Error("error finding sessions", zap.Error(err))
+		return
+	}
+	previous := make([]*entities.Session, 0, len(sessions))
+	for _, s := range sessions {
+		if s.Id != session.Id {
+			previous = append(previous, s)
+		}
+	}
+	signals := unfamiliarSignals(session, latestSessions(previous, u.config.RiskHistory))
+	if !slices.Contains(signals, signalNewCountry) && !slices.Contains(signals, signalNewUserAgent) {
+		return
+	}
+	link, err := u.issueNotMeLink(ctx, user, session)
+	if err != nil {
+		zap.L().Error("error storing not-me link", zap.Error(err))
+		return
+	}
+	if err := u.notifier.NewDevice(ctx, user, session, link); err != nil {
+		zap.L().Error("error sending new device notification", zap.Error(err), zap.String("user_id", user.ID))
+	}
+}
+
+// issueNotMeLink returns a link revoking session, valid as long as a session can last.
+func (u *AuthService) issueNotMeLink(ctx context.Context, user *entities.User, session *entities.Session) (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := io.ReadFull(u.random, bytes); err != nil {
+		return "", err
+	}
+	code := hex.EncodeToString(bytes)
+	if err := u.cache.Set(ctx, notMePrefix+code, user.ID+":"+session.Id, u.config.SessionTTL); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/auth/not-me?code=%s", u.config.VerifyHost, code), nil
+}
+
+// RejectSession handles a "this wasn't me" link: it disconnects the reported
+// session and refuses new sign-in links for the user during not_me_cooldown.
+func (u *AuthService) RejectSession(ctx context.Context, code string) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.RejectSession")
+	defer func() { telemetry.EndSpan(span, err) }()
+	zap.L().Info("reject session request", zap.String("code", code))
+	if u.cache == nil || code == "" {
+		return errNotMeLinkExpired
+	}
+	value, err := u.cache.Get(ctx, notMePrefix+code)
+	if err != nil {
+		if err == ports.ErrCacheMiss {
+			return errNotMeLinkExpired
+		}
+		zap.L().Error("error finding not-me link", zap.Error(err))
+		return err
+	}
+	userId, sessionId, _ := strings.Cut(value, ":")
+	if err := u.cache.Set(ctx, pausedPrefix+userId, sessionId, u.config.NotMeCooldown); err != nil {
+		zap.L().Error("error pausing sign-in links", zap.Error(err))
+		return err
+	}
+	if err := u.sessionRepository.Disconnect(ctx, sessionId); err != nil && err != sql.ErrNoRows {
+		zap.L().Error("error disconnecting session", zap.Error(err))
+		return err
+	}
+	if err := u.denySessions(ctx, sessionId); err != nil {
+		return err
+	}
+	if err := u.cache.Invalidate(ctx, notMePrefix+code); err != nil {
+		zap.L().Error("error invalidating not-me link", zap.Error(err))
+	}
+	zap.L().Warn("session reported by its user", zap.String("user_id", userId), zap.String("session_id", sessionId))
+	u.recordAudit(ctx, &dtos.AuditEventDTO{Action: dtos.AuditSessionReported, Actor: dtos.ActorDTO{UserId: userId}, UserId: userId, SessionId: sessionId, Count: 1})
+	return nil
+}
+
+// linksPaused reports whether the user reported a session during the cooldown.
+func (u *AuthService) linksPaused(ctx context.Context, user *entities.User) bool {
+	if u.cache == nil {
+		return false
+	}
+	_, err := u.cache.Get(ctx, pausedPrefix+user.ID)
+	if err != nil && err != ports.ErrCacheMiss {
+		zap.L().Error("error checking paused sign-in links", zap.Error(err))
+	}
+	return err == nil
+}
+
+// detach returns a context that keeps the values (and trace) of ctx but is not
+// cancelled with the request, limited to backgroundTimeout.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), backgroundTimeout)
+}
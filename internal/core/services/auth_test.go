@@ -0,0 +1,1047 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/adapters/geolocation"
+	repositories "github.com/jmjp/gopasswordless/internal/adapters/repositories/memory"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/errs"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"github.com/jmjp/gopasswordless/internal/infra/config"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"github.com/jmjp/gopasswordless/internal/infra/validation"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type authFixture struct {
+	service  *AuthService
+	config   *config.Config
+	clock    *clock.Fake
+	keys     *token.Keyring
+	users    *repositories.UserMemoryRepository
+	links    *repositories.MagicLinkMemoryRepository
+	sessions *repositories.SessionMemoryRepository
+	locator  *geolocation.FakeLocator
+	notifier *recordingNotifier
+	cache    *repositories.RedisCacheMemoryRepository
+	activity *ActivityRecorder
+	audit    *recordingAuditLog
+	denylist *repositories.TokenDenylistMemoryRepository
+}
+
+func newAuthFixture(t *testing.T) *authFixture {
+	t.Helper()
+	cfg := &config.Config{
+		Env:             "test",
+		VerifyHost:      "http://localhost:3000",
+		AccessTokenTTL:  15 * time.Minute,
+		MagicLinkTTL:    5 * time.Minute,
+		SessionTTL:      24 * time.Hour,
+		RiskHistory:     10,
+		NewDeviceAlerts: true,
+		NotMeCooldown:   time.Hour,
+		AdminEmails:     []string{"Admin@hyperzoop.com"},
+	}
+	f := &authFixture{
+		config: cfg,
+		clock:  clock.NewFake(time.Now()),
+		keys:   token.NewStaticKeyring("test-secret"),
+	}
+	f.users = repositories.NewUserMemoryRepository(f.clock)
+	f.links = repositories.NewMagicLinkMemoryRepository(f.clock)
+	f.sessions = repositories.NewSessionMemoryRepository(f.clock)
+	f.locator = geolocation.NewFakeLocator(map[string]*dtos.GeoLocationOutputDTO{
+		"203.0.113.7":  {Ip: "203.0.113.7", Latitude: 48.85, Longitude: 2.35, Country: "FR"},
+		"198.51.100.9": {Ip: "198.51.100.9", Latitude: 40.71, Longitude: -74.0, Country: "US"},
+	})
+	f.notifier = &recordingNotifier{}
+	f.cache = repositories.NewRedisCacheMemoryRepository(f.clock)
+	f.activity = NewActivityRecorder(f.sessions, time.Minute)
+	f.audit = &recordingAuditLog{}
+	f.denylist = repositories.NewTokenDenylistMemoryRepository(f.clock, cfg.AccessTokenTTL)
+	f.service = NewAuthService(cfg, f.keys, f.users, f.links, f.sessions, f.locator,
+		WithClock(f.clock),
+		WithRandom(rand.New(rand.NewSource(1))),
+		WithNotifier(f.notifier, f.cache),
+		WithActivity(f.activity),
+		WithAudit(f.audit),
+		WithDenylist(f.denylist),
+	)
+	return f
+}
+
+// enableRisk rebuilds the service with a risk engine using policy and returns
+// the notifier it reports to.
+func (f *authFixture) enableRisk(policy RiskPolicy) *recordingNotifier {
+	f.service = NewAuthService(f.config, f.keys, f.users, f.links, f.sessions, f.locator,
+		WithClock(f.clock),
+		WithRandom(rand.New(rand.NewSource(2))),
+		WithNotifier(f.notifier, f.cache),
+		WithActivity(f.activity),
+		WithAudit(f.audit),
+		WithDenylist(f.denylist),
+		WithRisk(NewRiskEngine(policy)),
+	)
+	return f.notifier
+}
+
+type recordingNotifier struct {
+	mu         sync.Mutex
+	risks      []*dtos.RiskAssessmentDTO
+	stepUps    []*dtos.LoginOutputDTO
+	notMeLinks []string
+	revoked    []int64
+}
+
+func (n *recordingNotifier) RiskDetected(ctx context.Context, user *entities.User, session *entities.Session, risk *dtos.RiskAssessmentDTO) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.risks = append(n.risks, risk)
+	return nil
+}
+
+func (n *recordingNotifier) StepUpRequired(ctx context.Context, user *entities.User, link *dtos.LoginOutputDTO) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stepUps = append(n.stepUps, link)
+	return nil
+}
+
+func (n *recordingNotifier) NewDevice(ctx context.Context, user *entities.User, session *entities.Session, notMeLink string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notMeLinks = append(n.notMeLinks, notMeLink)
+	return nil
+}
+
+func (n *recordingNotifier) SessionsRevoked(ctx context.Context, user *entities.User, revoked int64, everywhere bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.revoked = append(n.revoked, revoked)
+	return nil
+}
+
+func (n *recordingNotifier) revocations() []int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]int64(nil), n.revoked...)
+}
+
+type recordingAuditLog struct {
+	events []*dtos.AuditEventDTO
+}
+
+func (l *recordingAuditLog) Record(ctx context.Context, event *dtos.AuditEventDTO) error {
+	l.events = append(l.events, event)
+	return nil
+}
+
+func (n *recordingNotifier) newDevices() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.notMeLinks...)
+}
+
+func (n *recordingNotifier) notified() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.risks)
+}
+
+func (f *authFixture) createUser(t *testing.T, email string, blocked bool) *entities.User {
+	t.Helper()
+	user, err := entities.NewUser(email, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Blocked = blocked
+	user, err = f.users.Create(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func (f *authFixture) login(t *testing.T, email string) *dtos.LoginOutputDTO {
+	t.Helper()
+	out, err := f.service.Login(context.Background(), dtos.LoginInputDTO{Email: email})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	return out
+}
+
+func (f *authFixture) verify(t *testing.T, email string) *dtos.VerifyOutputDTO {
+	t.Helper()
+	link := f.login(t, email)
+	out, err := f.service.Verify(context.Background(), linkCode(t, link), *link.Cookie, "", "test-agent")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	return out
+}
+
+// verifyFrom signs in from ip and waits until the session location is stored.
+func (f *authFixture) verifyFrom(t *testing.T, email, ip string) *dtos.VerifyOutputDTO {
+	t.Helper()
+	link := f.login(t, email)
+	out, err := f.service.Verify(context.Background(), linkCode(t, link), *link.Cookie, ip, "test-agent")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	eventually(t, func() bool {
+		session, _ := f.sessions.One(context.Background(), out.RefreshToken)
+		return session.Country != nil
+	})
+	return out
+}
+
+func linkCode(t *testing.T, out *dtos.LoginOutputDTO) string {
+	t.Helper()
+	u, err := url.Parse(out.Link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("code")
+}
+
+// eventually waits for the writes AuthService runs in the background.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAuthServiceLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *bool
+		email    string
+		// input is the email given to Login, email when empty
+		input      string
+		wantErr    bool
+		wantStored bool
+	}{
+		{name: "creates a new user", email: "new@hyperzoop.com", wantStored: true},
+		{name: "reuses an existing user", existing: ptr(false), email: "old@hyperzoop.com", wantStored: true},
+		{name: "refuses a blocked user", existing: ptr(true), email: "blocked@hyperzoop.com", wantErr: true, wantStored: true},
+		{name: "refuses an invalid email", email: "not-an-email", wantErr: true},
+		{name: "normalizes the email", email: "new@xn--bcher-kva.example", input: " New@Bücher.EXAMPLE ", wantStored: true},
+		{name: "reuses the user of a differently cased email", existing: ptr(false), email: "old@hyperzoop.com", input: "Old@HyperZoop.com", wantStored: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newAuthFixture(t)
+			if tt.existing != nil {
+				f.createUser(t, tt.email, *tt.existing)
+			}
+			input := tt.input
+			if input == "" {
+				input = tt.email
+			}
+			out, err := f.service.Login(context.Background(), dtos.LoginInputDTO{Email: input})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, findErr := f.users.FindByEmail(context.Background(), tt.email); (findErr == nil) != tt.wantStored {
+				t.Fatalf("user stored = %v, want %v", findErr == nil, tt.wantStored)
+			}
+			if _, findErr := f.users.FindByEmail(context.Background(), input); input != tt.email && findErr == nil {
+				t.Fatalf("user stored with the email %q as given", input)
+			}
+			if tt.wantErr {
+				return
+			}
+			if out.Cookie == nil || len(*out.Cookie) != 128 {
+				t.Fatalf("unexpected fingerprint %v", out.Cookie)
+			}
+			if code := linkCode(t, out); len(code) != 128 {
+				t.Fatalf("unexpected code %q", code)
+			}
+			if want := f.clock.Now().Add(5 * time.Minute); !out.ExpiresIn.Equal(want) {
+				t.Fatalf("ExpiresIn = %v, want %v", out.ExpiresIn, want)
+			}
+		})
+	}
+}
+
+func TestAuthServiceIssueLink(t *testing.T) {
+	f := newAuthFixture(t)
+	if _, err := f.service.IssueLink(context.Background(), "missing@hyperzoop.com"); !errors.Is(err, errUserNotFound) {
+		t.Fatalf("IssueLink() error = %v, want %v", err, errUserNotFound)
+	}
+	f.createUser(t, "user@hyperzoop.com", false)
+	if _, err := f.service.IssueLink(context.Background(), "User@HyperZoop.com"); err != nil {
+		t.Fatalf("IssueLink() error = %v", err)
+	}
+}
+
+func TestAuthServiceVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, f *authFixture, link *dtos.LoginOutputDTO) (code, cookie string)
+		wantErr error
+	}{
+		{
+			name: "creates a session",
+			prepare: func(t *testing.T, f *authFixture, link *dtos.LoginOutputDTO) (string, string) {
+				return linkCode(t, link), *link.Cookie
+			},
+		},
+		{
+			name: "rejects a short code",
+			prepare: func(t *testing.T, f *authFixture, link *dtos.LoginOutputDTO) (string, string) {
+				return "short", *link.Cookie
+			},
+			wantErr: errInvalidCodeOrFingerprint,
+		},
+		{
+			name: "rejects a missing fingerprint",
+			prepare: func(t *testing.T, f *authFixture, link *dtos.LoginOutputDTO) (string, string) {
+				return linkCode(t, link), ""
+			},
+			wantErr: errInvalidCodeOrFingerprint,
+		},
+		{
+			name: "rejects another fingerprint",
+			prepare: func(t *testing.T, f *authFixture, link *dtos.LoginOutputDTO) (string, string) {
+				return linkCode(t, link), "0123456789abcdef0123456789abcdef"
+			},
+			wantErr: errNoCodeFounded,
+		},
+		{
+			name: "rejects an expired link",
+			prepare: func(t *testing.T, f *authFixture, link *dtos.LoginOutputDTO) (string, string) {
+				f.clock.Advance(6 * time.Minute)
+				return linkCode(t, link), *link.Cookie
+			},
+			wantErr: errNoCodeFounded,
+		},
+		{
+			name: "rejects a used link",
+			prepare: func(t *testing.T, f *authFixture, link *dtos.LoginOutputDTO) (string, string) {
+				code := linkCode(t, link)
+				if _, err := f.service.Verify(context.Background(), code, *link.Cookie, "", "test-agent"); err != nil {
+					t.Fatal(err)
+				}
+				return code, *link.Cookie
+			},
+			wantErr: errNoCodeFounded,
+		},
+		{
+			name: "rejects a user blocked after the link was sent",
+			prepare: func(t *testing.T, f *authFixture, link *dtos.LoginOutputDTO) (string, string) {
+				user, _ := f.users.FindByEmail(context.Background(), "user@hyperzoop.com")
+				user.Block()
+				f.users.Update(context.Background(), user)
+				return linkCode(t, link), *link.Cookie
+			},
+			wantErr: errUserBlocked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newAuthFixture(t)
+			link := f.login(t, "user@hyperzoop.com")
+			code, cookie := tt.prepare(t, f, link)
+			out, err := f.service.Verify(context.Background(), code, cookie, "", "test-agent")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			claims, err := token.ParseJwtAccessToken(f.keys, out.AccessToken)
+			if err != nil {
+				t.Fatalf("invalid access token: %v", err)
+			}
+			if claims.UserId != out.User.ID {
+				t.Fatalf("token user = %s, want %s", claims.UserId, out.User.ID)
+			}
+			session, err := f.sessions.One(context.Background(), out.RefreshToken)
+			if err != nil {
+				t.Fatalf("session not stored: %v", err)
+			}
+			if want := f.clock.Now().Add(24 * time.Hour); !session.ValidUntil.Equal(want) {
+				t.Fatalf("ValidUntil = %v, want %v", session.ValidUntil, want)
+			}
+		})
+	}
+}
+
+func TestAuthServiceVerifyConcurrently(t *testing.T) {
+	f := newAuthFixture(t)
+	link := f.login(t, "user@hyperzoop.com")
+	code := linkCode(t, link)
+	const attempts = 10
+	results := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		go func() {
+			_, err := f.service.Verify(context.Background(), code, *link.Cookie, "", "test-agent")
+			results <- err
+		}()
+	}
+	var signedIn int
+	for i := 0; i < attempts; i++ {
+		switch err := <-results; {
+		case err == nil:
+			signedIn++
+		case !errors.Is(err, errNoCodeFounded):
+			t.Fatalf("Verify() error = %v, want %v", err, errNoCodeFounded)
+		}
+	}
+	if signedIn != 1 {
+		t.Fatalf("%d of %d concurrent Verify() signed in, want 1", signedIn, attempts)
+	}
+}
+
+func TestAuthServiceVerifyLocatesSession(t *testing.T) {
+	f := newAuthFixture(t)
+	link := f.login(t, "user@hyperzoop.com")
+	out, err := f.service.Verify(context.Background(), linkCode(t, link), *link.Cookie, "203.0.113.7", "test-agent")
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	eventually(t, func() bool {
+		session, _ := f.sessions.One(context.Background(), out.RefreshToken)
+		return session.Country != nil && *session.Country == "FR" && session.Latitude != nil && *session.Latitude == 48.85
+	})
+
+	f.locator.Fail(errors.New("provider down"))
+	link = f.login(t, "user@hyperzoop.com")
+	if _, err := f.service.Verify(context.Background(), linkCode(t, link), *link.Cookie, "203.0.113.8", "test-agent"); err != nil {
+		t.Fatalf("Verify() with a failing locator error = %v", err)
+	}
+}
+
+func TestAuthServiceVerifyRisk(t *testing.T) {
+	const email = "user@hyperzoop.com"
+	policy := RiskPolicy{MaxSpeed: 900, History: 10}
+
+	t.Run("allows sign-ins from the usual place", func(t *testing.T) {
+		f := newAuthFixture(t)
+		notifier := f.enableRisk(RiskPolicy{NotifyScore: 30, BlockScore: 30, MaxSpeed: 900, History: 10})
+		for i := 0; i < 2; i++ {
+			f.verifyFrom(t, email, "203.0.113.7")
+			f.clock.Advance(time.Hour)
+		}
+		if notifier.notified() != 0 {
+			t.Fatal("usual sign-in was notified")
+		}
+	})
+
+	t.Run("notifies impossible travel", func(t *testing.T) {
+		f := newAuthFixture(t)
+		policy := policy
+		policy.NotifyScore = 30
+		notifier := f.enableRisk(policy)
+		f.verifyFrom(t, email, "203.0.113.7")
+		f.clock.Advance(time.Hour)
+		link := f.login(t, email)
+		out, err := f.service.Verify(context.Background(), linkCode(t, link), *link.Cookie, "198.51.100.9", "test-agent")
+		if err != nil || out.RefreshToken == "" {
+			t.Fatalf("Verify() = %+v, %v, want a session", out, err)
+		}
+		eventually(t, func() bool { return notifier.notified() == 1 })
+		if got := notifier.risks[0].Signals; len(got) != 2 || got[0] != signalImpossibleTravel || got[1] != signalNewCountry {
+			t.Fatalf("signals = %v", got)
+		}
+		// the notification is remembered as long as the session, on the clock of the service
+		notified := notifiedPrefix + out.RefreshToken
+		eventually(t, func() bool { _, err := f.cache.Get(context.Background(), notified); return err == nil })
+		f.clock.Advance(f.config.SessionTTL + time.Second)
+		if _, err := f.cache.Get(context.Background(), notified); !errors.Is(err, ports.ErrCacheMiss) {
+			t.Fatalf("notification remembered after the session expired: %v", err)
+		}
+	})
+
+	t.Run("blocks impossible travel", func(t *testing.T) {
+		f := newAuthFixture(t)
+		policy := policy
+		policy.BlockScore = 60
+		f.enableRisk(policy)
+		f.verifyFrom(t, email, "203.0.113.7")
+		f.clock.Advance(time.Hour)
+		link := f.login(t, email)
+		_, err := f.service.Verify(context.Background(), linkCode(t, link), *link.Cookie, "198.51.100.9", "test-agent")
+		if !errors.Is(err, errRiskBlocked) {
+			t.Fatalf("Verify() error = %v, want %v", err, errRiskBlocked)
+		}
+	})
+
+	t.Run("asks to confirm impossible travel", func(t *testing.T) {
+		f := newAuthFixture(t)
+		policy := policy
+		policy.StepUpScore = 60
+		notifier := f.enableRisk(policy)
+		user := f.createUser(t, email, false)
+		f.verifyFrom(t, email, "203.0.113.7")
+		f.clock.Advance(time.Hour)
+		link := f.login(t, email)
+		out, err := f.service.Verify(context.Background(), linkCode(t, link), *link.Cookie, "198.51.100.9", "test-agent")
+		if err != nil || out.StepUp == nil || out.RefreshToken != "" {
+			t.Fatalf("Verify() = %+v, %v, want a step-up", out, err)
+		}
+		if len(notifier.stepUps) != 1 || notifier.stepUps[0].Link != out.StepUp.Link {
+			t.Fatal("step-up link was not sent to the user")
+		}
+		if sessions, _ := f.sessions.All(context.Background(), user.ID); len(sessions) != 1 {
+			t.Fatalf("%d sessions, want only the first one", len(sessions))
+		}
+
+		out, err = f.service.Verify(context.Background(), linkCode(t, out.StepUp), *out.StepUp.Cookie, "198.51.100.9", "test-agent")
+		if err != nil || out.StepUp != nil || out.RefreshToken == "" {
+			t.Fatalf("Verify() with the step-up link = %+v, %v, want a session", out, err)
+		}
+	})
+
+	t.Run("confirms a step-up once under concurrency", func(t *testing.T) {
+		f := newAuthFixture(t)
+		policy := policy
+		policy.StepUpScore = 60
+		f.enableRisk(policy)
+		if err := f.cache.Set(context.Background(), stepUpPrefix+"cookie", "user", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		const attempts = 20
+		var wg sync.WaitGroup
+		var confirmed atomic.Int32
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if f.service.consumeStepUp(context.Background(), "cookie") {
+					confirmed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := confirmed.Load(); n != 1 {
+			t.Fatalf("%d of %d concurrent confirmations bypassed the step-up, want 1", n, attempts)
+		}
+	})
+
+	t.Run("refuses confirmations without a notifier", func(t *testing.T) {
+		f := newAuthFixture(t)
+		policy := policy
+		policy.NotifyScore = 30
+		policy.StepUpScore = 60
+		f.service = NewAuthService(f.config, f.keys, f.users, f.links, f.sessions, f.locator,
+			WithClock(f.clock),
+			WithRisk(NewRiskEngine(policy)),
+		)
+		f.verifyFrom(t, email, "203.0.113.7")
+		f.clock.Advance(time.Hour)
+		link := f.login(t, email)
+		if _, err := f.service.Verify(context.Background(), linkCode(t, link), *link.Cookie, "198.51.100.9", "test-agent"); !errors.Is(err, errRiskBlocked) {
+			t.Fatalf("Verify() error = %v, want %v", err, errRiskBlocked)
+		}
+		f.clock.Advance(24 * time.Hour)
+		// a new country only notifies, which is skipped
+		f.verifyFrom(t, email, "198.51.100.9")
+	})
+}
+
+// blockingLocator holds every lookup until release is closed.
+type blockingLocator struct {
+	ports.GeoLocator
+	release chan struct{}
+}
+
+func (l *blockingLocator) Locate(ctx context.Context, ip string) (*dtos.GeoLocationOutputDTO, error) {
+	<-l.release
+	return l.GeoLocator.Locate(ctx, ip)
+}
+
+func TestAuthServiceVerifyLocatesInBackground(t *testing.T) {
+	f := newAuthFixture(t)
+	locator := &blockingLocator{GeoLocator: f.locator, release: make(chan struct{})}
+	f.service = NewAuthService(f.config, f.keys, f.users, f.links, f.sessions, locator, WithClock(f.clock))
+	link := f.login(t, "user@hyperzoop.com")
+	done := make(chan *dtos.VerifyOutputDTO)
+	go func() {
+		out, err := f.service.Verify(context.Background(), linkCode(t, link), *link.Cookie, "203.0.113.7", "test-agent")
+		if err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+		done <- out
+	}()
+	var out *dtos.VerifyOutputDTO
+	select {
+	case out = <-done:
+	case <-time.After(2 * time.Second):
+		close(locator.release)
+		t.Fatal("Verify() waited for the locator without a risk engine")
+	}
+	close(locator.release)
+	eventually(t, func() bool {
+		session, _ := f.sessions.One(context.Background(), out.RefreshToken)
+		return session.Country != nil && *session.Country == "FR"
+	})
+}
+
+func TestAuthServiceRefreshRiskSkipsSameClient(t *testing.T) {
+	f := newAuthFixture(t)
+	f.enableRisk(RiskPolicy{NotifyScore: 30, MaxSpeed: 900, History: 10})
+	out := f.verifyFrom(t, "user@hyperzoop.com", "203.0.113.7")
+	lookups := len(f.locator.Lookups())
+	if _, err := f.service.Refresh(context.Background(), out.RefreshToken, "203.0.113.7", "test-agent"); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got := len(f.locator.Lookups()); got != lookups {
+		t.Fatal("Refresh() from the client of the session was located")
+	}
+	if _, err := f.service.Refresh(context.Background(), out.RefreshToken, "198.51.100.9", "test-agent"); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got := len(f.locator.Lookups()); got != lookups+1 {
+		t.Fatal("Refresh() from another address was not located")
+	}
+}
+
+func TestAuthServiceNewDevice(t *testing.T) {
+	const email = "user@hyperzoop.com"
+	const firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:122.0) Gecko/20100101 Firefox/122.0"
+	ctx := context.Background()
+	f := newAuthFixture(t)
+	f.verifyFrom(t, email, "203.0.113.7")
+	f.verifyFrom(t, email, "203.0.113.7")
+
+	link := f.login(t, email)
+	out, err := f.service.Verify(ctx, linkCode(t, link), *link.Cookie, "203.0.113.7", firefox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session, _ := f.sessions.One(ctx, out.RefreshToken); session.DeviceLabel != "Firefox on Linux" || session.DeviceType != "desktop" {
+		t.Fatalf("session device = %q (%s), want Firefox on Linux", session.DeviceLabel, session.DeviceType)
+	}
+	eventually(t, func() bool { return len(f.notifier.newDevices()) > 0 })
+	if got := f.notifier.newDevices(); len(got) != 1 {
+		t.Fatalf("%d new device notifications, want only the one of the new browser", len(got))
+	}
+	notMe, err := url.Parse(f.notifier.newDevices()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := notMe.Query().Get("code")
+
+	if err := f.service.RejectSession(ctx, code); err != nil {
+		t.Fatalf("RejectSession() error = %v", err)
+	}
+	if _, err := f.sessions.One(ctx, out.RefreshToken); err == nil {
+		t.Fatal("reported session was not disconnected")
+	}
+	if err := f.service.RejectSession(ctx, code); !errors.Is(err, errNotMeLinkExpired) {
+		t.Fatalf("RejectSession() twice error = %v, want %v", err, errNotMeLinkExpired)
+	}
+	if _, err := f.service.Login(ctx, dtos.LoginInputDTO{Email: email}); !errors.Is(err, errLinksPaused) {
+		t.Fatalf("Login() during the cooldown error = %v, want %v", err, errLinksPaused)
+	}
+	f.clock.Advance(time.Hour + time.Second)
+	f.login(t, email)
+}
+
+func TestAuthServiceRefreshRisk(t *testing.T) {
+	f := newAuthFixture(t)
+	f.enableRisk(RiskPolicy{BlockScore: 60, MaxSpeed: 900, History: 10})
+	out := f.verifyFrom(t, "user@hyperzoop.com", "203.0.113.7")
+	if _, err := f.service.Refresh(context.Background(), out.RefreshToken, "203.0.113.7", "test-agent"); err != nil {
+		t.Fatalf("Refresh() from the same place error = %v", err)
+	}
+	f.clock.Advance(time.Minute)
+	if _, err := f.service.Refresh(context.Background(), out.RefreshToken, "198.51.100.9", "test-agent"); !errors.Is(err, errRiskBlocked) {
+		t.Fatalf("Refresh() from elsewhere error = %v, want %v", err, errRiskBlocked)
+	}
+	if _, err := f.sessions.One(context.Background(), out.RefreshToken); err == nil {
+		t.Fatal("risky session was not disconnected")
+	}
+}
+
+func TestAuthServiceRefresh(t *testing.T) {
+	tests := []struct {
+		name       string
+		advance    time.Duration
+		block      bool
+		unknown    bool
+		wantErr    error
+		wantExtend bool
+	}{
+		{name: "keeps a fresh session", advance: time.Hour},
+		{name: "extends a session past half of its lifetime", advance: 13 * time.Hour, wantExtend: true},
+		{name: "rejects an expired session", advance: 25 * time.Hour, wantErr: errSessionExpired},
+		{name: "rejects an unknown session", unknown: true, wantErr: errSessionExpired},
+		{name: "rejects a blocked user", block: true, wantErr: errUserBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newAuthFixture(t)
+			verified := f.verify(t, "user@hyperzoop.com")
+			refresh := verified.RefreshToken
+			if tt.unknown {
+				refresh = "unknown"
+			}
+			if tt.block {
+				user, _ := f.users.FindById(context.Background(), verified.User.ID)
+				user.Block()
+				f.users.Update(context.Background(), user)
+			}
+			f.clock.Advance(tt.advance)
+			out, err := f.service.Refresh(context.Background(), refresh, "", "test-agent")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Refresh() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if _, err := token.ParseJwtAccessToken(f.keys, out.AccessToken); err != nil {
+				t.Fatalf("invalid access token: %v", err)
+			}
+			if !tt.wantExtend {
+				if out.RefreshToken != nil || out.ExpiresIn != nil {
+					t.Fatalf("session extended too early: %v", out.ExpiresIn)
+				}
+				return
+			}
+			want := f.clock.Now().Add(24 * time.Hour)
+			if out.RefreshToken == nil || *out.RefreshToken != refresh || out.ExpiresIn == nil || !out.ExpiresIn.Equal(want) {
+				t.Fatalf("session not extended: %v %v", out.RefreshToken, out.ExpiresIn)
+			}
+			eventually(t, func() bool {
+				session, _ := f.sessions.One(context.Background(), refresh)
+				return session.ValidUntil.Equal(want)
+			})
+		})
+	}
+}
+
+func TestAuthServiceRevoke(t *testing.T) {
+	tests := []struct {
+		name        string
+		session     func(owned, other *dtos.VerifyOutputDTO) string
+		wantErr     error
+		wantRemoved bool
+	}{
+		{
+			name:        "revokes an owned session",
+			session:     func(owned, other *dtos.VerifyOutputDTO) string { return owned.RefreshToken },
+			wantRemoved: true,
+		},
+		{
+			name:    "refuses another user's session",
+			session: func(owned, other *dtos.VerifyOutputDTO) string { return other.RefreshToken },
+			wantErr: errUnauthorized,
+		},
+		{
+			name:    "rejects an unknown session",
+			session: func(owned, other *dtos.VerifyOutputDTO) string { return "unknown" },
+			wantErr: errSessionNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newAuthFixture(t)
+			owned := f.verify(t, "user@hyperzoop.com")
+			other := f.verify(t, "other@hyperzoop.com")
+			sessionId := tt.session(owned, other)
+			err := f.service.Revoke(context.Background(), sessionId, owned.User.ID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Revoke() error = %v, want %v", err, tt.wantErr)
+			}
+			_, findErr := f.sessions.One(context.Background(), sessionId)
+			if removed := findErr != nil; removed != (tt.wantRemoved || tt.wantErr == errSessionNotFound) {
+				t.Fatalf("session removed = %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestAuthServiceSessions(t *testing.T) {
+	f := newAuthFixture(t)
+	first := f.verify(t, "user@hyperzoop.com")
+	second := f.verify(t, "user@hyperzoop.com")
+	f.verify(t, "other@hyperzoop.com")
+
+	sessions, err := f.service.Sessions(context.Background(), first.User.ID, second.RefreshToken)
+	if err != nil {
+		t.Fatalf("Sessions() error = %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+	for _, session := range sessions {
+		if session.UserId != first.User.ID {
+			t.Fatalf("listed a session of user %s", session.UserId)
+		}
+		if session.Current != (session.Id == second.RefreshToken) {
+			t.Fatalf("session %s current = %v", session.Id, session.Current)
+		}
+	}
+
+	none, err := f.service.Sessions(context.Background(), "nobody", "")
+	if err != nil || len(none) != 0 {
+		t.Fatalf("Sessions() = %v, %v, want none", none, err)
+	}
+}
+
+func TestAuthServiceRevokeOthersAndAll(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t)
+	f.verify(t, "user@hyperzoop.com")
+	f.verify(t, "user@hyperzoop.com")
+	current := f.verify(t, "user@hyperzoop.com")
+	other := f.verify(t, "other@hyperzoop.com")
+	admin := f.verify(t, "admin@hyperzoop.com")
+	userId := current.User.ID
+
+	if _, err := f.service.RevokeOthers(ctx, userId, other.RefreshToken); !errors.Is(err, errUnauthorized) {
+		t.Fatalf("RevokeOthers() keeping another user's session error = %v, want %v", err, errUnauthorized)
+	}
+	out, err := f.service.RevokeOthers(ctx, userId, current.RefreshToken)
+	if err != nil || out.Revoked != 2 {
+		t.Fatalf("RevokeOthers() = %+v, %v, want 2 revoked", out, err)
+	}
+	if sessions, _ := f.sessions.All(ctx, userId); len(sessions) != 1 || sessions[0].Id != current.RefreshToken {
+		t.Fatalf("%d sessions left, want only the current one", len(sessions))
+	}
+
+	if _, err := f.service.RevokeAll(ctx, userId, dtos.ActorDTO{UserId: other.User.ID}); !errors.Is(err, errUnauthorized) {
+		t.Fatalf("RevokeAll() by another user error = %v, want %v", err, errUnauthorized)
+	}
+	if _, err := f.service.RevokeAll(ctx, userId, dtos.ActorDTO{}); !errors.Is(err, errUnauthorized) {
+		t.Fatalf("RevokeAll() without actor error = %v, want %v", err, errUnauthorized)
+	}
+	out, err = f.service.RevokeAll(ctx, userId, dtos.ActorDTO{UserId: admin.User.ID})
+	if err != nil || out.Revoked != 1 {
+		t.Fatalf("RevokeAll() by an admin = %+v, %v, want 1 revoked", out, err)
+	}
+	if out, err := f.service.RevokeAll(ctx, other.User.ID, dtos.ActorDTO{Operator: true}); err != nil || out.Revoked != 1 {
+		t.Fatalf("RevokeAll() by the operator = %+v, %v, want 1 revoked", out, err)
+	}
+
+	actions := []string{}
+	for _, event := range f.audit.events {
+		actions = append(actions, event.Action)
+	}
+	if len(actions) != 3 || actions[0] != dtos.AuditOtherSessionsRevoked || actions[1] != dtos.AuditAllSessionsRevoked || f.audit.events[1].Actor.UserId != admin.User.ID {
+		t.Fatalf("audit events = %v", actions)
+	}
+	eventually(t, func() bool { return len(f.notifier.revocations()) == 3 })
+}
+
+func TestAuthServiceDenylist(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t)
+	first := f.verify(t, "user@hyperzoop.com")
+	second := f.verify(t, "user@hyperzoop.com")
+	third := f.verify(t, "user@hyperzoop.com")
+	claims := func(out *dtos.VerifyOutputDTO) *token.UserClaims {
+		t.Helper()
+		claims, err := token.ParseJwtAccessToken(f.keys, out.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims
+	}
+	revoked := func(out *dtos.VerifyOutputDTO) bool {
+		t.Helper()
+		c := claims(out)
+		revoked, err := f.denylist.IsRevoked(ctx, c.Id, c.SessionId, c.UserId, time.Unix(c.IssuedAt, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return revoked
+	}
+
+	if c := claims(first); c.SessionId != first.RefreshToken || c.Id == "" || c.Id == claims(second).Id || c.IssuedAt == 0 {
+		t.Fatalf("claims = %+v, want the session id and a unique token id", c)
+	}
+	if err := f.service.Revoke(ctx, first.RefreshToken, first.User.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !revoked(first) || revoked(second) || revoked(third) {
+		t.Fatalf("revoked = %v, %v, %v, want only the first token", revoked(first), revoked(second), revoked(third))
+	}
+	if _, err := f.service.RevokeOthers(ctx, first.User.ID, third.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if !revoked(second) || revoked(third) {
+		t.Fatal("RevokeOthers() didn't deny only the other sessions")
+	}
+	if _, err := f.service.RevokeAll(ctx, first.User.ID, dtos.ActorDTO{Operator: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !revoked(third) {
+		t.Fatal("RevokeAll() didn't deny the current session")
+	}
+
+	blocked := f.verify(t, "blocked@hyperzoop.com")
+	if _, err := NewUserService(f.users, f.denylist).Block(ctx, blocked.User.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !revoked(blocked) {
+		t.Fatal("Block() didn't deny the user's tokens")
+	}
+}
+
+func TestAuthServiceIntrospect(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t)
+	user := f.verify(t, "user@hyperzoop.com")
+	admin := f.verify(t, "admin@hyperzoop.com")
+
+	out, err := f.service.Introspect(ctx, user.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Active || out.TokenType != dtos.TokenTypeAccess || out.Sub != user.User.ID || out.SessionId != user.RefreshToken || out.Scope != "user" || out.Exp == 0 || out.Jti == "" {
+		t.Fatalf("Introspect(access token) = %+v", out)
+	}
+	out, err = f.service.Introspect(ctx, admin.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Active || out.TokenType != dtos.TokenTypeRefresh || out.Sub != admin.User.ID || out.Scope != "user admin" || out.Exp != admin.ExpiresIn.Unix() {
+		t.Fatalf("Introspect(refresh token) = %+v", out)
+	}
+	for _, tok := range []string{"", "unknown", "a.b.c"} {
+		if out, err := f.service.Introspect(ctx, tok); err != nil || out.Active {
+			t.Fatalf("Introspect(%q) = %+v, %v, want inactive", tok, out, err)
+		}
+	}
+
+	f.clock.Advance(f.config.AccessTokenTTL + time.Minute)
+	if out, _ := f.service.Introspect(ctx, user.AccessToken); out.Active {
+		t.Fatal("Introspect() of an expired access token is active")
+	}
+	if out, _ := f.service.Introspect(ctx, user.RefreshToken); !out.Active {
+		t.Fatal("Introspect() of a live refresh token is inactive")
+	}
+}
+
+func TestAuthServiceRevokeToken(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t)
+	first := f.verify(t, "user@hyperzoop.com")
+	second := f.verify(t, "user@hyperzoop.com")
+
+	if err := f.service.RevokeToken(ctx, first.AccessToken, "gateway"); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := f.service.Introspect(ctx, first.AccessToken); out.Active {
+		t.Fatal("revoked access token is still active")
+	}
+	if out, _ := f.service.Introspect(ctx, first.RefreshToken); !out.Active {
+		t.Fatal("revoking an access token revoked its refresh token")
+	}
+
+	if err := f.service.RevokeToken(ctx, second.RefreshToken, "gateway"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range []string{second.RefreshToken, second.AccessToken} {
+		if out, _ := f.service.Introspect(ctx, tok); out.Active {
+			t.Fatalf("token %q of a revoked session is still active", tok)
+		}
+	}
+	if err := f.service.RevokeToken(ctx, "unknown", "gateway"); err != nil {
+		t.Fatalf("RevokeToken() of an unknown token error = %v", err)
+	}
+
+	if len(f.audit.events) != 2 || f.audit.events[0].Action != dtos.AuditTokenRevoked || f.audit.events[1].Actor.ClientId != "gateway" {
+		t.Fatalf("audit events = %+v", f.audit.events)
+	}
+}
+
+func TestAuthServiceSessionActivity(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t)
+	first := f.verifyFrom(t, "user@hyperzoop.com", "203.0.113.7")
+	f.clock.Advance(time.Minute)
+	second := f.verify(t, "user@hyperzoop.com")
+
+	stored, _ := f.sessions.One(ctx, first.RefreshToken)
+	if stored.UserAgent == nil || *stored.UserAgent != "test-agent" || stored.LastIp == nil || *stored.LastIp != "203.0.113.7" {
+		t.Fatalf("created session = %+v, want its user agent and address", stored)
+	}
+
+	f.clock.Advance(time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := f.service.Refresh(ctx, first.RefreshToken, "198.51.100.9", "test-agent"); err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+	}
+	if stored, _ := f.sessions.One(ctx, first.RefreshToken); stored.RefreshCount != 0 {
+		t.Fatalf("refreshes written before the flush: %d", stored.RefreshCount)
+	}
+	// the pending activity already puts the refreshed session first
+	sessions, err := f.service.Sessions(ctx, first.User.ID, second.RefreshToken)
+	if err != nil || len(sessions) != 2 || sessions[0].Id != first.RefreshToken || sessions[0].RefreshCount != 3 {
+		t.Fatalf("Sessions() = %+v, %v, want the refreshed session first", sessions, err)
+	}
+
+	if written, err := f.activity.Flush(ctx); err != nil || written != 1 {
+		t.Fatalf("Flush() = %d, %v, want 1 session written", written, err)
+	}
+	stored, _ = f.sessions.One(ctx, first.RefreshToken)
+	if stored.RefreshCount != 3 || !stored.LastUsedAt.Equal(f.clock.Now()) || *stored.LastIp != "198.51.100.9" {
+		t.Fatalf("flushed session = %+v", stored)
+	}
+	if written, _ := f.activity.Flush(ctx); written != 0 {
+		t.Fatalf("second Flush() wrote %d sessions", written)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestAuthServiceErrors(t *testing.T) {
+	ctx := context.Background()
+	f := newAuthFixture(t)
+	tests := []struct {
+		name       string
+		call       func() error
+		wantCode   string
+		wantStatus int
+	}{
+		{name: "refresh of an unknown session", call: func() error {
+			_, err := f.service.Refresh(ctx, "unknown", "", "")
+			return err
+		}, wantCode: "session_expired", wantStatus: http.StatusUnauthorized},
+		{name: "revoke of an unknown session", call: func() error {
+			return f.service.Revoke(ctx, "unknown", "user")
+		}, wantCode: "session_not_found", wantStatus: http.StatusNotFound},
+		{name: "invalid link", call: func() error {
+			_, err := f.service.Verify(ctx, "short", "short", "", "")
+			return err
+		}, wantCode: "invalid_link", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			var e *errs.Error
+			if !errors.As(err, &e) || e.Code != tt.wantCode || e.Status != tt.wantStatus {
+				t.Fatalf("error = %#v, want code %s and status %d", err, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+
+	_, err := f.service.Login(ctx, dtos.LoginInputDTO{Email: "user@hyperzoop.com", Username: ptr("no spaces")})
+	var fields validation.Errors
+	if !errors.As(err, &fields) || fields[0].Field != "username" {
+		t.Fatalf("Login() error = %#v, want the field errors", err)
+	}
+}
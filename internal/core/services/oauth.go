@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmjp/gopasswordless/internal/core/errs"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var errUnsupportedTokenType = errs.New("unsupported_token_type", http.StatusBadRequest, "access tokens can't be revoked without a denylist")
+
+// isAccessToken tells access tokens, which are JWTs, from refresh tokens, which
+// are session ids, so clients don't need to send a token_type_hint.
+func isAccessToken(tok string) bool {
+	return strings.Count(tok, ".") == 2
+}
+
+// Introspect describes tok as RFC 7662 asks. Invalid, expired and revoked
+// tokens, and the tokens of blocked users, are all just inactive.
+func (u *AuthService) Introspect(ctx context.Context, tok string) (out *dtos.IntrospectionOutputDTO, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.Introspect")
+	defer func() { telemetry.EndSpan(span, err) }()
+	if isAccessToken(tok) {
+		return u.introspectAccessToken(ctx, tok)
+	}
+	return u.introspectRefreshToken(ctx, tok)
+}
+
+func (u *AuthService) introspectAccessToken(ctx context.Context, tok string) (*dtos.IntrospectionOutputDTO, error) {
+	claims, err := token.ParseJwtAccessToken(u.keys, tok)
+	if err != nil || claims.Blocked || claims.ExpiresAt <= u.clock.Now().Unix() {
+		return &dtos.IntrospectionOutputDTO{}, nil
+	}
+	if u.denylist != nil {
+		revoked, err := u.denylist.IsRevoked(ctx, claims.Id, claims.SessionId, claims.UserId, time.Unix(claims.IssuedAt, 0))
+		if err != nil {
+			zap.L().Error("error checking the token denylist", zap.Error(err))
+			return nil, err
+		}
+		if revoked {
+			return &dtos.IntrospectionOutputDTO{}, nil
+		}
+	}
+	scope := claims.Scope
+	if scope == "" {
+		// issued before tokens carried their scope
+		scope = token.ScopeUser
+	}
+	return &dtos.IntrospectionOutputDTO{
+		Active:    true,
+		Scope:     scope,
+		Username:  claims.Email,
+		TokenType: dtos.TokenTypeAccess,
+		Exp:       claims.ExpiresAt,
+		Iat:       claims.IssuedAt,
+		Sub:       claims.UserId,
+		Jti:       claims.Id,
+		SessionId: claims.SessionId,
+	}, nil
+}
+
+func (u *AuthService) introspectRefreshToken(ctx context.Context, tok string) (*dtos.IntrospectionOutputDTO, error) {
+	if tok == "" {
+		return &dtos.IntrospectionOutputDTO{}, nil
+	}
+	session, err := u.sessionRepository.One(ctx, tok)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &dtos.IntrospectionOutputDTO{}, nil
+		}
+		zap.L().Error("error finding session", zap.Error(err))
+		return nil, err
+	}
+	if session.IsExpiredAt(u.clock.Now()) {
+		return &dtos.IntrospectionOutputDTO{}, nil
+	}
+	user, err := u.userRepository.FindById(ctx, session.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &dtos.IntrospectionOutputDTO{}, nil
+		}
+		zap.L().Error("error finding user", zap.Error(err))
+		return nil, err
+	}
+	if user.Blocked {
+		return &dtos.IntrospectionOutputDTO{}, nil
+	}
+	return &dtos.IntrospectionOutputDTO{
+		Active:    true,
+		Scope:     u.scope(user),
+		Username:  user.Email,
+		TokenType: dtos.TokenTypeRefresh,
+		Exp:       session.ValidUntil.Unix(),
+		Iat:       session.CreatedAt.Unix(),
+		Sub:       user.ID,
+		SessionId: session.Id,
+	}, nil
+}
+
+// RevokeToken revokes tok for the OAuth client clientId as RFC 7009 asks:
+// revoking a refresh token signs its session out along with its access
+// tokens, and tokens that are invalid or already gone are not an error.
+func (u *AuthService) RevokeToken(ctx context.Context, tok, clientId string) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "AuthService.RevokeToken")
+	defer func() { telemetry.EndSpan(span, err) }()
+	zap.L().Info("revoke token request", zap.String("client_id", clientId))
+	actor := dtos.ActorDTO{ClientId: clientId}
+	if isAccessToken(tok) {
+		claims, err := token.ParseJwtAccessToken(u.keys, tok)
+		if err != nil || claims.Id == "" {
+			// expired, forged or issued before tokens had an id
+			return nil
+		}
+		if u.denylist == nil {
+			return errUnsupportedTokenType
+		}
+		if err := u.denylist.RevokeToken(ctx, claims.Id); err != nil {
+			zap.L().Error("error revoking access token", zap.Error(err))
+			return err
+		}
+		u.recordAudit(ctx, &dtos.AuditEventDTO{Action: dtos.AuditTokenRevoked, Actor: actor, UserId: claims.UserId, SessionId: claims.SessionId, Count: 1})
+		return nil
+	}
+	if tok == "" {
+		return nil
+	}
+	session, err := u.sessionRepository.One(ctx, tok)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		zap.L().Error("error finding session", zap.Error(err))
+		return err
+	}
+	if err := u.sessionRepository.Disconnect(ctx, session.Id); err != nil && err != sql.ErrNoRows {
+		zap.L().Error("error disconnecting session", zap.Error(err))
+		return err
+	}
+	if err := u.denySessions(ctx, session.Id); err != nil {
+		return err
+	}
+	u.recordAudit(ctx, &dtos.AuditEventDTO{Action: dtos.AuditSessionRevoked, Actor: actor, UserId: session.UserId, SessionId: session.Id, Count: 1})
+	return nil
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// purgeBatchSize bounds each DELETE so purging a large backlog never holds long locks.
+const purgeBatchSize = 500
+
+// PurgeService removes magic links and sessions that can no longer be used.
+type PurgeService struct {
+	magicRepository   ports.MagicLinkRepository
+	sessionRepository ports.SessionRepository
+}
+
+func NewPurgeService(magicRepository ports.MagicLinkRepository, sessionRepository ports.SessionRepository) *PurgeService {
+	return &PurgeService{
+		magicRepository:   magicRepository,
+		sessionRepository: sessionRepository,
+	}
+}
+
+// PurgeExpired deletes, in batches, the used links and the links and sessions that expired before the given time.
+func (p *PurgeService) PurgeExpired(ctx context.Context, before time.Time) (out *dtos.PurgeOutputDTO, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "PurgeService.PurgeExpired")
+	defer func() { telemetry.EndSpan(span, err) }()
+	out = new(dtos.PurgeOutputDTO)
+	out.MagicLinks, err = purgeInBatches(ctx, before, p.magicRepository.DeleteExpired)
+	if err != nil {
+		zap.L().Error("error purging magic links", zap.Error(err))
+		return out, err
+	}
+	out.Sessions, err = purgeInBatches(ctx, before, p.sessionRepository.DeleteExpired)
+	if err != nil {
+		zap.L().Error("error purging sessions", zap.Error(err))
+		return out, err
+	}
+	zap.L().Info("purged expired rows", zap.Int64("magic_links", out.MagicLinks), zap.Int64("sessions", out.Sessions))
+	return out, nil
+}
+
+func purgeInBatches(ctx context.Context, before time.Time, deleteExpired func(context.Context, time.Time, int) (int64, error)) (total int64, err error) {
+	for {
+		deleted, err := deleteExpired(ctx, before, purgeBatchSize)
+		total += deleted
+		if err != nil || deleted < purgeBatchSize {
+			return total, err
+		}
+	}
+}
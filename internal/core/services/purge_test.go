@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	repositories "github.com/jmjp/gopasswordless/internal/adapters/repositories/memory"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/clock"
+	"testing"
+	"time"
+)
+
+// failingSessions fails to delete sessions after the first batch.
+type failingSessions struct {
+	*repositories.SessionMemoryRepository
+	calls int
+}
+
+func (r *failingSessions) DeleteExpired(ctx context.Context, before time.Time, limit int) (int64, error) {
+	r.calls++
+	if r.calls > 1 {
+		return 0, errors.New("database is down")
+	}
+	return r.SessionMemoryRepository.DeleteExpired(ctx, before, limit)
+}
+
+func purgeFixture(t *testing.T, expiredLinks, expiredSessions int) (*repositories.MagicLinkMemoryRepository, *repositories.SessionMemoryRepository, time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	links := repositories.NewMagicLinkMemoryRepository(clk)
+	sessions := repositories.NewSessionMemoryRepository(clk)
+	for i := 0; i < expiredLinks; i++ {
+		links.Create(ctx, &entities.MagicLink{Code: fmt.Sprintf("expired-%d", i), ValidUntil: now.Add(-time.Minute)})
+	}
+	links.Create(ctx, &entities.MagicLink{Code: "used", ValidUntil: now.Add(time.Hour), Used: true})
+	links.Create(ctx, &entities.MagicLink{Code: "valid", ValidUntil: now.Add(time.Hour)})
+	for i := 0; i < expiredSessions; i++ {
+		if _, err := sessions.Create(ctx, &entities.Session{UserId: "user", ValidUntil: now.Add(-time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := sessions.Create(ctx, &entities.Session{UserId: "user", ValidUntil: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	return links, sessions, now
+}
+
+func TestPurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	// more than two batches of links, exactly one batch of sessions
+	links, sessions, now := purgeFixture(t, 2*purgeBatchSize+1, purgeBatchSize)
+	out, err := NewPurgeService(links, sessions).PurgeExpired(ctx, now)
+	if err != nil {
+		t.Fatalf("PurgeExpired() error = %v", err)
+	}
+	if out.MagicLinks != 2*purgeBatchSize+2 || out.Sessions != purgeBatchSize {
+		t.Fatalf("PurgeExpired() = %+v, want every expired and used link and every expired session", out)
+	}
+	if _, err := links.FindValidByCode(ctx, "valid", ""); err != nil {
+		t.Fatalf("the valid link was purged: %v", err)
+	}
+	if all, _ := sessions.All(ctx, "user"); len(all) != 1 {
+		t.Fatalf("%d sessions left, want the valid one", len(all))
+	}
+
+	if out, err := NewPurgeService(links, sessions).PurgeExpired(ctx, now); err != nil || out.MagicLinks != 0 || out.Sessions != 0 {
+		t.Fatalf("PurgeExpired() again = %+v, %v, want nothing purged", out, err)
+	}
+}
+
+func TestPurgeExpiredReportsPartialCounts(t *testing.T) {
+	links, memorySessions, now := purgeFixture(t, 1, purgeBatchSize+1)
+	sessions := &failingSessions{SessionMemoryRepository: memorySessions}
+	out, err := NewPurgeService(links, sessions).PurgeExpired(context.Background(), now)
+	if err == nil {
+		t.Fatal("PurgeExpired() error = nil, want the failure of the second batch")
+	}
+	if out.MagicLinks != 2 || out.Sessions != purgeBatchSize {
+		t.Fatalf("PurgeExpired() = %+v, want the rows deleted before the failure", out)
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/useragent"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Risk signals and the score each one adds.
+const (
+	signalImpossibleTravel = "impossible_travel"
+	signalNewCountry       = "new_country"
+	signalNewNetwork       = "new_network"
+	signalNewUserAgent     = "new_user_agent"
+
+	earthRadiusKm = 6371.0
+)
+
+var signalScores = map[string]int{
+	signalImpossibleTravel: 60,
+	signalNewCountry:       30,
+	signalNewNetwork:       15,
+	signalNewUserAgent:     15,
+}
+
+// RiskPolicy maps scores to actions: a score reaching a threshold triggers its
+// action, the strictest one winning. A zero threshold disables the action.
+type RiskPolicy struct {
+	NotifyScore int
+	StepUpScore int
+	BlockScore  int
+	// MaxSpeed is the fastest believable travel between two sign-ins, in km/h.
+	MaxSpeed float64
+	// History is how many of the user's latest sessions are compared.
+	History int
+}
+
+// RiskEngine scores a sign-in against the user's recent sessions.
+type RiskEngine struct {
+	policy RiskPolicy
+}
+
+func NewRiskEngine(policy RiskPolicy) *RiskEngine {
+	return &RiskEngine{policy: policy}
+}
+
+// Evaluate compares the candidate session, located and carrying its user agent,
+// with the recent sessions of the same user. A refreshed session is compared
+// with its own earlier state too. Users without history are never flagged.
+func (e *RiskEngine) Evaluate(candidate *entities.Session, recent []*entities.Session, now time.Time) *dtos.RiskAssessmentDTO {
+	out := &dtos.RiskAssessmentDTO{Signals: []string{}, Action: dtos.RiskAllow}
+	recent = latestSessions(recent, e.policy.History)
+	if len(recent) == 0 {
+		return out
+	}
+
+	var last *entities.Session
+	for _, s := range recent {
+		if s.Latitude != nil && s.Longitude != nil && (last == nil || lastSeen(s).After(lastSeen(last))) {
+			last = s
+		}
+	}
+	if last != nil && candidate.Latitude != nil && candidate.Longitude != nil {
+		distance := haversineKm(*last.Latitude, *last.Longitude, *candidate.Latitude, *candidate.Longitude)
+		// a minute of slack so two sign-ins from the same city never count as travel
+		hours := math.Max(now.Sub(lastSeen(last)).Hours(), 1.0/60)
+		if distance/hours > e.policy.MaxSpeed {
+			out.Signals = append(out.Signals, signalImpossibleTravel)
+		}
+	}
+	out.Signals = append(out.Signals, unfamiliarSignals(candidate, recent)...)
+
+	for _, signal := range out.Signals {
+		out.Score += signalScores[signal]
+	}
+	out.Score = min(out.Score, 100)
+	switch {
+	case reached(out.Score, e.policy.BlockScore):
+		out.Action = dtos.RiskBlock
+	case reached(out.Score, e.policy.StepUpScore):
+		out.Action = dtos.RiskStepUp
+	case reached(out.Score, e.policy.NotifyScore):
+		out.Action = dtos.RiskNotify
+	}
+	return out
+}
+
+// unfamiliarSignals lists what the candidate session doesn't share with any of
+// the recent ones: its country, its network and its browser.
+func unfamiliarSignals(candidate *entities.Session, recent []*entities.Session) []string {
+	countries, networks, agents := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, s := range recent {
+		if s.Country != nil {
+			countries[*s.Country] = true
+		}
+		if s.OrganizationName != nil {
+			networks[*s.OrganizationName] = true
+		}
+		if s.UserAgent != nil {
+			agents[userAgentFamily(*s.UserAgent)] = true
+		}
+	}
+	var signals []string
+	if candidate.Country != nil && len(countries) > 0 && !countries[*candidate.Country] {
+		signals = append(signals, signalNewCountry)
+	}
+	if candidate.OrganizationName != nil && *candidate.OrganizationName != "" && len(networks) > 0 && !networks[*candidate.OrganizationName] {
+		signals = append(signals, signalNewNetwork)
+	}
+	if candidate.UserAgent != nil && *candidate.UserAgent != "" && len(agents) > 0 && !agents[userAgentFamily(*candidate.UserAgent)] {
+		signals = append(signals, signalNewUserAgent)
+	}
+	return signals
+}
+
+func reached(score, threshold int) bool {
+	return threshold > 0 && score >= threshold
+}
+
+// latestSessions returns up to limit sessions, most recently used first.
+func latestSessions(sessions []*entities.Session, limit int) []*entities.Session {
+	out := append([]*entities.Session(nil), sessions...)
+	sort.Slice(out, func(i, j int) bool { return lastSeen(out[i]).After(lastSeen(out[j])) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func lastSeen(s *entities.Session) time.Time {
+	seen := s.CreatedAt
+	for _, t := range []time.Time{s.UpdatedAt, s.LastUsedAt} {
+		if t.After(seen) {
+			seen = t
+		}
+	}
+	return seen
+}
+
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := toRad(lat2-lat1), toRad(lon2-lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// userAgentFamily reduces a user agent to its browser, so version updates
+// don't look like a new device. Unknown clients keep their product name.
+func userAgentFamily(ua string) string {
+	if browser := useragent.Parse(ua).Browser; browser != "" {
+		return browser
+	}
+	name, _, _ := strings.Cut(ua, "/")
+	return name
+}
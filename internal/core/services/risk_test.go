@@ -0,0 +1,87 @@
+package services
+
+import (
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func locatedSession(lat, long float64, country, isp, ua string, seen time.Time) *entities.Session {
+	s := entities.NewSession("user", seen.Add(24*time.Hour), &ua)
+	s.UpdateLocation(&lat, &long, nil, nil, nil, &country, &isp)
+	s.CreatedAt = seen
+	return s
+}
+
+func TestRiskEngineEvaluate(t *testing.T) {
+	now := time.Now()
+	const firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:122.0) Gecko/20100101 Firefox/122.0"
+	const chrome = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"
+	paris := func(seen time.Time) *entities.Session {
+		return locatedSession(48.85, 2.35, "FR", "Orange", firefox, seen)
+	}
+	engine := NewRiskEngine(RiskPolicy{NotifyScore: 15, StepUpScore: 40, BlockScore: 90, MaxSpeed: 900, History: 10})
+
+	tests := []struct {
+		name        string
+		candidate   *entities.Session
+		recent      []*entities.Session
+		wantSignals []string
+		wantAction  string
+	}{
+		{
+			name:        "first sign-in",
+			candidate:   locatedSession(40.71, -74.0, "US", "Verizon", chrome, now),
+			wantSignals: []string{},
+			wantAction:  dtos.RiskAllow,
+		},
+		{
+			name:        "same place and browser",
+			candidate:   paris(now),
+			recent:      []*entities.Session{paris(now.Add(-time.Hour))},
+			wantSignals: []string{},
+			wantAction:  dtos.RiskAllow,
+		},
+		{
+			name:        "new browser",
+			candidate:   locatedSession(48.85, 2.35, "FR", "Orange", chrome, now),
+			recent:      []*entities.Session{paris(now.Add(-time.Hour))},
+			wantSignals: []string{signalNewUserAgent},
+			wantAction:  dtos.RiskNotify,
+		},
+		{
+			name:        "reachable trip to a new country",
+			candidate:   locatedSession(51.51, -0.13, "GB", "Orange", firefox, now),
+			recent:      []*entities.Session{paris(now.Add(-5 * time.Hour))},
+			wantSignals: []string{signalNewCountry},
+			wantAction:  dtos.RiskNotify,
+		},
+		{
+			name:        "impossible travel",
+			candidate:   locatedSession(40.71, -74.0, "US", "Verizon", chrome, now),
+			recent:      []*entities.Session{paris(now.Add(-time.Hour))},
+			wantSignals: []string{signalImpossibleTravel, signalNewCountry, signalNewNetwork, signalNewUserAgent},
+			wantAction:  dtos.RiskBlock,
+		},
+		{
+			name:      "compares with the latest location only",
+			candidate: locatedSession(40.71, -74.0, "US", "Verizon", firefox, now),
+			recent: []*entities.Session{
+				paris(now.Add(-48 * time.Hour)),
+				locatedSession(40.73, -73.9, "US", "Verizon", firefox, now.Add(-time.Hour)),
+			},
+			wantSignals: []string{},
+			wantAction:  dtos.RiskAllow,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := engine.Evaluate(tt.candidate, tt.recent, now)
+			if !reflect.DeepEqual(got.Signals, tt.wantSignals) || got.Action != tt.wantAction {
+				t.Fatalf("Evaluate() = %+v, want signals %v and %s", got, tt.wantSignals, tt.wantAction)
+			}
+		})
+	}
+}
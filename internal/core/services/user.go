@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/ports"
+	"github.com/jmjp/gopasswordless/internal/infra/dtos"
+	"github.com/jmjp/gopasswordless/internal/infra/telemetry"
+	"github.com/jmjp/gopasswordless/internal/infra/validation"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// UserService holds the administrative operations on users.
+type UserService struct {
+	userRepository ports.UserRepository
+	denylist       ports.TokenDenylist
+}
+
+// NewUserService takes the denylist that revokes the access tokens of blocked
+// users; it may be nil, leaving them valid until they expire.
+func NewUserService(userRepository ports.UserRepository, denylist ports.TokenDenylist) *UserService {
+	return &UserService{
+		userRepository: userRepository,
+		denylist:       denylist,
+	}
+}
+
+func (u *UserService) Create(ctx context.Context, input dtos.LoginInputDTO) (user *entities.User, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "UserService.Create")
+	defer func() { telemetry.EndSpan(span, err) }()
+	zap.L().Info("create user request", zap.String("email", input.Email))
+	if err := validation.Struct(&input); err != nil {
+		return nil, err
+	}
+	userEntity, err := entities.NewUser(input.Email, input.Avatar, input.Username)
+	if err != nil {
+		return nil, invalidUser(err)
+	}
+	user, err = u.userRepository.Create(ctx, userEntity)
+	if err != nil {
+		zap.L().Error("error creating user", zap.Error(err))
+		return nil, errCreateUser
+	}
+	return user, nil
+}
+
+// Find looks the user up by email when idOrEmail contains an @, by id otherwise.
+func (u *UserService) Find(ctx context.Context, idOrEmail string) (user *entities.User, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "UserService.Find")
+	defer func() { telemetry.EndSpan(span, err) }()
+	if strings.Contains(idOrEmail, "@") {
+		// an invalid email is looked up as is and not found
+		if email, err := validation.NormalizeEmail(idOrEmail); err == nil {
+			idOrEmail = email
+		}
+		user, err = u.userRepository.FindByEmail(ctx, idOrEmail)
+	} else {
+		user, err = u.userRepository.FindById(ctx, idOrEmail)
+	}
+	if err == sql.ErrNoRows {
+		return nil, errUserNotFound
+	}
+	return user, err
+}
+
+func (u *UserService) Block(ctx context.Context, idOrEmail string) (*entities.User, error) {
+	return u.setBlocked(ctx, idOrEmail, true)
+}
+
+func (u *UserService) Unblock(ctx context.Context, idOrEmail string) (*entities.User, error) {
+	return u.setBlocked(ctx, idOrEmail, false)
+}
+
+func (u *UserService) setBlocked(ctx context.Context, idOrEmail string, blocked bool) (user *entities.User, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "UserService.setBlocked")
+	defer func() { telemetry.EndSpan(span, err) }()
+	zap.L().Info("block user request", zap.String("user", idOrEmail), zap.Bool("blocked", blocked))
+	user, err = u.Find(ctx, idOrEmail)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		user.Block()
+	} else {
+		user.Unblock()
+	}
+	if err := u.userRepository.Update(ctx, user); err != nil {
+		zap.L().Error("error updating user", zap.Error(err), zap.String("user_id", user.ID))
+		return nil, err
+	}
+	if blocked && u.denylist != nil {
+		if err := u.denylist.RevokeUser(ctx, user.ID, time.Now()); err != nil {
+			zap.L().Error("error revoking access tokens", zap.Error(err), zap.String("user_id", user.ID))
+			return nil, err
+		}
+	}
+	return user, nil
+}
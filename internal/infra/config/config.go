@@ -0,0 +1,396 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the application. Each field is read from the
+// optional config file and then from the environment (or .env) using the key in
+// its env tag, falling back to the default tag when neither provides it.
+type Config struct {
+	Env     string `env:"env" yaml:"env" toml:"env" default:"dev"`
+	Port    int    `env:"port" yaml:"port" toml:"port" default:"3000"`
+	LogFile string `env:"log_file" yaml:"log_file" toml:"log_file"`
+
+	DatabaseURL     string `env:"database_url" yaml:"database_url" toml:"database_url"`
+	DatabaseDialect string `env:"database_dialect" yaml:"database_dialect" toml:"database_dialect"`
+	AutoMigrate     bool   `env:"auto_migrate" yaml:"auto_migrate" toml:"auto_migrate"`
+	RedisURL        string `env:"redis_url" yaml:"redis_url" toml:"redis_url"`
+	MagicLinkStore  string `env:"magic_link_store" yaml:"magic_link_store" toml:"magic_link_store"`
+	SessionStore    string `env:"session_store" yaml:"session_store" toml:"session_store" default:"postgres"`
+
+	CacheRepositories bool          `env:"cache_repositories" yaml:"cache_repositories" toml:"cache_repositories" default:"true"`
+	UserCacheTTL      time.Duration `env:"user_cache_ttl" yaml:"user_cache_ttl" toml:"user_cache_ttl" default:"5m"`
+	// SessionActivityInterval is how often the refreshes counted in memory are written.
+	SessionActivityInterval time.Duration `env:"session_activity_interval" yaml:"session_activity_interval" toml:"session_activity_interval" default:"1m"`
+
+	AppHost       string   `env:"app_host" yaml:"app_host" toml:"app_host" default:"localhost"`
+	VerifyHost    string   `env:"verify_host" yaml:"verify_host" toml:"verify_host" default:"http://localhost:3000"`
+	SecureCookies bool     `env:"secure_cookies" yaml:"secure_cookies" toml:"secure_cookies"`
+	CORSOrigins   []string `env:"cors_origins" yaml:"cors_origins" toml:"cors_origins" default:"https://*.hyperzoop.com"`
+	// TrustedProxies lists the addresses or CIDRs of the proxies whose forwarding headers are believed.
+	TrustedProxies []string `env:"trusted_proxies" yaml:"trusted_proxies" toml:"trusted_proxies"`
+	// AdminEmails lists the users allowed to manage the sessions of anyone.
+	AdminEmails []string `env:"admin_emails" yaml:"admin_emails" toml:"admin_emails"`
+	// OAuthClients lists the client_id:client_secret pairs of the resource
+	// servers allowed to introspect and revoke tokens.
+	OAuthClients []string `env:"oauth_clients" yaml:"oauth_clients" toml:"oauth_clients"`
+
+	TokenSecret     string        `env:"token_secret" yaml:"token_secret" toml:"token_secret"`
+	TokenKeysFile   string        `env:"token_keys_file" yaml:"token_keys_file" toml:"token_keys_file"`
+	TokenKeysReload time.Duration `env:"token_keys_reload" yaml:"token_keys_reload" toml:"token_keys_reload" default:"1m"`
+	AccessTokenTTL  time.Duration `env:"access_token_ttl" yaml:"access_token_ttl" toml:"access_token_ttl" default:"15m"`
+	MagicLinkTTL    time.Duration `env:"magic_link_ttl" yaml:"magic_link_ttl" toml:"magic_link_ttl" default:"5m"`
+	SessionTTL      time.Duration `env:"session_ttl" yaml:"session_ttl" toml:"session_ttl" default:"24h"`
+	// TokenDenylistCacheSize is how many denylist answers each replica keeps in
+	// memory, TokenDenylistCacheTTL how long it trusts a token found valid.
+	TokenDenylistCacheSize int           `env:"token_denylist_cache_size" yaml:"token_denylist_cache_size" toml:"token_denylist_cache_size" default:"10000"`
+	TokenDenylistCacheTTL  time.Duration `env:"token_denylist_cache_ttl" yaml:"token_denylist_cache_ttl" toml:"token_denylist_cache_ttl" default:"5s"`
+
+	// MaxBodySize bounds the JSON bodies of requests, in bytes.
+	MaxBodySize           int  `env:"max_body_size" yaml:"max_body_size" toml:"max_body_size" default:"65536"`
+	DisallowUnknownFields bool `env:"disallow_unknown_fields" yaml:"disallow_unknown_fields" toml:"disallow_unknown_fields"`
+	// ProblemDetails answers errors with RFC 7807 bodies even to the clients
+	// that don't ask for them.
+	ProblemDetails bool `env:"problem_details" yaml:"problem_details" toml:"problem_details"`
+
+	RequestTimeout     time.Duration `env:"request_timeout" yaml:"request_timeout" toml:"request_timeout" default:"30s"`
+	ShutdownTimeout    time.Duration `env:"shutdown_timeout" yaml:"shutdown_timeout" toml:"shutdown_timeout" default:"1m"`
+	ShutdownDrainDelay time.Duration `env:"shutdown_drain_delay" yaml:"shutdown_drain_delay" toml:"shutdown_drain_delay" default:"5s"`
+	HealthCheckTimeout time.Duration `env:"health_check_timeout" yaml:"health_check_timeout" toml:"health_check_timeout" default:"2s"`
+
+	JanitorInterval time.Duration `env:"janitor_interval" yaml:"janitor_interval" toml:"janitor_interval" default:"10m"`
+	JanitorGrace    time.Duration `env:"janitor_grace" yaml:"janitor_grace" toml:"janitor_grace" default:"1h"`
+	JanitorLock     string        `env:"janitor_lock" yaml:"janitor_lock" toml:"janitor_lock" default:"redis"`
+
+	GeoIPProvider string        `env:"geoip_provider" yaml:"geoip_provider" toml:"geoip_provider" default:"http"`
+	GeoIPFile     string        `env:"geoip_file" yaml:"geoip_file" toml:"geoip_file"`
+	GeoIPASNFile  string        `env:"geoip_asn_file" yaml:"geoip_asn_file" toml:"geoip_asn_file"`
+	GeoIPReload   time.Duration `env:"geoip_reload" yaml:"geoip_reload" toml:"geoip_reload" default:"1m"`
+	GeoIPTimeout  time.Duration `env:"geoip_timeout" yaml:"geoip_timeout" toml:"geoip_timeout" default:"2s"`
+	GeoIPCacheTTL time.Duration `env:"geoip_cache_ttl" yaml:"geoip_cache_ttl" toml:"geoip_cache_ttl" default:"24h"`
+	DevGeoIP      string        `env:"dev_geo_ip" yaml:"dev_geo_ip" toml:"dev_geo_ip" default:"66.241.125.71"`
+
+	SMTPURL         string        `env:"smtp_url" yaml:"smtp_url" toml:"smtp_url"`
+	MailFrom        string        `env:"mail_from" yaml:"mail_from" toml:"mail_from" default:"HyperZoop <no-reply@hyperzoop.com>"`
+	NewDeviceAlerts bool          `env:"new_device_alerts" yaml:"new_device_alerts" toml:"new_device_alerts" default:"true"`
+	NotMeCooldown   time.Duration `env:"not_me_cooldown" yaml:"not_me_cooldown" toml:"not_me_cooldown" default:"1h"`
+
+	// Risk thresholds are scores between 1 and 100, 0 disabling the action.
+	RiskNotifyScore int `env:"risk_notify_score" yaml:"risk_notify_score" toml:"risk_notify_score" default:"0"`
+	RiskStepUpScore int `env:"risk_step_up_score" yaml:"risk_step_up_score" toml:"risk_step_up_score" default:"0"`
+	RiskBlockScore  int `env:"risk_block_score" yaml:"risk_block_score" toml:"risk_block_score" default:"0"`
+	RiskMaxSpeed    int `env:"risk_max_speed" yaml:"risk_max_speed" toml:"risk_max_speed" default:"900"`
+	RiskHistory     int `env:"risk_history" yaml:"risk_history" toml:"risk_history" default:"10"`
+
+	OtelExporter string `env:"otel_exporter" yaml:"otel_exporter" toml:"otel_exporter"`
+}
+
+// IsDev reports whether the application runs on a developer machine.
+func (c *Config) IsDev() bool {
+	return c.Env == "dev"
+}
+
+// TrustedProxyPrefixes parses trusted_proxies, a bare address standing for itself.
+func (c *Config) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, proxy := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted_proxies entry %q is not an address or CIDR", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// OAuthClientSecrets parses oauth_clients into the secret of every client id.
+func (c *Config) OAuthClientSecrets() (map[string]string, error) {
+	secrets := make(map[string]string, len(c.OAuthClients))
+	for _, client := range c.OAuthClients {
+		id, secret, ok := strings.Cut(client, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, errors.New("oauth_clients entries must look like client_id:client_secret")
+		}
+		if _, ok := secrets[id]; ok {
+			return nil, fmt.Errorf("oauth_clients lists client %q twice", id)
+		}
+		secrets[id] = secret
+	}
+	return secrets, nil
+}
+
+// Load reads the configuration from path, or from the file named by the
+// config_file variable when path is empty, then applies the environment and
+// defaults and validates the result. The file is optional and may be YAML or TOML.
+func Load(path string) (*Config, error) {
+	godotenv.Load()
+	if path == "" {
+		path = os.Getenv("config_file")
+	}
+	cfg := new(Config)
+	set, err := loadFile(path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadEnv(cfg, set); err != nil {
+		return nil, err
+	}
+	if err := loadDefaults(cfg, set); err != nil {
+		return nil, err
+	}
+	loadLegacy(cfg, set)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// RiskEnabled reports whether sign-ins are scored at all.
+func (c *Config) RiskEnabled() bool {
+	return c.RiskNotifyScore > 0 || c.RiskStepUpScore > 0 || c.RiskBlockScore > 0
+}
+
+// Validate reports every missing or inconsistent setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.DatabaseURL == "" {
+		errs = append(errs, errors.New("database_url is required (or the legacy dev_db/stagging_db/prod_db for the current env)"))
+	}
+	if c.RedisURL == "" {
+		errs = append(errs, errors.New("redis_url is required"))
+	}
+	if c.TokenSecret == "" && c.TokenKeysFile == "" {
+		errs = append(errs, errors.New("token_secret or token_keys_file is required"))
+	}
+	if c.DatabaseDialect != "" && c.DatabaseDialect != "postgres" && c.DatabaseDialect != "cockroach" {
+		errs = append(errs, fmt.Errorf("database_dialect %q must be postgres, cockroach or empty to detect it", c.DatabaseDialect))
+	}
+	if c.JanitorLock != "redis" && c.JanitorLock != "postgres" {
+		errs = append(errs, fmt.Errorf("janitor_lock %q must be redis or postgres", c.JanitorLock))
+	}
+	if c.JanitorInterval < 0 || c.JanitorGrace < 0 {
+		errs = append(errs, errors.New("janitor_interval and janitor_grace can't be negative"))
+	}
+	if c.MagicLinkStore != "postgres" && c.MagicLinkStore != "redis" {
+		errs = append(errs, fmt.Errorf("magic_link_store %q must be postgres or redis", c.MagicLinkStore))
+	}
+	if c.SessionStore != "postgres" && c.SessionStore != "redis" {
+		errs = append(errs, fmt.Errorf("session_store %q must be postgres or redis", c.SessionStore))
+	}
+	switch c.GeoIPProvider {
+	case "mmdb":
+		if c.GeoIPFile == "" {
+			errs = append(errs, errors.New("geoip_file is required when geoip_provider is mmdb"))
+		}
+	case "http", "none":
+	default:
+		errs = append(errs, fmt.Errorf("geoip_provider %q must be mmdb, http or none", c.GeoIPProvider))
+	}
+	if _, err := c.TrustedProxyPrefixes(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := c.OAuthClientSecrets(); err != nil {
+		errs = append(errs, err)
+	}
+	for key, score := range map[string]int{
+		"risk_notify_score":  c.RiskNotifyScore,
+		"risk_step_up_score": c.RiskStepUpScore,
+		"risk_block_score":   c.RiskBlockScore,
+	} {
+		if score < 0 || score > 100 {
+			errs = append(errs, fmt.Errorf("%s must be between 0 and 100", key))
+		}
+	}
+	if c.NewDeviceAlerts && c.RiskHistory <= 0 {
+		errs = append(errs, errors.New("risk_history must be greater than zero to detect new devices"))
+	}
+	if c.RiskEnabled() && (c.RiskMaxSpeed <= 0 || c.RiskHistory <= 0) {
+		errs = append(errs, errors.New("risk_max_speed and risk_history must be greater than zero"))
+	}
+	if c.TokenDenylistCacheSize < 0 {
+		errs = append(errs, errors.New("token_denylist_cache_size can't be negative"))
+	}
+	if c.MaxBodySize <= 0 {
+		errs = append(errs, errors.New("max_body_size must be greater than zero"))
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is out of range", c.Port))
+	}
+	for key, ttl := range map[string]time.Duration{
+		"access_token_ttl":          c.AccessTokenTTL,
+		"magic_link_ttl":            c.MagicLinkTTL,
+		"session_ttl":               c.SessionTTL,
+		"request_timeout":           c.RequestTimeout,
+		"shutdown_timeout":          c.ShutdownTimeout,
+		"health_check_timeout":      c.HealthCheckTimeout,
+		"token_keys_reload":         c.TokenKeysReload,
+		"user_cache_ttl":            c.UserCacheTTL,
+		"geoip_reload":              c.GeoIPReload,
+		"geoip_timeout":             c.GeoIPTimeout,
+		"geoip_cache_ttl":           c.GeoIPCacheTTL,
+		"not_me_cooldown":           c.NotMeCooldown,
+		"session_activity_interval": c.SessionActivityInterval,
+		"token_denylist_cache_ttl":  c.TokenDenylistCacheTTL,
+	} {
+		if ttl <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be greater than zero", key))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// loadFile decodes the config file into cfg and returns the keys it defined.
+func loadFile(path string, cfg *Config) (map[string]bool, error) {
+	set := make(map[string]bool)
+	if path == "" {
+		return set, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(content, cfg); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+		var keys map[string]any
+		if err := yaml.Unmarshal(content, &keys); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+		for key := range keys {
+			set[key] = true
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(content), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+		for _, key := range meta.Keys() {
+			set[key.String()] = true
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	return set, nil
+}
+
+// loadEnv overrides cfg with every variable present in the environment.
+func loadEnv(cfg *Config, set map[string]bool) error {
+	return eachField(cfg, func(key string, field reflect.StructField, value reflect.Value) error {
+		raw, ok := os.LookupEnv(key)
+		if !ok {
+			return nil
+		}
+		set[key] = true
+		return setField(key, value, raw)
+	})
+}
+
+func loadDefaults(cfg *Config, set map[string]bool) error {
+	return eachField(cfg, func(key string, field reflect.StructField, value reflect.Value) error {
+		raw, ok := field.Tag.Lookup("default")
+		if !ok || set[key] {
+			return nil
+		}
+		return setField(key, value, raw)
+	})
+}
+
+// loadLegacy derives settings from the variables used before this package existed.
+func loadLegacy(cfg *Config, set map[string]bool) {
+	if !set["database_url"] {
+		switch cfg.Env {
+		case "prod":
+			cfg.DatabaseURL = os.Getenv("prod_db")
+		case "stagging":
+			cfg.DatabaseURL = os.Getenv("stagging_db")
+		default:
+			cfg.DatabaseURL = os.Getenv("dev_db")
+		}
+	}
+	if !set["secure_cookies"] {
+		if environment, ok := os.LookupEnv("environment"); ok {
+			cfg.SecureCookies = environment == "prod"
+		} else {
+			cfg.SecureCookies = cfg.Env == "prod"
+		}
+	}
+	if !set["magic_link_store"] {
+		cfg.MagicLinkStore = "postgres"
+		if cfg.Env == "prod" {
+			cfg.MagicLinkStore = "redis"
+		}
+	}
+}
+
+func eachField(cfg *Config, fn func(key string, field reflect.StructField, value reflect.Value) error) error {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		if err := fn(key, t.Field(i), v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setField(key string, value reflect.Value, raw string) error {
+	switch value.Interface().(type) {
+	case string:
+		value.SetString(raw)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", key, raw)
+		}
+		value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", key, raw)
+		}
+		value.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration such as 30s or 5m", key, raw)
+		}
+		value.SetInt(int64(d))
+	case []string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s: unsupported setting type %s", key, value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable Load reads for the duration of the test.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	keys := []string{"config_file", "prod_db", "stagging_db", "dev_db", "environment"}
+	eachField(new(Config), func(key string, _ reflect.StructField, _ reflect.Value) error {
+		keys = append(keys, key)
+		return nil
+	})
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func setEnv(t *testing.T, vars map[string]string) {
+	t.Helper()
+	for key, value := range vars {
+		t.Setenv(key, value)
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var required = map[string]string{
+	"database_url": "postgres://localhost/hyperzoop",
+	"redis_url":    "redis://localhost:6379",
+	"token_secret": "secret",
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+	setEnv(t, required)
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Env != "dev" || cfg.Port != 3000 || cfg.SessionTTL != 24*time.Hour || cfg.SessionStore != "postgres" {
+		t.Fatalf("Load() = %+v, want the defaults", cfg)
+	}
+	if !reflect.DeepEqual(cfg.CORSOrigins, []string{"https://*.hyperzoop.com"}) {
+		t.Fatalf("CORSOrigins = %q", cfg.CORSOrigins)
+	}
+	if cfg.RiskEnabled() {
+		t.Fatal("RiskEnabled() = true, want risk scoring off by default")
+	}
+	if cfg.MagicLinkStore != "postgres" || cfg.SecureCookies {
+		t.Fatalf("MagicLinkStore = %q, SecureCookies = %v, want postgres and false in dev", cfg.MagicLinkStore, cfg.SecureCookies)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	files := map[string]string{
+		"hyperzoop.yaml": "port: 4000\nsession_ttl: 1h\nmagic_link_ttl: 2m\nadmin_emails: [admin@hyperzoop.com]\n",
+		"hyperzoop.toml": "port = 4000\nsession_ttl = \"1h\"\nmagic_link_ttl = \"2m\"\nadmin_emails = [\"admin@hyperzoop.com\"]\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			clearEnv(t)
+			setEnv(t, required)
+			// the environment overrides the file, which overrides the defaults
+			setEnv(t, map[string]string{"magic_link_ttl": "30s"})
+			cfg, err := Load(writeFile(t, name, content))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Port != 4000 || cfg.SessionTTL != time.Hour {
+				t.Fatalf("Port = %d, SessionTTL = %s, want those of the file", cfg.Port, cfg.SessionTTL)
+			}
+			if cfg.MagicLinkTTL != 30*time.Second {
+				t.Fatalf("MagicLinkTTL = %s, want the one of the environment", cfg.MagicLinkTTL)
+			}
+			if !reflect.DeepEqual(cfg.AdminEmails, []string{"admin@hyperzoop.com"}) {
+				t.Fatalf("AdminEmails = %q", cfg.AdminEmails)
+			}
+			if cfg.AccessTokenTTL != 15*time.Minute {
+				t.Fatalf("AccessTokenTTL = %s, want the default", cfg.AccessTokenTTL)
+			}
+		})
+	}
+}
+
+func TestLoadFileFromEnvironment(t *testing.T) {
+	clearEnv(t)
+	setEnv(t, required)
+	t.Setenv("config_file", writeFile(t, "hyperzoop.yml", "port: 4000\n"))
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Port != 4000 {
+		t.Fatalf("Port = %d, want the one of config_file", cfg.Port)
+	}
+}
+
+func TestLoadFileWinsOverZeroDefaults(t *testing.T) {
+	clearEnv(t)
+	setEnv(t, required)
+	// a key set to its zero value in the file is not replaced by the default
+	cfg, err := Load(writeFile(t, "hyperzoop.yaml", "cache_repositories: false\n"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.CacheRepositories {
+		t.Fatal("CacheRepositories = true, want the false of the file")
+	}
+}
+
+func TestLoadLegacy(t *testing.T) {
+	tests := []struct {
+		name            string
+		env             map[string]string
+		file            string
+		wantDatabaseURL string
+		wantSecure      bool
+		wantStore       string
+	}{
+		{
+			name:            "dev database",
+			env:             map[string]string{"dev_db": "postgres://dev", "prod_db": "postgres://prod"},
+			wantDatabaseURL: "postgres://dev",
+			wantStore:       "postgres",
+		},
+		{
+			name:            "prod database",
+			env:             map[string]string{"env": "prod", "dev_db": "postgres://dev", "prod_db": "postgres://prod"},
+			wantDatabaseURL: "postgres://prod",
+			wantSecure:      true,
+			wantStore:       "redis",
+		},
+		{
+			name:            "stagging database",
+			env:             map[string]string{"env": "stagging", "stagging_db": "postgres://stagging"},
+			wantDatabaseURL: "postgres://stagging",
+			wantStore:       "postgres",
+		},
+		{
+			name:            "database_url wins",
+			env:             map[string]string{"database_url": "postgres://new", "dev_db": "postgres://dev"},
+			wantDatabaseURL: "postgres://new",
+			wantStore:       "postgres",
+		},
+		{
+			name:            "database_url of the file wins",
+			env:             map[string]string{"dev_db": "postgres://dev"},
+			file:            "database_url: postgres://file\n",
+			wantDatabaseURL: "postgres://file",
+			wantStore:       "postgres",
+		},
+		{
+			name:            "environment sets secure cookies",
+			env:             map[string]string{"dev_db": "postgres://dev", "environment": "prod"},
+			wantDatabaseURL: "postgres://dev",
+			wantSecure:      true,
+			wantStore:       "postgres",
+		},
+		{
+			name:            "environment unsets secure cookies",
+			env:             map[string]string{"env": "prod", "prod_db": "postgres://prod", "environment": "dev"},
+			wantDatabaseURL: "postgres://prod",
+			wantStore:       "redis",
+		},
+		{
+			name:            "explicit settings win",
+			env:             map[string]string{"env": "prod", "prod_db": "postgres://prod", "environment": "prod", "secure_cookies": "false", "magic_link_store": "postgres"},
+			wantDatabaseURL: "postgres://prod",
+			wantStore:       "postgres",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			setEnv(t, map[string]string{"redis_url": required["redis_url"], "token_secret": required["token_secret"]})
+			setEnv(t, tt.env)
+			path := ""
+			if tt.file != "" {
+				path = writeFile(t, "hyperzoop.yaml", tt.file)
+			}
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.DatabaseURL != tt.wantDatabaseURL || cfg.SecureCookies != tt.wantSecure || cfg.MagicLinkStore != tt.wantStore {
+				t.Fatalf("DatabaseURL = %q, SecureCookies = %v, MagicLinkStore = %q, want %q, %v, %q",
+					cfg.DatabaseURL, cfg.SecureCookies, cfg.MagicLinkStore, tt.wantDatabaseURL, tt.wantSecure, tt.wantStore)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		file string
+		want string
+	}{
+		{name: "number", env: map[string]string{"port": "http"}, want: `port: "http" is not a number`},
+		{name: "boolean", env: map[string]string{"auto_migrate": "sometimes"}, want: `auto_migrate: "sometimes" is not a boolean`},
+		{name: "duration", env: map[string]string{"session_ttl": "1 day"}, want: `session_ttl: "1 day" is not a duration`},
+		{name: "file format", file: "hyperzoop.json", want: "unsupported config file format"},
+		{name: "file syntax", file: "hyperzoop.yaml", want: "parsing config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			setEnv(t, required)
+			setEnv(t, tt.env)
+			path := ""
+			if tt.file != "" {
+				path = writeFile(t, tt.file, "port: [")
+			}
+			_, err := Load(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	clearEnv(t)
+	setEnv(t, map[string]string{
+		"database_dialect":   "mysql",
+		"session_store":      "memcached",
+		"janitor_lock":       "etcd",
+		"geoip_provider":     "mmdb",
+		"trusted_proxies":    "10.0.0.0/33",
+		"oauth_clients":      "billing",
+		"risk_notify_score":  "101",
+		"risk_max_speed":     "0",
+		"max_body_size":      "0",
+		"port":               "70000",
+		"session_ttl":        "0s",
+		"janitor_grace":      "-1m",
+		"risk_history":       "0",
+		"token_keys_reload":  "-1s",
+		"new_device_alerts":  "false",
+		"risk_step_up_score": "-1",
+	})
+	_, err := Load("")
+	if err == nil {
+		t.Fatal("Load() error = nil, want the validation errors")
+	}
+	// every error is reported at once
+	for _, want := range []string{
+		"database_url is required",
+		"redis_url is required",
+		"token_secret or token_keys_file is required",
+		`database_dialect "mysql"`,
+		`session_store "memcached"`,
+		`janitor_lock "etcd"`,
+		"janitor_interval and janitor_grace can't be negative",
+		"geoip_file is required when geoip_provider is mmdb",
+		`trusted_proxies entry "10.0.0.0/33"`,
+		"oauth_clients entries must look like client_id:client_secret",
+		"risk_notify_score must be between 0 and 100",
+		"risk_step_up_score must be between 0 and 100",
+		"risk_max_speed and risk_history must be greater than zero",
+		"max_body_size must be greater than zero",
+		"port 70000 is out of range",
+		"session_ttl must be greater than zero",
+		"token_keys_reload must be greater than zero",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error misses %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateNewDeviceAlerts(t *testing.T) {
+	clearEnv(t)
+	setEnv(t, required)
+	t.Setenv("risk_history", "0")
+	_, err := Load("")
+	if err == nil || !strings.Contains(err.Error(), "risk_history must be greater than zero to detect new devices") {
+		t.Fatalf("Load() error = %v, want risk_history to be required by new_device_alerts", err)
+	}
+}
+
+func TestRiskEnabled(t *testing.T) {
+	tests := []struct {
+		cfg  Config
+		want bool
+	}{
+		{Config{}, false},
+		{Config{RiskNotifyScore: 30}, true},
+		{Config{RiskStepUpScore: 60}, true},
+		{Config{RiskBlockScore: 90}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.RiskEnabled(); got != tt.want {
+			t.Errorf("RiskEnabled() of %+v = %v, want %v", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestTrustedProxyPrefixes(t *testing.T) {
+	cfg := Config{TrustedProxies: []string{"10.0.0.1", "::ffff:192.168.1.1", "172.16.5.0/12"}}
+	prefixes, err := cfg.TrustedProxyPrefixes()
+	if err != nil {
+		t.Fatalf("TrustedProxyPrefixes() error = %v", err)
+	}
+	var got []string
+	for _, prefix := range prefixes {
+		got = append(got, prefix.String())
+	}
+	want := []string{"10.0.0.1/32", "192.168.1.1/32", "172.16.0.0/12"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("TrustedProxyPrefixes() = %q, want %q", got, want)
+	}
+}
+
+func TestOAuthClientSecrets(t *testing.T) {
+	cfg := Config{OAuthClients: []string{"billing:s3cret", "search:other:colon"}}
+	secrets, err := cfg.OAuthClientSecrets()
+	if err != nil {
+		t.Fatalf("OAuthClientSecrets() error = %v", err)
+	}
+	if want := map[string]string{"billing": "s3cret", "search": "other:colon"}; !reflect.DeepEqual(secrets, want) {
+		t.Fatalf("OAuthClientSecrets() = %v, want %v", secrets, want)
+	}
+	cfg.OAuthClients = append(cfg.OAuthClients, "billing:again")
+	if _, err := cfg.OAuthClientSecrets(); err == nil || !strings.Contains(err.Error(), `client "billing" twice`) {
+		t.Fatalf("OAuthClientSecrets() error = %v, want the duplicate client", err)
+	}
+}
@@ -0,0 +1,33 @@
+package dtos
+
+import "time"
+
+// Audited actions.
+const (
+	AuditSessionRevoked       = "session.revoked"
+	AuditSessionReported      = "session.reported"
+	AuditOtherSessionsRevoked = "sessions.revoked_others"
+	AuditAllSessionsRevoked   = "sessions.revoked_all"
+	AuditTokenRevoked         = "token.revoked"
+)
+
+// ActorDTO is who asks for an operation: a signed-in user, an OAuth client
+// or the operator running the administrative commands, who is trusted.
+type ActorDTO struct {
+	UserId   string `json:"user_id,omitempty"`
+	ClientId string `json:"client_id,omitempty"`
+	Operator bool   `json:"operator,omitempty"`
+}
+
+type AuditEventDTO struct {
+	Action    string    `json:"action"`
+	Actor     ActorDTO  `json:"actor"`
+	UserId    string    `json:"user_id"`
+	SessionId string    `json:"session_id,omitempty"`
+	Count     int64     `json:"count,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+type RevokeOutputDTO struct {
+	Revoked int64 `json:"revoked"`
+}
@@ -1,14 +1,14 @@
 package dtos
 
 import (
-	"hyperzoop/internal/core/entities"
+	"github.com/jmjp/gopasswordless/internal/core/entities"
 	"time"
 )
 
 type LoginInputDTO struct {
-	Email    string  `json:"email"`
-	Username *string `json:"username"`
-	Avatar   *string `json:"avatar"`
+	Email    string  `json:"email" validate:"required,email"`
+	Username *string `json:"username" validate:"min=3,max=64,username"`
+	Avatar   *string `json:"avatar" validate:"max=2048,url"`
 }
 
 type LoginOutputDTO struct {
@@ -23,6 +23,16 @@ type VerifyOutputDTO struct {
 	AccessToken  string         `json:"access_token"`
 	RefreshToken string         `json:"refresh_token"`
 	ExpiresIn    time.Time      `json:"expires_in"`
+	// StepUp is set instead of the tokens when the sign-in must be confirmed
+	// with the link it holds.
+	StepUp *LoginOutputDTO `json:"-"`
+}
+
+// SignInOutputDTO is the body of a verified sign-in, whose refresh token is
+// only sent as the _refresh cookie.
+type SignInOutputDTO struct {
+	User        *entities.User `json:"user"`
+	AccessToken string         `json:"access_token"`
 }
 
 type RefreshOutputDTO struct {
@@ -0,0 +1,11 @@
+package dtos
+
+type GeoLocationOutputDTO struct {
+	Ip               string  `json:"ip"`
+	Latitude         float64 `json:"latitude"`
+	Longitude        float64 `json:"longitude"`
+	City             *string `json:"city"`
+	Region           *string `json:"region"`
+	Country          string  `json:"country"`
+	OrganizationName string  `json:"organization_name"`
+}
@@ -0,0 +1,27 @@
+package dtos
+
+// Token types, as named by the token_type_hint of RFC 7009 and RFC 7662.
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// IntrospectionOutputDTO is the RFC 7662 introspection response. Inactive
+// tokens only have Active set, whatever the reason.
+type IntrospectionOutputDTO struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	SessionId string `json:"sid,omitempty"`
+}
+
+// OAuthErrorOutputDTO is the error response of RFC 6749 section 5.2.
+type OAuthErrorOutputDTO struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
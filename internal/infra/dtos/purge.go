@@ -0,0 +1,6 @@
+package dtos
+
+type PurgeOutputDTO struct {
+	MagicLinks int64 `json:"magic_links"`
+	Sessions   int64 `json:"sessions"`
+}
@@ -0,0 +1,27 @@
+package dtos
+
+import "github.com/jmjp/gopasswordless/internal/infra/validation"
+
+// ErrorOutputDTO is the body of failed requests. Code is stable, unlike
+// Message, and Errors lists what was wrong with the body of a 422.
+type ErrorOutputDTO struct {
+	Message    string            `json:"message"`
+	StatusCode string            `json:"status_code"`
+	Code       string            `json:"code,omitempty"`
+	Errors     validation.Errors `json:"errors,omitempty"`
+}
+
+// ProblemOutputDTO is ErrorOutputDTO as RFC 7807 problem details, with the
+// code and the field errors as extension members.
+type ProblemOutputDTO struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code"`
+	Errors   validation.Errors `json:"errors,omitempty"`
+}
+
+type MessageOutputDTO struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,15 @@
+package dtos
+
+// Risk actions, from the mildest to the strictest.
+const (
+	RiskAllow  = "allow"
+	RiskNotify = "notify"
+	RiskStepUp = "step_up"
+	RiskBlock  = "block"
+)
+
+type RiskAssessmentDTO struct {
+	Score   int      `json:"score"`
+	Signals []string `json:"signals"`
+	Action  string   `json:"action"`
+}
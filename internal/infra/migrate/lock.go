@@ -0,0 +1,82 @@
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// lockKey identifies the Postgres advisory lock shared by every replica.
+	lockKey = 4_738_221_905
+	// lockTable and lockLease back the lock on CockroachDB, which has no advisory locks.
+	lockTable     = revisionsSchema + ".hyperzoop_migration_lock"
+	lockLease     = 10 * time.Minute
+	lockRetryWait = time.Second
+)
+
+// withLock runs fn while holding the migration lock, so replicas starting
+// together don't apply the same migrations concurrently.
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	if m.dialect == DialectCockroach {
+		return m.withLeaseLock(ctx, fn)
+	}
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			zap.L().Error("error releasing migration lock", zap.Error(err))
+		}
+	}()
+	return fn(ctx)
+}
+
+// withLeaseLock emulates the advisory lock with a single row that expires, so
+// a replica killed while migrating doesn't block the others forever.
+func (m *Migrator) withLeaseLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	for _, statement := range []string{
+		"CREATE SCHEMA IF NOT EXISTS " + revisionsSchema,
+		"CREATE TABLE IF NOT EXISTS " + lockTable + " (id int PRIMARY KEY, owner text NOT NULL, expires_at timestamp with time zone NOT NULL)",
+	} {
+		if _, err := m.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	owner := hex.EncodeToString(buf)
+	for {
+		res, err := m.db.ExecContext(ctx, `INSERT INTO `+lockTable+` AS lock (id, owner, expires_at) VALUES (1, $1, now() + $2 * interval '1 second')
+			ON CONFLICT (id) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at WHERE lock.expires_at < now()`,
+			owner, int(lockLease.Seconds()))
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			break
+		}
+		zap.L().Info("waiting for migration lock")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryWait):
+		}
+	}
+	defer func() {
+		if _, err := m.db.ExecContext(context.WithoutCancel(ctx), "DELETE FROM "+lockTable+" WHERE id = 1 AND owner = $1", owner); err != nil {
+			zap.L().Error("error releasing migration lock", zap.Error(err))
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,336 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmjp/gopasswordless/migrations"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+const (
+	DialectPostgres  = "postgres"
+	DialectCockroach = "cockroach"
+)
+
+// revisionsTable is where Atlas records applied versions, so databases migrated
+// with the atlas CLI are recognized as up to date and vice versa.
+const (
+	revisionsSchema = "atlas_schema_revisions"
+	revisionsTable  = revisionsSchema + ".atlas_schema_revisions"
+	operatorVersion = "hyperzoop"
+	// revisionTypeExecute matches Atlas' RevisionTypeExecute.
+	revisionTypeExecute = 2
+)
+
+const (
+	StateApplied  = "applied"
+	StatePending  = "pending"
+	StatePartial  = "partial"
+	StateModified = "modified"
+)
+
+var (
+	errUnknownDialect  = errors.New("unknown migration dialect")
+	errDirtyDatabase   = errors.New("a previous migration failed halfway, fix it and resume with migrate up")
+	errMissingDownFile = errors.New("migration has no down file to roll it back")
+)
+
+// Migration is a versioned file of the embedded directory.
+type Migration struct {
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Name        string `json:"name"`
+	Hash        string `json:"hash"`
+}
+
+// Status describes a migration as seen by the database.
+type Status struct {
+	Migration
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type revision struct {
+	version    string
+	applied    int
+	total      int
+	executedAt time.Time
+	hash       string
+	err        sql.NullString
+}
+
+// Migrator applies and rolls back the migrations embedded in the binary. Down
+// files live in a "down" subdirectory, which the atlas CLI ignores.
+type Migrator struct {
+	db      *sql.DB
+	dialect string
+	dir     fs.FS
+}
+
+func NewMigrator(db *sql.DB, dialect string) (*Migrator, error) {
+	if dialect != DialectPostgres && dialect != DialectCockroach {
+		return nil, fmt.Errorf("%w: %q", errUnknownDialect, dialect)
+	}
+	dir, err := fs.Sub(migrations.FS, dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, dir: dir}, nil
+}
+
+// NewMigratorFor creates a migrator for dialect, asking the database when it is empty.
+func NewMigratorFor(ctx context.Context, db *sql.DB, dialect string) (*Migrator, error) {
+	if dialect == "" {
+		detected, err := DetectDialect(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		dialect = detected
+	}
+	return NewMigrator(db, dialect)
+}
+
+// DetectDialect asks the server which engine it runs, since CockroachDB speaks the Postgres protocol.
+func DetectDialect(ctx context.Context, db *sql.DB) (string, error) {
+	var version string
+	if err := db.QueryRowContext(ctx, "SELECT version()").Scan(&version); err != nil {
+		return "", err
+	}
+	if strings.Contains(version, "CockroachDB") {
+		return DialectCockroach, nil
+	}
+	return DialectPostgres, nil
+}
+
+func (m *Migrator) Dialect() string {
+	return m.dialect
+}
+
+// Migrations returns the embedded migrations in order, after checking them against atlas.sum.
+func (m *Migrator) Migrations() ([]Migration, error) {
+	sum, err := verifySum(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, file := range sum.files {
+		version, description, _ := strings.Cut(strings.TrimSuffix(file.name, ".sql"), "_")
+		out = append(out, Migration{Version: version, Description: description, Name: file.name, Hash: file.hash})
+	}
+	return out, nil
+}
+
+// Status reports the state of every embedded migration in the database.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	files, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := m.revisions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []Status
+	for _, file := range files {
+		status := Status{Migration: file, State: StatePending}
+		if rev, ok := revisions[file.Version]; ok {
+			executedAt := rev.executedAt
+			status.AppliedAt = &executedAt
+			status.Error = rev.err.String
+			switch {
+			case rev.applied < rev.total || rev.err.Valid:
+				status.State = StatePartial
+			case rev.hash != file.Hash:
+				status.State = StateModified
+			default:
+				status.State = StateApplied
+			}
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
+
+// Pending returns the versions that were not fully applied to the database.
+func (m *Migrator) Pending(ctx context.Context) ([]string, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, status := range statuses {
+		if status.State == StatePending || status.State == StatePartial {
+			pending = append(pending, status.Version)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in order while holding the migration lock,
+// resuming a partially applied one where it stopped. It returns the versions applied.
+func (m *Migrator) Up(ctx context.Context) (applied []string, err error) {
+	err = m.withLock(ctx, func(ctx context.Context) error {
+		if err := m.ensureRevisionsTable(ctx); err != nil {
+			return err
+		}
+		files, err := m.Migrations()
+		if err != nil {
+			return err
+		}
+		revisions, err := m.revisions(ctx)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			rev, ok := revisions[file.Version]
+			if ok && rev.applied >= rev.total && !rev.err.Valid {
+				continue
+			}
+			start := 0
+			if ok {
+				start = rev.applied
+			}
+			if err := m.apply(ctx, file, start); err != nil {
+				return err
+			}
+			applied = append(applied, file.Version)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations using their down files. It returns the versions rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) (rolledBack []string, err error) {
+	err = m.withLock(ctx, func(ctx context.Context) error {
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(statuses) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			status := statuses[i]
+			if status.State == StatePending {
+				continue
+			}
+			if status.State == StatePartial {
+				return fmt.Errorf("migration %s: %w", status.Version, errDirtyDatabase)
+			}
+			if err := m.rollback(ctx, status.Migration); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, status.Version)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+func (m *Migrator) apply(ctx context.Context, file Migration, start int) error {
+	content, err := fs.ReadFile(m.dir, file.Name)
+	if err != nil {
+		return err
+	}
+	statements := splitStatements(string(content))
+	executedAt := time.Now()
+	zap.L().Info("applying migration", zap.String("version", file.Version), zap.Int("statements", len(statements)), zap.Int("resume_at", start))
+	for i := start; i < len(statements); i++ {
+		if _, err := m.db.ExecContext(ctx, statements[i]); err != nil {
+			if writeErr := m.writeRevision(ctx, file, i, len(statements), executedAt, err, statements[i]); writeErr != nil {
+				zap.L().Error("error recording failed migration", zap.Error(writeErr), zap.String("version", file.Version))
+			}
+			return fmt.Errorf("migration %s statement %d: %w", file.Version, i+1, err)
+		}
+	}
+	return m.writeRevision(ctx, file, len(statements), len(statements), executedAt, nil, "")
+}
+
+func (m *Migrator) rollback(ctx context.Context, file Migration) error {
+	content, err := fs.ReadFile(m.dir, path.Join("down", file.Name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("migration %s: %w", file.Version, errMissingDownFile)
+		}
+		return err
+	}
+	zap.L().Info("rolling back migration", zap.String("version", file.Version))
+	for i, statement := range splitStatements(string(content)) {
+		if _, err := m.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("rollback %s statement %d: %w", file.Version, i+1, err)
+		}
+	}
+	_, err = m.db.ExecContext(ctx, "DELETE FROM "+revisionsTable+" WHERE version = $1", file.Version)
+	return err
+}
+
+func (m *Migrator) ensureRevisionsTable(ctx context.Context) error {
+	statements := []string{
+		"CREATE SCHEMA IF NOT EXISTS " + revisionsSchema,
+		`CREATE TABLE IF NOT EXISTS ` + revisionsTable + ` (
+			version character varying NOT NULL PRIMARY KEY,
+			description character varying NOT NULL,
+			type bigint NOT NULL DEFAULT 2,
+			applied bigint NOT NULL DEFAULT 0,
+			total bigint NOT NULL DEFAULT 0,
+			executed_at timestamp with time zone NOT NULL,
+			execution_time bigint NOT NULL,
+			error text NULL,
+			error_stmt text NULL,
+			hash character varying NOT NULL,
+			partial_hashes jsonb NULL,
+			operator_version character varying NOT NULL
+		)`,
+	}
+	for _, statement := range statements {
+		if _, err := m.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) writeRevision(ctx context.Context, file Migration, applied, total int, executedAt time.Time, execErr error, errStmt string) error {
+	var errText, errStatement sql.NullString
+	if execErr != nil {
+		errText = sql.NullString{String: execErr.Error(), Valid: true}
+		errStatement = sql.NullString{String: errStmt, Valid: true}
+	}
+	_, err := m.db.ExecContext(ctx, `INSERT INTO `+revisionsTable+` (version, description, type, applied, total, executed_at, execution_time, error, error_stmt, hash, operator_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (version) DO UPDATE SET applied = excluded.applied, total = excluded.total, executed_at = excluded.executed_at,
+			execution_time = excluded.execution_time, error = excluded.error, error_stmt = excluded.error_stmt, hash = excluded.hash,
+			operator_version = excluded.operator_version`,
+		file.Version, file.Description, revisionTypeExecute, applied, total, executedAt, time.Since(executedAt).Nanoseconds(), errText, errStatement, file.Hash, operatorVersion)
+	return err
+}
+
+// revisions returns the recorded revisions by version, or none when the table
+// doesn't exist yet because nothing was ever applied.
+func (m *Migrator) revisions(ctx context.Context) (map[string]*revision, error) {
+	out := make(map[string]*revision)
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied, total, executed_at, hash, error FROM "+revisionsTable)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && (pqErr.Code.Name() == "undefined_table" || pqErr.Code.Name() == "invalid_schema_name") {
+			return out, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rev := new(revision)
+		if err := rows.Scan(&rev.version, &rev.applied, &rev.total, &rev.executedAt, &rev.hash, &rev.err); err != nil {
+			return nil, err
+		}
+		out[rev.version] = rev
+	}
+	return out, rows.Err()
+}
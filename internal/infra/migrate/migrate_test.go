@@ -0,0 +1,226 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+const (
+	testItems = "19990101000001"
+	testTags  = "19990101000002"
+)
+
+// openTestDB connects to the database named by TEST_DATABASE_URL, the one the
+// repository tests use, and returns a migrator of dir. The test migrations
+// only touch migrate_test_* tables and are removed at the end of the test.
+func openTestDB(t *testing.T, dir fstest.MapFS) (*Migrator, *sql.DB) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMigratorFor(ctx, db, os.Getenv("TEST_DATABASE_DIALECT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.dir = withSum(t, dir)
+	// under the lock, as the repository tests may migrate the same database
+	if err := m.withLock(ctx, m.ensureRevisionsTable); err != nil {
+		t.Fatal(err)
+	}
+	clean := func() {
+		for _, statement := range []string{
+			"DROP TABLE IF EXISTS migrate_test_items",
+			"DROP TABLE IF EXISTS migrate_test_tags",
+			"DELETE FROM " + revisionsTable + " WHERE version IN ('" + testItems + "', '" + testTags + "')",
+		} {
+			if _, err := db.ExecContext(ctx, statement); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	clean()
+	t.Cleanup(func() {
+		clean()
+		db.Close()
+	})
+	return m, db
+}
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		testItems + "_items.sql":           {Data: []byte("CREATE TABLE migrate_test_items (id int PRIMARY KEY);\nINSERT INTO migrate_test_items VALUES (1);\n")},
+		testTags + "_tags.sql":             {Data: []byte("CREATE TABLE migrate_test_tags (id int PRIMARY KEY);\nCREATE INDEX migrate_test_tags_id ON migrate_test_tags (id);\n")},
+		"down/" + testItems + "_items.sql": {Data: []byte("DROP TABLE migrate_test_items;\n")},
+		"down/" + testTags + "_tags.sql":   {Data: []byte("DROP TABLE migrate_test_tags;\n")},
+	}
+}
+
+func states(t *testing.T, m *Migrator) []string {
+	t.Helper()
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	var out []string
+	for _, status := range statuses {
+		out = append(out, status.State)
+	}
+	return out
+}
+
+func tableExists(db *sql.DB, table string) bool {
+	_, err := db.Exec("SELECT count(*) FROM " + table)
+	return err == nil
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	m, db := openTestDB(t, testMigrations())
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if want := []string{testItems, testTags}; !reflect.DeepEqual(applied, want) {
+		t.Fatalf("Up() = %v, want %v in order", applied, want)
+	}
+	if got, want := states(t, m), []string{StateApplied, StateApplied}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Status() = %v, want %v", got, want)
+	}
+	if applied, err := m.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("Up() again = %v, %v, want nothing applied", applied, err)
+	}
+
+	rolledBack, err := m.Down(ctx, 1)
+	if err != nil {
+		t.Fatalf("Down(1) error = %v", err)
+	}
+	if want := []string{testTags}; !reflect.DeepEqual(rolledBack, want) {
+		t.Fatalf("Down(1) = %v, want the last migration %v", rolledBack, want)
+	}
+	if tableExists(db, "migrate_test_tags") || !tableExists(db, "migrate_test_items") {
+		t.Fatal("Down(1) didn't only drop migrate_test_tags")
+	}
+	if pending, err := m.Pending(ctx); err != nil || !reflect.DeepEqual(pending, []string{testTags}) {
+		t.Fatalf("Pending() = %v, %v, want %v", pending, err, []string{testTags})
+	}
+
+	rolledBack, err = m.Down(ctx, 5)
+	if err != nil {
+		t.Fatalf("Down(5) error = %v", err)
+	}
+	if want := []string{testItems}; !reflect.DeepEqual(rolledBack, want) {
+		t.Fatalf("Down(5) = %v, want the applied migrations %v", rolledBack, want)
+	}
+	if got, want := states(t, m), []string{StatePending, StatePending}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Status() = %v, want %v", got, want)
+	}
+}
+
+func TestUpResumesPartialMigration(t *testing.T) {
+	ctx := context.Background()
+	dir := testMigrations()
+	delete(dir, testTags+"_tags.sql")
+	dir[testItems+"_items.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE migrate_test_items (id int PRIMARY KEY);\nINSERT INTO migrate_test_items VALUES (1);\nINSERT INTO migrate_test_missing VALUES (2);\n")}
+	m, db := openTestDB(t, dir)
+
+	if _, err := m.Up(ctx); err == nil {
+		t.Fatal("Up() error = nil, want the failure of the third statement")
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[0].State != StatePartial || statuses[0].Error == "" {
+		t.Fatalf("Status() = %+v, want a partial migration with its error", statuses[0])
+	}
+	if _, err := m.Down(ctx, 1); !errors.Is(err, errDirtyDatabase) {
+		t.Fatalf("Down() error = %v, want errDirtyDatabase", err)
+	}
+
+	// fixed, the migration resumes at the failed statement: running the
+	// CREATE TABLE again would fail
+	dir[testItems+"_items.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE migrate_test_items (id int PRIMARY KEY);\nINSERT INTO migrate_test_items VALUES (1);\nINSERT INTO migrate_test_items VALUES (2);\n")}
+	m.dir = withSum(t, dir)
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if !reflect.DeepEqual(applied, []string{testItems}) {
+		t.Fatalf("Up() = %v, want %v", applied, []string{testItems})
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM migrate_test_items").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("migrate_test_items has %d rows (%v), want 2", count, err)
+	}
+	if got := states(t, m); !reflect.DeepEqual(got, []string{StateApplied}) {
+		t.Fatalf("Status() = %v, want applied", got)
+	}
+}
+
+func TestModifiedMigration(t *testing.T) {
+	ctx := context.Background()
+	dir := testMigrations()
+	m, _ := openTestDB(t, dir)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	dir[testItems+"_items.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE migrate_test_items (id bigint PRIMARY KEY);\n")}
+	m.dir = withSum(t, dir)
+	if got, want := states(t, m), []string{StateModified, StateApplied}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Status() = %v, want %v", got, want)
+	}
+	// applied migrations are never run again
+	if applied, err := m.Up(ctx); err != nil || len(applied) != 0 {
+		t.Fatalf("Up() = %v, %v, want nothing applied", applied, err)
+	}
+}
+
+func TestDownWithoutDownFile(t *testing.T) {
+	ctx := context.Background()
+	dir := testMigrations()
+	delete(dir, "down/"+testTags+"_tags.sql")
+	m, _ := openTestDB(t, dir)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if _, err := m.Down(ctx, 2); !errors.Is(err, errMissingDownFile) {
+		t.Fatalf("Down() error = %v, want errMissingDownFile", err)
+	}
+	if got, want := states(t, m), []string{StateApplied, StateApplied}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Status() = %v, want %v", got, want)
+	}
+}
+
+func TestNewMigratorUnknownDialect(t *testing.T) {
+	if _, err := NewMigrator(nil, "mysql"); !errors.Is(err, errUnknownDialect) {
+		t.Fatalf("NewMigrator() error = %v, want errUnknownDialect", err)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	m := &Migrator{dialect: DialectPostgres, dir: withSum(t, testMigrations())}
+	files, err := m.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Migration{
+		{Version: testItems, Description: "items", Name: testItems + "_items.sql", Hash: files[0].Hash},
+		{Version: testTags, Description: "tags", Name: testTags + "_tags.sql", Hash: files[1].Hash},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("Migrations() = %+v, want %+v", files, want)
+	}
+}
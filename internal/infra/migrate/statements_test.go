@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "statements",
+			content: "CREATE TABLE a (id int);\nCREATE TABLE b (id int);\n",
+			want:    []string{"CREATE TABLE a (id int)", "CREATE TABLE b (id int)"},
+		},
+		{
+			name:    "last statement without semicolon",
+			content: "SELECT 1;\nSELECT 2",
+			want:    []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:    "empty statements",
+			content: ";;\n  ;\nSELECT 1;;",
+			want:    []string{"SELECT 1"},
+		},
+		{
+			name:    "semicolon in strings",
+			content: `INSERT INTO a VALUES ('a;b', 'it''s');SELECT "odd;name" FROM a;`,
+			want:    []string{`INSERT INTO a VALUES ('a;b', 'it''s')`, `SELECT "odd;name" FROM a`},
+		},
+		{
+			name:    "semicolon in comments",
+			content: "-- create a; then b\nCREATE TABLE a (id int); -- done;\nCREATE TABLE b (id int);",
+			want:    []string{"-- create a; then b\nCREATE TABLE a (id int)", "-- done;\nCREATE TABLE b (id int)"},
+		},
+		{
+			name:    "comment only",
+			content: "SELECT 1;\n-- nothing to do\n-- really;\n",
+			want:    []string{"SELECT 1"},
+		},
+		{
+			name:    "comment at the end without newline",
+			content: "SELECT 1; -- trailing",
+			want:    []string{"SELECT 1"},
+		},
+		{
+			name: "dollar quoted body",
+			content: "CREATE FUNCTION f() RETURNS trigger AS $$\nBEGIN\n  NEW.at = now();\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql;\n" +
+				"CREATE TRIGGER t BEFORE UPDATE ON a FOR EACH ROW EXECUTE FUNCTION f();",
+			want: []string{
+				"CREATE FUNCTION f() RETURNS trigger AS $$\nBEGIN\n  NEW.at = now();\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql",
+				"CREATE TRIGGER t BEFORE UPDATE ON a FOR EACH ROW EXECUTE FUNCTION f()",
+			},
+		},
+		{
+			name:    "tagged dollar quotes",
+			content: "DO $body$ BEGIN PERFORM '$$;'; END $body$;SELECT 1;",
+			want:    []string{"DO $body$ BEGIN PERFORM '$$;'; END $body$", "SELECT 1"},
+		},
+		{
+			name:    "positional parameters are not dollar quotes",
+			content: "SELECT $1, $2;SELECT 1;",
+			want:    []string{"SELECT $1, $2", "SELECT 1"},
+		},
+		{
+			name:    "unterminated string",
+			content: "SELECT 1;SELECT 'a;",
+			want:    []string{"SELECT 1", "SELECT 'a;"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDollarTag(t *testing.T) {
+	tests := map[string]string{
+		"$$ body":     "$$",
+		"$fn$ body":   "$fn$",
+		"$a_1$ body":  "$a_1$",
+		"$1, $2":      "",
+		"$ 1":         "",
+		"$unfinished": "",
+	}
+	for s, want := range tests {
+		if got := dollarTag(s); got != want {
+			t.Errorf("dollarTag(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
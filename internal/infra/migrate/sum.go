@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+const sumFile = "atlas.sum"
+
+var (
+	errChecksumFormat   = errors.New("atlas.sum format invalid")
+	errChecksumMismatch = errors.New("checksum mismatch, migration files were changed without running atlas migrate hash")
+)
+
+type hashedFile struct {
+	name string
+	hash string
+}
+
+type hashFile struct {
+	sum   string
+	files []hashedFile
+}
+
+// computeSum hashes the migration files the same way as Atlas: each file hash
+// covers the names and contents of all files before it, and the directory sum
+// covers every name and hash.
+func computeSum(dir fs.FS) (*hashFile, error) {
+	entries, err := fs.ReadDir(dir, ".")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	out := new(hashFile)
+	h := sha256.New()
+	for _, name := range names {
+		content, err := fs.ReadFile(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		h.Write([]byte(name))
+		h.Write(content)
+		out.files = append(out.files, hashedFile{name: name, hash: base64.StdEncoding.EncodeToString(h.Sum(nil))})
+	}
+	total := sha256.New()
+	for _, file := range out.files {
+		total.Write([]byte(file.name))
+		total.Write([]byte(file.hash))
+	}
+	out.sum = base64.StdEncoding.EncodeToString(total.Sum(nil))
+	return out, nil
+}
+
+func parseSum(content []byte) (*hashFile, error) {
+	out := new(hashFile)
+	sc := bufio.NewScanner(bytes.NewReader(content))
+	if !sc.Scan() {
+		return nil, errChecksumFormat
+	}
+	out.sum = strings.TrimPrefix(sc.Text(), "h1:")
+	for sc.Scan() {
+		name, hash, ok := strings.Cut(sc.Text(), " h1:")
+		if !ok {
+			return nil, errChecksumFormat
+		}
+		out.files = append(out.files, hashedFile{name: name, hash: hash})
+	}
+	return out, sc.Err()
+}
+
+// verifySum checks the migration files against atlas.sum and returns their hashes.
+func verifySum(dir fs.FS) (*hashFile, error) {
+	content, err := fs.ReadFile(dir, sumFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", sumFile, err)
+	}
+	expected, err := parseSum(content)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := computeSum(dir)
+	if err != nil {
+		return nil, err
+	}
+	if expected.sum != actual.sum || len(expected.files) != len(actual.files) {
+		return nil, errChecksumMismatch
+	}
+	for i, file := range actual.files {
+		if expected.files[i] != file {
+			return nil, fmt.Errorf("%s: %w", file.name, errChecksumMismatch)
+		}
+	}
+	return actual, nil
+}
@@ -0,0 +1,152 @@
+package migrate
+
+import (
+	"errors"
+	"github.com/jmjp/gopasswordless/migrations"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// withSum adds the atlas.sum of the files of dir to it.
+func withSum(t *testing.T, dir fstest.MapFS) fstest.MapFS {
+	t.Helper()
+	sum, err := computeSum(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	b.WriteString("h1:" + sum.sum + "\n")
+	for _, file := range sum.files {
+		b.WriteString(file.name + " h1:" + file.hash + "\n")
+	}
+	dir[sumFile] = &fstest.MapFile{Data: []byte(b.String())}
+	return dir
+}
+
+func TestEmbeddedMigrationsMatchSum(t *testing.T) {
+	for _, dialect := range []string{DialectPostgres, DialectCockroach} {
+		t.Run(dialect, func(t *testing.T) {
+			dir, err := fs.Sub(migrations.FS, dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum, err := verifySum(dir)
+			if err != nil {
+				t.Fatalf("verifySum() error = %v, run atlas migrate hash", err)
+			}
+			for _, file := range sum.files {
+				if _, err := fs.Stat(dir, "down/"+file.name); err != nil {
+					t.Errorf("%s has no down file: %v", file.name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeSum(t *testing.T) {
+	dir := fstest.MapFS{
+		"2_b.sql":      {Data: []byte("CREATE TABLE b (id int);\n")},
+		"1_a.sql":      {Data: []byte("CREATE TABLE a (id int);\n")},
+		"readme.md":    {Data: []byte("not a migration")},
+		"down/1_a.sql": {Data: []byte("DROP TABLE a;\n")},
+	}
+	sum, err := computeSum(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sum.files) != 2 || sum.files[0].name != "1_a.sql" || sum.files[1].name != "2_b.sql" {
+		t.Fatalf("computeSum() files = %+v, want the sql files in order", sum.files)
+	}
+
+	// the hash of a file covers the files before it
+	dir["1_a.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE a (id bigint);\n")}
+	changed, err := computeSum(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.files[1].hash == sum.files[1].hash || changed.sum == sum.sum {
+		t.Fatal("changing a file didn't change the hashes of the following files and the sum")
+	}
+}
+
+func TestVerifySum(t *testing.T) {
+	files := func() fstest.MapFS {
+		return fstest.MapFS{
+			"1_a.sql": {Data: []byte("CREATE TABLE a (id int);\n")},
+			"2_b.sql": {Data: []byte("CREATE TABLE b (id int);\n")},
+		}
+	}
+	tests := []struct {
+		name    string
+		dir     func(t *testing.T) fstest.MapFS
+		wantErr error
+		want    string
+	}{
+		{
+			name: "valid",
+			dir:  func(t *testing.T) fstest.MapFS { return withSum(t, files()) },
+		},
+		{
+			name: "modified file",
+			dir: func(t *testing.T) fstest.MapFS {
+				dir := withSum(t, files())
+				dir["2_b.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE b (id bigint);\n")}
+				return dir
+			},
+			wantErr: errChecksumMismatch,
+		},
+		{
+			name: "added file",
+			dir: func(t *testing.T) fstest.MapFS {
+				dir := withSum(t, files())
+				dir["3_c.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE c (id int);\n")}
+				return dir
+			},
+			wantErr: errChecksumMismatch,
+		},
+		{
+			name: "file hash only",
+			dir: func(t *testing.T) fstest.MapFS {
+				dir := withSum(t, files())
+				lines := strings.Split(string(dir[sumFile].Data), "\n")
+				lines[2] = "2_b.sql h1:AAAA"
+				dir[sumFile] = &fstest.MapFile{Data: []byte(strings.Join(lines, "\n"))}
+				return dir
+			},
+			wantErr: errChecksumMismatch,
+			want:    "2_b.sql",
+		},
+		{
+			name: "malformed",
+			dir: func(t *testing.T) fstest.MapFS {
+				dir := withSum(t, files())
+				dir[sumFile] = &fstest.MapFile{Data: append(dir[sumFile].Data, "garbage\n"...)}
+				return dir
+			},
+			wantErr: errChecksumFormat,
+		},
+		{
+			name:    "empty",
+			dir:     func(t *testing.T) fstest.MapFS { dir := files(); dir[sumFile] = &fstest.MapFile{}; return dir },
+			wantErr: errChecksumFormat,
+		},
+		{
+			name:    "missing",
+			dir:     func(t *testing.T) fstest.MapFS { return files() },
+			wantErr: fs.ErrNotExist,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifySum(tt.dir(t))
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("verifySum() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != "" && !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("verifySum() error = %v, want it to name %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City string `json:"city"`
+}
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type person struct {
+	base
+	Name      string           `json:"name"`
+	Nickname  *string          `json:"nickname"`
+	Age       int              `json:"age,omitempty"`
+	Born      time.Time        `json:"born"`
+	Tags      []string         `json:"tags"`
+	Labels    map[string]int64 `json:"labels"`
+	Address   *address         `json:"address"`
+	Friends   []person         `json:"friends"`
+	Extra     any              `json:"extra"`
+	Raw       []byte           `json:"raw"`
+	Hidden    string           `json:"-"`
+	Untagged  bool
+	private   string
+	Anonymous struct{ X int } `json:"anonymous"`
+}
+
+func TestSchema(t *testing.T) {
+	d := New(Info{Title: "test", Version: "1"})
+	if got := d.Schema(person{}); got.Ref != "#/components/schemas/person" {
+		t.Fatalf("Schema() = %+v, want a reference", got)
+	}
+	s := d.Components.Schemas["person"]
+	want := map[string]Schema{
+		"id":       {Type: "string"},
+		"name":     {Type: "string"},
+		"nickname": {Type: "string", Nullable: true},
+		"age":      {Type: "integer", Format: "int64"},
+		"born":     {Type: "string", Format: "date-time"},
+		"address":  {Ref: "#/components/schemas/address"},
+		"extra":    {},
+		"raw":      {Type: "string", Format: "byte"},
+		"Untagged": {Type: "boolean"},
+	}
+	for name, schema := range want {
+		if got := s.Properties[name]; got == nil || !reflect.DeepEqual(*got, schema) {
+			t.Errorf("property %s = %+v, want %+v", name, got, schema)
+		}
+	}
+	for _, name := range []string{"Hidden", "private", "base"} {
+		if s.Properties[name] != nil {
+			t.Errorf("property %s should not be encoded", name)
+		}
+	}
+	if got := s.Properties["friends"]; got.Type != "array" || got.Items.Ref != "#/components/schemas/person" {
+		t.Errorf("friends = %+v, want an array of the recursive reference", got)
+	}
+	if got := s.Properties["labels"]; got.Type != "object" || got.AdditionalProperties.Format != "int64" {
+		t.Errorf("labels = %+v, want a map", got)
+	}
+	if got := s.Properties["anonymous"]; got.Type != "object" || got.Properties["X"] == nil {
+		t.Errorf("anonymous = %+v, want an inline object", got)
+	}
+	wantRequired := []string{"id", "name", "born", "tags", "labels", "friends", "extra", "raw", "Untagged", "anonymous"}
+	if !reflect.DeepEqual(s.Required, wantRequired) {
+		t.Errorf("required = %v, want %v", s.Required, wantRequired)
+	}
+	if d.Components.Schemas["address"] == nil {
+		t.Error("address is not registered")
+	}
+}
+
+func TestSchemaQualifiesCollidingNames(t *testing.T) {
+	type Report struct {
+		A string `json:"a"`
+	}
+	d := New(Info{})
+	d.Components.Schemas["Report"] = &Schema{}
+	if got := d.Schema(Report{}).Ref; got != "#/components/schemas/openapi.Report" {
+		t.Errorf("Schema() = %s, want the qualified name", got)
+	}
+	if got := d.Schema(Report{}).Ref; got != "#/components/schemas/openapi.Report" {
+		t.Errorf("second Schema() = %s, want the same name", got)
+	}
+}
+
+func TestOperation(t *testing.T) {
+	d := New(Info{})
+	op := &Operation{Summary: "login"}
+	d.Add("POST", "/auth/login", op)
+	if d.Operation("post", "/auth/login") != op || d.Operation("GET", "/auth/login") != nil {
+		t.Error("Operation() does not find the added operation by method")
+	}
+}
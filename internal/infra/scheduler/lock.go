@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"hash/fnv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Locker grants a named lock to a single replica. release must be called once
+// the work is done; the lock also expires after ttl when supported.
+type Locker interface {
+	TryLock(ctx context.Context, name string, ttl time.Duration) (release func(), acquired bool, err error)
+}
+
+// releaseScript deletes the lock only if this replica still owns it.
+var releaseScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`)
+
+type RedisLocker struct {
+	redis *redis.Client
+}
+
+func NewRedisLocker(redis *redis.Client) *RedisLocker {
+	return &RedisLocker{redis: redis}
+}
+
+func (l *RedisLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, false, err
+	}
+	owner := hex.EncodeToString(buf)
+	key := "hyperzoop:lock:" + name
+	acquired, err := l.redis.SetNX(ctx, key, owner, ttl).Result()
+	if err != nil || !acquired {
+		return nil, false, err
+	}
+	return func() {
+		if err := releaseScript.Run(context.WithoutCancel(ctx), l.redis, []string{key}, owner).Err(); err != nil {
+			zap.L().Error("error releasing job lock", zap.Error(err), zap.String("lock", name))
+		}
+	}, true, nil
+}
+
+// PostgresLocker uses session advisory locks, held by a dedicated connection
+// until released. It doesn't work on CockroachDB, use the RedisLocker there.
+type PostgresLocker struct {
+	db *sql.DB
+}
+
+func NewPostgresLocker(db *sql.DB) *PostgresLocker {
+	return &PostgresLocker{db: db}
+}
+
+func (l *PostgresLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	h := fnv.New64a()
+	h.Write([]byte("hyperzoop:" + name))
+	key := int64(h.Sum64())
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil || !acquired {
+		conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			zap.L().Error("error releasing job lock", zap.Error(err), zap.String("lock", name))
+		}
+		conn.Close()
+	}, true, nil
+}
@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisLocker(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	l := NewRedisLocker(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	release, acquired, err := l.TryLock(ctx, "purge", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("TryLock() = %v, %v, want the lock", acquired, err)
+	}
+	if _, acquired, err := l.TryLock(ctx, "purge", time.Minute); err != nil || acquired {
+		t.Fatalf("TryLock() of a held lock = %v, %v, want it refused", acquired, err)
+	}
+	if _, acquired, err := l.TryLock(ctx, "other", time.Minute); err != nil || !acquired {
+		t.Fatalf("TryLock() of another lock = %v, %v, want it granted", acquired, err)
+	}
+	release()
+	if server.Exists("hyperzoop:lock:purge") {
+		t.Fatal("release() kept the lock")
+	}
+	if release, acquired, err := l.TryLock(ctx, "purge", time.Minute); err != nil || !acquired {
+		t.Fatalf("TryLock() after release = %v, %v, want the lock", acquired, err)
+	} else {
+		release()
+	}
+}
+
+func TestRedisLockerReleaseKeepsAnotherOwner(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	l := NewRedisLocker(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	release, acquired, err := l.TryLock(ctx, "purge", time.Second)
+	if err != nil || !acquired {
+		t.Fatalf("TryLock() = %v, %v, want the lock", acquired, err)
+	}
+	// the run outlived its lock, which another replica took since
+	server.FastForward(2 * time.Second)
+	releaseOther, acquired, err := l.TryLock(ctx, "purge", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("TryLock() of an expired lock = %v, %v, want it granted", acquired, err)
+	}
+	owner, _ := server.Get("hyperzoop:lock:purge")
+
+	release()
+	if got, _ := server.Get("hyperzoop:lock:purge"); got != owner {
+		t.Fatalf("lock = %q after the late release, want it kept by its new owner %q", got, owner)
+	}
+	releaseOther()
+	if server.Exists("hyperzoop:lock:purge") {
+		t.Fatal("the new owner couldn't release the lock")
+	}
+}
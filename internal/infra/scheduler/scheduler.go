@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Job is a task run every Interval by a single replica at a time.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Timeout bounds a run and the lock held for it.
+	Timeout time.Duration
+	Run     func(ctx context.Context) (any, error)
+}
+
+// Stats describes the runs of a job on this replica.
+type Stats struct {
+	Name         string     `json:"name"`
+	Interval     string     `json:"interval"`
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+	Skipped      int64      `json:"skipped"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastResult   any        `json:"last_result,omitempty"`
+}
+
+// Scheduler runs the registered jobs until stopped, taking the job lock before
+// each run so replicas don't do the same work twice.
+type Scheduler struct {
+	locker Locker
+	jobs   []*Job
+	mu     sync.RWMutex
+	stats  map[string]*Stats
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(locker Locker) *Scheduler {
+	return &Scheduler{
+		locker: locker,
+		stats:  make(map[string]*Stats),
+	}
+}
+
+// Register adds a job; jobs with a non-positive interval are disabled.
+func (s *Scheduler) Register(job *Job) {
+	if job.Interval <= 0 {
+		return
+	}
+	if job.Timeout <= 0 || job.Timeout > job.Interval {
+		job.Timeout = job.Interval
+	}
+	s.jobs = append(s.jobs, job)
+	s.stats[job.Name] = &Stats{Name: job.Name, Interval: job.Interval.String()}
+}
+
+// Start launches every job in its own goroutine.
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// Stop cancels the running jobs and waits for them to return.
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Stats returns a snapshot of the stats of every job.
+func (s *Scheduler) Stats() []Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Stats, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		out = append(out, *s.stats[job.Name])
+	}
+	return out
+}
+
+func (s *Scheduler) loop(ctx context.Context, job *Job) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.run(ctx, job)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job *Job) {
+	ctx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+	release, acquired, err := s.locker.TryLock(ctx, job.Name, job.Timeout)
+	if err != nil {
+		zap.L().Error("error acquiring job lock", zap.Error(err), zap.String("job", job.Name))
+		s.record(job, time.Now(), 0, nil, err)
+		return
+	}
+	if !acquired {
+		s.mu.Lock()
+		s.stats[job.Name].Skipped++
+		s.mu.Unlock()
+		return
+	}
+	defer release()
+
+	start := time.Now()
+	result, err := job.Run(ctx)
+	s.record(job, start, time.Since(start), result, err)
+	if err != nil {
+		zap.L().Error("job failed", zap.Error(err), zap.String("job", job.Name))
+		return
+	}
+	zap.L().Info("job finished", zap.String("job", job.Name), zap.Duration("duration", time.Since(start)), zap.Any("result", result))
+}
+
+func (s *Scheduler) record(job *Job, start time.Time, duration time.Duration, result any, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats[job.Name]
+	stats.Runs++
+	stats.LastRunAt = &start
+	stats.LastDuration = duration.String()
+	stats.LastResult = result
+	stats.LastError = ""
+	if err != nil {
+		stats.Failures++
+		stats.LastError = err.Error()
+	}
+}
@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeLocker grants every lock unless held is set, counting the releases.
+type fakeLocker struct {
+	held     bool
+	err      error
+	released atomic.Int32
+}
+
+func (l *fakeLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(), bool, error) {
+	if l.err != nil || l.held {
+		return nil, false, l.err
+	}
+	return func() { l.released.Add(1) }, true, nil
+}
+
+func TestRegister(t *testing.T) {
+	s := NewScheduler(&fakeLocker{})
+	s.Register(&Job{Name: "disabled", Interval: 0})
+	job := &Job{Name: "purge", Interval: time.Minute, Timeout: time.Hour}
+	s.Register(job)
+	if stats := s.Stats(); len(stats) != 1 || stats[0].Name != "purge" || stats[0].Interval != "1m0s" {
+		t.Fatalf("Stats() = %+v, want the purge job only", stats)
+	}
+	if job.Timeout != time.Minute {
+		t.Fatalf("Timeout = %s, want it bounded by the interval", job.Timeout)
+	}
+}
+
+func TestRunRecordsStats(t *testing.T) {
+	locker := &fakeLocker{}
+	s := NewScheduler(locker)
+	failing := errors.New("database is down")
+	var fail bool
+	job := &Job{Name: "purge", Interval: time.Minute, Run: func(ctx context.Context) (any, error) {
+		if fail {
+			return nil, failing
+		}
+		return 3, nil
+	}}
+	s.Register(job)
+
+	s.run(context.Background(), job)
+	stats := s.Stats()[0]
+	if stats.Runs != 1 || stats.Failures != 0 || stats.LastResult != 3 || stats.LastRunAt == nil || stats.LastError != "" {
+		t.Fatalf("Stats() = %+v, want one successful run", stats)
+	}
+	if locker.released.Load() != 1 {
+		t.Fatalf("released %d times, want the lock released after the run", locker.released.Load())
+	}
+
+	fail = true
+	s.run(context.Background(), job)
+	stats = s.Stats()[0]
+	if stats.Runs != 2 || stats.Failures != 1 || stats.LastError != failing.Error() || stats.LastResult != nil {
+		t.Fatalf("Stats() = %+v, want the failure recorded", stats)
+	}
+
+	// a success clears the last error
+	fail = false
+	s.run(context.Background(), job)
+	if stats = s.Stats()[0]; stats.LastError != "" || stats.Failures != 1 {
+		t.Fatalf("Stats() = %+v, want the last error cleared", stats)
+	}
+}
+
+func TestRunSkipsLockedJobs(t *testing.T) {
+	locker := &fakeLocker{held: true}
+	s := NewScheduler(locker)
+	var runs atomic.Int32
+	job := &Job{Name: "purge", Interval: time.Minute, Run: func(ctx context.Context) (any, error) {
+		runs.Add(1)
+		return nil, nil
+	}}
+	s.Register(job)
+
+	s.run(context.Background(), job)
+	stats := s.Stats()[0]
+	if runs.Load() != 0 || stats.Skipped != 1 || stats.Runs != 0 {
+		t.Fatalf("ran %d times, Stats() = %+v, want the run skipped while another replica holds the lock", runs.Load(), stats)
+	}
+
+	// failing to take the lock is a failure, not a skip
+	locker.held, locker.err = false, errors.New("redis is down")
+	s.run(context.Background(), job)
+	stats = s.Stats()[0]
+	if runs.Load() != 0 || stats.Failures != 1 || stats.Skipped != 1 || stats.LastError != "redis is down" {
+		t.Fatalf("ran %d times, Stats() = %+v, want the lock error recorded", runs.Load(), stats)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	s := NewScheduler(&fakeLocker{})
+	job := &Job{Name: "slow", Interval: time.Minute, Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	s.Register(job)
+	s.run(context.Background(), job)
+	if stats := s.Stats()[0]; stats.LastError != context.DeadlineExceeded.Error() {
+		t.Fatalf("Stats() = %+v, want the run cut at its timeout", stats)
+	}
+}
+
+func TestStopDrainsRunningJobs(t *testing.T) {
+	s := NewScheduler(&fakeLocker{})
+	started := make(chan struct{})
+	var once sync.Once
+	var finished atomic.Bool
+	s.Register(&Job{Name: "purge", Interval: time.Millisecond, Run: func(ctx context.Context) (any, error) {
+		once.Do(func() { close(started) })
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished.Store(true)
+		return nil, nil
+	}})
+	s.Start(context.Background())
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("the job never ran")
+	}
+	s.Stop()
+	if !finished.Load() {
+		t.Fatal("Stop() returned before the running job")
+	}
+	runs := s.Stats()[0].Runs
+	time.Sleep(5 * time.Millisecond)
+	if s.Stats()[0].Runs != runs {
+		t.Fatal("the job ran again after Stop()")
+	}
+}
+
+func TestStopWithoutStart(t *testing.T) {
+	NewScheduler(&fakeLocker{}).Stop()
+}
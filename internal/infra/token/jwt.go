@@ -1,29 +1,53 @@
 package token
 
 import (
-	"os"
+	"slices"
+	"strings"
 
 	"github.com/golang-jwt/jwt"
 )
 
+// Scopes granted to access tokens, separated by spaces in the scope claim.
+const (
+	// ScopeUser lets the token act on behalf of its user.
+	ScopeUser = "user"
+	// ScopeAdmin lets the token manage the sessions of any user.
+	ScopeAdmin = "admin"
+)
+
+// UserClaims are the claims of an access token. The token id (jti) and the
+// session it was issued for (sid) let it be revoked before it expires.
 type UserClaims struct {
-	UserId  string `json:"id"`
-	Email   string `json:"email"`
-	Blocked bool   `json:"blocked"`
+	UserId    string `json:"id"`
+	Email     string `json:"email"`
+	Blocked   bool   `json:"blocked"`
+	SessionId string `json:"sid,omitempty"`
+	Scope     string `json:"scope,omitempty"`
 	jwt.StandardClaims
 }
 
-func NewJwtAccessToken(claims UserClaims) (string, error) {
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return accessToken.SignedString([]byte(os.Getenv("token_secret")))
+// HasScope reports whether the token was granted scope.
+func (c *UserClaims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
+
+func NewJwtAccessToken(keys *Keyring, claims UserClaims) (string, error) {
+	return keys.sign(claims)
 }
 
-func ParseJwtAccessToken(accessToken string) (*UserClaims, error) {
-	parsedAccessToken, err := jwt.ParseWithClaims(accessToken, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("token_secret")), nil
-	})
+func ParseJwtAccessToken(keys *Keyring, accessToken string) (*UserClaims, error) {
+	parsedAccessToken, err := jwt.ParseWithClaims(accessToken, &UserClaims{}, keys.keyFunc)
 	if err != nil {
 		return nil, err
 	}
 	return parsedAccessToken.Claims.(*UserClaims), nil
 }
+
+// Valid checks the expiry of the claims but not their issue time, which only
+// serves the denylist: a replica whose clock is a little behind the issuer's
+// would otherwise refuse fresh tokens.
+func (c UserClaims) Valid() error {
+	standard := c.StandardClaims
+	standard.IssuedAt = 0
+	return standard.Valid()
+}
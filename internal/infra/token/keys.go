@@ -0,0 +1,419 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+)
+
+// maxRetiredKeys is how many previous keys keep validating tokens after rotations.
+const maxRetiredKeys = 2
+
+// Signing algorithms of the keys.
+const (
+	// AlgHS256 keys are HMAC secrets: whoever verifies tokens with them can
+	// issue tokens too.
+	AlgHS256 = "HS256"
+	// AlgES256 keys are P-256 private keys, whose public keys are published
+	// as a key set for other services to verify tokens.
+	AlgES256 = "ES256"
+)
+
+var (
+	errMissingSigningKey = errors.New("token signing key is not configured")
+	errUnknownKey        = errors.New("token signed with an unknown key")
+	errUnexpectedMethod  = errors.New("unexpected token signing method")
+)
+
+// Key signs access tokens, which carry its id in the kid header.
+type Key struct {
+	ID string `json:"kid"`
+	// Alg is AlgHS256 when empty, as in the keys files written before ES256.
+	Alg string `json:"alg,omitempty"`
+	// Secret is the secret of HS256 keys.
+	Secret string `json:"secret,omitempty"`
+	// PrivateKey is the PEM encoded PKCS #8 private key of ES256 keys.
+	PrivateKey string    `json:"private_key,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	ecdsa *ecdsa.PrivateKey
+}
+
+func (k *Key) algorithm() string {
+	if k.Alg == "" {
+		return AlgHS256
+	}
+	return k.Alg
+}
+
+// parse checks the key material and decodes the private key of ES256 keys.
+func (k *Key) parse() error {
+	switch k.algorithm() {
+	case AlgHS256:
+		if k.Secret == "" {
+			return errMissingSigningKey
+		}
+	case AlgES256:
+		block, _ := pem.Decode([]byte(k.PrivateKey))
+		if block == nil {
+			return fmt.Errorf("key %s: the private key is not PEM encoded", k.ID)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", k.ID, err)
+		}
+		private, ok := parsed.(*ecdsa.PrivateKey)
+		if !ok || private.Curve != elliptic.P256() {
+			return fmt.Errorf("key %s: ES256 needs a P-256 private key", k.ID)
+		}
+		k.ecdsa = private
+	default:
+		return fmt.Errorf("key %s: unsupported algorithm %q", k.ID, k.Alg)
+	}
+	return nil
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	if k.algorithm() == AlgES256 {
+		return jwt.SigningMethodES256
+	}
+	return jwt.SigningMethodHS256
+}
+
+func (k *Key) signingKey() interface{} {
+	if k.ecdsa != nil {
+		return k.ecdsa
+	}
+	return []byte(k.Secret)
+}
+
+func (k *Key) verificationKey() interface{} {
+	if k.ecdsa != nil {
+		return &k.ecdsa.PublicKey
+	}
+	return []byte(k.Secret)
+}
+
+// JWK is the public half of an ES256 key as a JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// JWKSet is a JSON Web Key Set.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet is the content of the keys file. The active key signs new tokens; the
+// next key is already accepted, so every replica knows it before a rotation
+// promotes it; retired keys keep validating tokens issued before a rotation.
+type KeySet struct {
+	Active  Key   `json:"active"`
+	Next    *Key  `json:"next,omitempty"`
+	Retired []Key `json:"retired,omitempty"`
+}
+
+// GenerateKey creates a key for alg, AlgHS256 or AlgES256: a random 256-bit
+// secret or a P-256 private key.
+func GenerateKey(alg string) (Key, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, err
+	}
+	key := Key{ID: hex.EncodeToString(id), Alg: alg, CreatedAt: time.Now().UTC()}
+	switch alg {
+	case AlgHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return Key{}, err
+		}
+		key.Secret = hex.EncodeToString(secret)
+	case AlgES256:
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return Key{}, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		if err != nil {
+			return Key{}, err
+		}
+		key.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		key.ecdsa = private
+	default:
+		return Key{}, fmt.Errorf("unsupported algorithm %q, use %s or %s", alg, AlgHS256, AlgES256)
+	}
+	return key, nil
+}
+
+// NewKeySet creates a key set with fresh active and next keys for alg.
+func NewKeySet(alg string) (*KeySet, error) {
+	active, err := GenerateKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	next, err := GenerateKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{Active: active, Next: &next}, nil
+}
+
+// Rotate promotes the next key, retires the active one and prepares a new next
+// key for alg. An empty alg keeps the algorithm of the promoted key; another
+// one switches algorithms in two rotations, as the new next key has to be
+// known by every replica before it signs tokens.
+func (ks *KeySet) Rotate(alg string) error {
+	if alg == "" && ks.Next != nil {
+		alg = ks.Next.algorithm()
+	} else if alg == "" {
+		alg = ks.Active.algorithm()
+	}
+	next, err := GenerateKey(alg)
+	if err != nil {
+		return err
+	}
+	ks.Retired = append([]Key{ks.Active}, ks.Retired...)
+	if len(ks.Retired) > maxRetiredKeys {
+		ks.Retired = ks.Retired[:maxRetiredKeys]
+	}
+	if ks.Next != nil {
+		ks.Active = *ks.Next
+	} else {
+		ks.Active, err = GenerateKey(alg)
+		if err != nil {
+			return err
+		}
+	}
+	ks.Next = &next
+	return nil
+}
+
+func (ks *KeySet) find(id string) (Key, bool) {
+	if ks.Active.ID == id {
+		return ks.Active, true
+	}
+	if ks.Next != nil && ks.Next.ID == id {
+		return *ks.Next, true
+	}
+	for _, key := range ks.Retired {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+func (ks *KeySet) keys() []*Key {
+	keys := []*Key{&ks.Active}
+	if ks.Next != nil {
+		keys = append(keys, ks.Next)
+	}
+	for i := range ks.Retired {
+		keys = append(keys, &ks.Retired[i])
+	}
+	return keys
+}
+
+// JWKS returns the public keys of the ES256 keys, for the services verifying
+// tokens with pkg/authz. HS256 keys are secrets and are left out.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys() {
+		if key.ecdsa == nil {
+			continue
+		}
+		public := key.ecdsa.PublicKey
+		set.Keys = append(set.Keys, JWK{
+			Kty: "EC",
+			Kid: key.ID,
+			Alg: AlgES256,
+			Use: "sig",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, 32))),
+		})
+	}
+	return set
+}
+
+func LoadKeySet(path string) (*KeySet, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ks := new(KeySet)
+	if err := json.Unmarshal(content, ks); err != nil {
+		return nil, fmt.Errorf("parsing keys file %s: %w", path, err)
+	}
+	for _, key := range ks.keys() {
+		if err := key.parse(); err != nil {
+			return nil, fmt.Errorf("keys file %s: %w", path, err)
+		}
+	}
+	return ks, nil
+}
+
+// Save writes the key set readable by the owner only, replacing the file atomically
+// so running servers never load a partial file.
+func (ks *KeySet) Save(path string) error {
+	content, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Keyring signs and verifies access tokens with the current key set. When
+// backed by a keys file it picks up rotations through Reload.
+type Keyring struct {
+	mu      sync.RWMutex
+	set     *KeySet
+	path    string
+	modTime time.Time
+}
+
+// NewStaticKeyring uses a single secret without key id, as configured by token_secret.
+func NewStaticKeyring(secret string) *Keyring {
+	return &Keyring{set: &KeySet{Active: Key{Secret: secret}}}
+}
+
+// OpenKeyring loads the keys file at path.
+func OpenKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload reads the keys file again if it changed since the last load.
+func (k *Keyring) Reload() error {
+	if k.path == "" {
+		return nil
+	}
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+	k.mu.RLock()
+	unchanged := info.ModTime().Equal(k.modTime)
+	k.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	set, err := LoadKeySet(k.path)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	k.set = set
+	k.modTime = info.ModTime()
+	k.mu.Unlock()
+	zap.L().Info("token keys loaded", zap.String("path", k.path), zap.String("active_kid", set.Active.ID))
+	return nil
+}
+
+// Watch reloads the keys file every interval until ctx is done.
+func (k *Keyring) Watch(ctx context.Context, interval time.Duration) {
+	if k.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Reload(); err != nil {
+				zap.L().Error("error reloading token keys", zap.Error(err), zap.String("path", k.path))
+			}
+		}
+	}
+}
+
+// Available reports whether access tokens can be signed and verified.
+func (k *Keyring) Available() error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.set == nil {
+		return errMissingSigningKey
+	}
+	return k.set.Active.parse()
+}
+
+// JWKS returns the public keys that verify the tokens, see KeySet.JWKS.
+func (k *Keyring) JWKS() JWKSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.set == nil {
+		return JWKSet{Keys: []JWK{}}
+	}
+	return k.set.JWKS()
+}
+
+func (k *Keyring) sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	active := k.set.Active
+	k.mu.RUnlock()
+	if active.Secret == "" && active.ecdsa == nil {
+		return "", errMissingSigningKey
+	}
+	token := jwt.NewWithClaims(active.method(), claims)
+	if active.ID != "" {
+		token.Header["kid"] = active.ID
+	}
+	return token.SignedString(active.signingKey())
+}
+
+func (k *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.set.find(kid)
+	if !ok {
+		return nil, errUnknownKey
+	}
+	// the token must not pick the algorithm, e.g. HMAC with a public key as secret
+	if token.Method.Alg() != key.algorithm() {
+		return nil, errUnexpectedMethod
+	}
+	return key.verificationKey(), nil
+}
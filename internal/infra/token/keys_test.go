@@ -0,0 +1,151 @@
+package token
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func claimsFor(user string) UserClaims {
+	return UserClaims{UserId: user, StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()}}
+}
+
+func openTestKeyring(t *testing.T, set *KeySet) (*Keyring, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := set.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := OpenKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys, path
+}
+
+func TestES256Keyring(t *testing.T) {
+	set, err := NewKeySet(AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := openTestKeyring(t, set)
+	accessToken, err := NewJwtAccessToken(keys, claimsFor("user"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := new(jwt.Parser).ParseUnverified(accessToken, &UserClaims{})
+	if err != nil || parsed.Method != jwt.SigningMethodES256 || parsed.Header["kid"] != set.Active.ID {
+		t.Fatalf("token header = %v, %v, want ES256 and kid %s", parsed.Header, err, set.Active.ID)
+	}
+	if claims, err := ParseJwtAccessToken(keys, accessToken); err != nil || claims.UserId != "user" {
+		t.Fatalf("ParseJwtAccessToken() = %+v, %v", claims, err)
+	}
+
+	// the public key must not serve as an HMAC secret
+	jwks := keys.JWKS()
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor("admin"))
+	forged.Header["kid"] = set.Active.ID
+	signed, _ := forged.SignedString([]byte(jwks.Keys[0].X))
+	var validation *jwt.ValidationError
+	if _, err := ParseJwtAccessToken(keys, signed); !errors.As(err, &validation) || validation.Inner != errUnexpectedMethod {
+		t.Fatalf("ParseJwtAccessToken() of an HS256 token error = %v, want errUnexpectedMethod", err)
+	}
+}
+
+func TestJWKSPublishesPublicKeysOnly(t *testing.T) {
+	set, err := NewKeySet(AlgHS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwks := set.JWKS(); len(jwks.Keys) != 0 {
+		t.Fatalf("JWKS() = %+v, want the HS256 secrets left out", jwks)
+	}
+
+	// switching algorithms takes two rotations, the first publishes the new next key
+	if err := set.Rotate(AlgES256); err != nil {
+		t.Fatal(err)
+	}
+	jwks := set.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != set.Next.ID || set.Active.algorithm() != AlgHS256 {
+		t.Fatalf("JWKS() = %+v after the first rotation, want the next key only", jwks)
+	}
+	key := jwks.Keys[0]
+	if key.Kty != "EC" || key.Crv != "P-256" || key.Alg != AlgES256 || key.Use != "sig" || len(key.X) != 43 || len(key.Y) != 43 {
+		t.Fatalf("JWKS() key = %+v", key)
+	}
+	if err := set.Rotate(""); err != nil {
+		t.Fatal(err)
+	}
+	if set.Active.algorithm() != AlgES256 || set.Next.algorithm() != AlgES256 || len(set.JWKS().Keys) != 2 {
+		t.Fatalf("key set = %+v after the second rotation, want ES256 active and next keys", set)
+	}
+}
+
+func TestKeyringAcrossAlgorithms(t *testing.T) {
+	set, err := NewKeySet(AlgHS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, path := openTestKeyring(t, set)
+	before, err := NewJwtAccessToken(keys, claimsFor("user"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := set.Rotate(AlgES256); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := set.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := NewJwtAccessToken(keys, claimsFor("user"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tokens of the retired HS256 key stay valid
+	for _, accessToken := range []string{before, after} {
+		if _, err := ParseJwtAccessToken(keys, accessToken); err != nil {
+			t.Fatalf("ParseJwtAccessToken() error = %v", err)
+		}
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		t.Helper()
+		path := filepath.Join(dir, "keys.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// files written before ES256 keys have no alg
+	set, err := LoadKeySet(write(`{"active":{"kid":"a","secret":"s"}}`))
+	if err != nil || set.Active.algorithm() != AlgHS256 {
+		t.Fatalf("LoadKeySet() = %+v, %v, want an HS256 key", set, err)
+	}
+	for _, content := range []string{
+		`{"active":{"kid":"a"}}`,
+		`{"active":{"kid":"a","alg":"ES256","private_key":"garbage"}}`,
+		`{"active":{"kid":"a","alg":"RS256","secret":"s"}}`,
+		`{"active":{"kid":"a","secret":"s"},"retired":[{"kid":"b","alg":"ES256"}]}`,
+	} {
+		if _, err := LoadKeySet(write(content)); err == nil {
+			t.Errorf("LoadKeySet(%s) error = nil", content)
+		}
+	}
+}
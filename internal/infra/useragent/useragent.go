@@ -0,0 +1,113 @@
+// Package useragent turns User-Agent headers into the device details shown to
+// users in their sessions list.
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Device types.
+const (
+	Desktop = "desktop"
+	Mobile  = "mobile"
+	Tablet  = "tablet"
+	Bot     = "bot"
+	Unknown = "unknown"
+)
+
+// Device describes the browser and system a User-Agent header comes from.
+// Fields that can't be recognized are left empty.
+type Device struct {
+	Browser        string
+	BrowserVersion string
+	OS             string
+	Type           string
+	// Label is a short description for people, like "Chrome on macOS".
+	Label string
+}
+
+type rule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Browsers are matched in order: most of them also claim to be Safari, and
+// Chromium based ones to be Chrome, so the specific tokens come first. The
+// first group captures the version.
+var browsers = []rule{
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/(\d+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|OPT|Opera)/(\d+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/(\d+)`)},
+	{"Yandex", regexp.MustCompile(`YaBrowser/(\d+)`)},
+	{"Vivaldi", regexp.MustCompile(`Vivaldi/(\d+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/(\d+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/(\d+)`)},
+	{"Safari", regexp.MustCompile(`Version/(\d+)[\d.]* (?:Mobile/\S+ )?Safari/`)},
+	{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)(\d+)`)},
+	{"curl", regexp.MustCompile(`^curl/(\d+)`)},
+}
+
+var systems = []rule{
+	{"iOS", regexp.MustCompile(`iPhone|iPad|iPod`)},
+	{"Android", regexp.MustCompile(`Android`)},
+	{"Windows", regexp.MustCompile(`Windows`)},
+	{"ChromeOS", regexp.MustCompile(`CrOS`)},
+	{"macOS", regexp.MustCompile(`Macintosh|Mac OS X`)},
+	{"Linux", regexp.MustCompile(`Linux|X11`)},
+}
+
+var (
+	botRe    = regexp.MustCompile(`(?i)[\w-]*(?:bot|crawler|spider|slurp)[\w-]*|headless\w*`)
+	tabletRe = regexp.MustCompile(`iPad|Tablet`)
+	mobileRe = regexp.MustCompile(`Mobi|iPhone|iPod`)
+)
+
+// Parse describes the device behind the User-Agent header ua.
+func Parse(ua string) Device {
+	var d Device
+	for _, b := range browsers {
+		if m := b.re.FindStringSubmatch(ua); m != nil {
+			d.Browser, d.BrowserVersion = b.name, m[1]
+			break
+		}
+	}
+	for _, s := range systems {
+		if s.re.MatchString(ua) {
+			d.OS = s.name
+			break
+		}
+	}
+	switch {
+	case ua == "":
+		d.Type = Unknown
+	case botRe.MatchString(ua):
+		d.Type = Bot
+	// Android tablets are the Android devices that don't say Mobile
+	case tabletRe.MatchString(ua) || d.OS == "Android" && !strings.Contains(ua, "Mobile"):
+		d.Type = Tablet
+	case mobileRe.MatchString(ua):
+		d.Type = Mobile
+	case d.OS == "Windows" || d.OS == "macOS" || d.OS == "Linux" || d.OS == "ChromeOS":
+		d.Type = Desktop
+	default:
+		d.Type = Unknown
+	}
+	d.Label = label(d, ua)
+	return d
+}
+
+func label(d Device, ua string) string {
+	switch {
+	case d.Type == Bot:
+		return "Bot (" + botRe.FindString(ua) + ")"
+	case d.Browser != "" && d.OS != "":
+		return d.Browser + " on " + d.OS
+	case d.Browser != "":
+		return d.Browser
+	case d.OS != "":
+		return "Browser on " + d.OS
+	default:
+		return "Unknown device"
+	}
+}
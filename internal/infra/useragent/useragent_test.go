@@ -0,0 +1,98 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want Device
+	}{
+		{
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36",
+			want: Device{Browser: "Chrome", BrowserVersion: "121", OS: "macOS", Type: Desktop, Label: "Chrome on macOS"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36",
+			want: Device{Browser: "Chrome", BrowserVersion: "121", OS: "Windows", Type: Desktop, Label: "Chrome on Windows"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36 Edg/121.0.2277.83",
+			want: Device{Browser: "Edge", BrowserVersion: "121", OS: "Windows", Type: Desktop, Label: "Edge on Windows"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 OPR/106.0.0.0",
+			want: Device{Browser: "Opera", BrowserVersion: "106", OS: "Windows", Type: Desktop, Label: "Opera on Windows"},
+		},
+		{
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:122.0) Gecko/20100101 Firefox/122.0",
+			want: Device{Browser: "Firefox", BrowserVersion: "122", OS: "Linux", Type: Desktop, Label: "Firefox on Linux"},
+		},
+		{
+			ua:   "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0",
+			want: Device{Browser: "Firefox", BrowserVersion: "115", OS: "Linux", Type: Desktop, Label: "Firefox on Linux"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2.1 Safari/605.1.15",
+			want: Device{Browser: "Safari", BrowserVersion: "17", OS: "macOS", Type: Desktop, Label: "Safari on macOS"},
+		},
+		{
+			ua:   "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36",
+			want: Device{Browser: "Chrome", BrowserVersion: "121", OS: "ChromeOS", Type: Desktop, Label: "Chrome on ChromeOS"},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			want: Device{Browser: "Safari", BrowserVersion: "17", OS: "iOS", Type: Mobile, Label: "Safari on iOS"},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/121.0.6167.66 Mobile/15E148 Safari/604.1",
+			want: Device{Browser: "Chrome", BrowserVersion: "121", OS: "iOS", Type: Mobile, Label: "Chrome on iOS"},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/122.0 Mobile/15E148 Safari/605.1.15",
+			want: Device{Browser: "Firefox", BrowserVersion: "122", OS: "iOS", Type: Mobile, Label: "Firefox on iOS"},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			want: Device{Browser: "Safari", BrowserVersion: "16", OS: "iOS", Type: Tablet, Label: "Safari on iOS"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Mobile Safari/537.36",
+			want: Device{Browser: "Chrome", BrowserVersion: "121", OS: "Android", Type: Mobile, Label: "Chrome on Android"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-S908B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36",
+			want: Device{Browser: "Samsung Internet", BrowserVersion: "23", OS: "Android", Type: Mobile, Label: "Samsung Internet on Android"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36",
+			want: Device{Browser: "Chrome", BrowserVersion: "121", OS: "Android", Type: Tablet, Label: "Chrome on Android"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Android 14; Mobile; rv:122.0) Gecko/122.0 Firefox/122.0",
+			want: Device{Browser: "Firefox", BrowserVersion: "122", OS: "Android", Type: Mobile, Label: "Firefox on Android"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			want: Device{Browser: "Internet Explorer", BrowserVersion: "11", OS: "Windows", Type: Desktop, Label: "Internet Explorer on Windows"},
+		},
+		{
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Device{Type: Bot, Label: "Bot (Googlebot)"},
+		},
+		{
+			ua:   "curl/8.4.0",
+			want: Device{Browser: "curl", BrowserVersion: "8", Type: Unknown, Label: "curl"},
+		},
+		{
+			ua:   "",
+			want: Device{Type: Unknown, Label: "Unknown device"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want.Label, func(t *testing.T) {
+			if got := Parse(tt.ua); got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.ua, got, tt.want)
+			}
+		})
+	}
+}
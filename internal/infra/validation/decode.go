@@ -0,0 +1,72 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// DecodeJSON decodes the single JSON value of r into v and checks it with
+// Struct. Malformed bodies are reported as Errors too, naming the field when
+// there is one; other errors, like those of the reader, are returned as is.
+func DecodeJSON(r io.Reader, v any, disallowUnknownFields bool) error {
+	decoder := json.NewDecoder(r)
+	if disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		if err != nil && !isSyntaxError(err) {
+			return err
+		}
+		return Errors{{Rule: "json", Message: "body must hold a single JSON value"}}
+	}
+	return Struct(v)
+}
+
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return Errors{{Rule: "required", Message: "body is required"}}
+	case errors.As(err, &typeErr):
+		return Errors{{Field: typeErr.Field, Rule: "type", Message: "must be " + jsonType(typeErr.Type)}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return Errors{{Field: field, Rule: "unknown", Message: "is not a field of the request"}}
+	case isSyntaxError(err):
+		return Errors{{Rule: "json", Message: "body is not valid JSON"}}
+	}
+	return err
+}
+
+func isSyntaxError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// jsonType names the JSON values that decode into t.
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
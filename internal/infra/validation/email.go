@@ -0,0 +1,43 @@
+package validation
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	errEmailFormat = errors.New("must be an email address")
+	errEmailLength = errors.New("must be at most 254 characters long, 64 before the @")
+	errEmailDomain = errors.New("has an invalid domain")
+)
+
+// localPartPattern is the part before the @ entities.User accepts, without
+// quoted strings or internationalized local parts.
+var localPartPattern = regexp.MustCompile(`^[a-z0-9._%+\-]+$`)
+
+// NormalizeEmail returns the form emails are stored and looked up in: trimmed,
+// case-folded, with an internationalized domain converted to punycode, so
+// User@Bücher.example and user@xn--bcher-kva.example are the same user.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		return "", errEmailFormat
+	}
+	local := strings.ToLower(email[:at])
+	if !localPartPattern.MatchString(local) {
+		return "", errEmailFormat
+	}
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(email[at+1:], "."))
+	if err != nil || !strings.Contains(domain, ".") {
+		return "", errEmailDomain
+	}
+	email = local + "@" + domain
+	if len(local) > 64 || len(email) > 254 {
+		return "", errEmailLength
+	}
+	return email, nil
+}
@@ -0,0 +1,161 @@
+// Package validation checks the structs decoded from requests against the
+// rules of their validate tags, for example:
+//
+//	Email    string  `json:"email" validate:"required,email"`
+//	Username *string `json:"username" validate:"min=3,max=64,username"`
+//
+// Rules are checked in order and stop at the first failure of a field. Nil
+// pointers and empty strings are only checked by required, the only rule that
+// applies to other types than strings.
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError is a rule a field of the request broke. Field is its JSON name,
+// dotted for nested structs, and empty for errors of the whole body.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors lists every field error of a request.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+		if err.Field != "" {
+			messages[i] = err.Field + " " + err.Message
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// rule checks a non-empty value. It may rewrite it, as email normalizes the
+// address, and returns the message of the failure.
+type rule func(v reflect.Value, param string) (string, bool)
+
+var rules = map[string]rule{
+	"email": func(v reflect.Value, _ string) (string, bool) {
+		email, err := NormalizeEmail(v.String())
+		if err != nil {
+			return err.Error(), false
+		}
+		v.SetString(email)
+		return "", true
+	},
+	"username": func(v reflect.Value, _ string) (string, bool) {
+		return "must only contain letters, numbers, underscores and hyphens", usernamePattern.MatchString(v.String())
+	},
+	"url": func(v reflect.Value, _ string) (string, bool) {
+		u, err := url.Parse(v.String())
+		return "must be an http or https URL", err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	},
+	"min": func(v reflect.Value, param string) (string, bool) {
+		n, _ := strconv.Atoi(param)
+		return fmt.Sprintf("must be at least %d characters long", n), utf8.RuneCountInString(v.String()) >= n
+	},
+	"max": func(v reflect.Value, param string) (string, bool) {
+		n, _ := strconv.Atoi(param)
+		return fmt.Sprintf("must be at most %d characters long", n), utf8.RuneCountInString(v.String()) <= n
+	},
+	"oneof": func(v reflect.Value, param string) (string, bool) {
+		options := strings.Fields(param)
+		for _, option := range options {
+			if v.String() == option {
+				return "", true
+			}
+		}
+		return "must be one of " + strings.Join(options, ", "), false
+	},
+}
+
+// Struct checks the struct v points to, rewriting the fields the rules
+// normalize. It returns Errors when a field breaks a rule, and panics on
+// unknown rules as they are programming errors.
+func Struct(v any) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		panic("validation: Struct needs a pointer to a struct")
+	}
+	var errs Errors
+	checkStruct(value.Elem(), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkStruct(v reflect.Value, prefix string, errs *Errors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fv := v.Field(i)
+		if tag := field.Tag.Get("validate"); tag != "" {
+			if err, ok := checkField(fv, tag); !ok {
+				*errs = append(*errs, FieldError{Field: prefix + name, Rule: err.Rule, Message: err.Message})
+				continue
+			}
+		}
+		for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct {
+			checkStruct(fv, prefix+name+".", errs)
+		}
+	}
+}
+
+func checkField(v reflect.Value, tag string) (FieldError, bool) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			if strings.Contains(","+tag+",", ",required,") {
+				return FieldError{Rule: "required", Message: "is required"}, false
+			}
+			return FieldError{}, true
+		}
+		v = v.Elem()
+	}
+	for _, spec := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(spec, "=")
+		if name == "required" {
+			if v.IsZero() {
+				return FieldError{Rule: name, Message: "is required"}, false
+			}
+			continue
+		}
+		check, ok := rules[name]
+		if !ok {
+			panic("validation: unknown rule " + name)
+		}
+		if v.IsZero() {
+			continue
+		}
+		if message, ok := check(v, param); !ok {
+			return FieldError{Rule: name, Message: message}, false
+		}
+	}
+	return FieldError{}, true
+}
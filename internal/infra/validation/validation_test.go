@@ -0,0 +1,144 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type profile struct {
+	Email    string   `json:"email" validate:"required,email"`
+	Username *string  `json:"username" validate:"min=3,max=8,username"`
+	Avatar   *string  `json:"avatar" validate:"url"`
+	Plan     string   `json:"plan,omitempty" validate:"oneof=free pro"`
+	Address  *address `json:"address"`
+}
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name  string
+		input profile
+		want  Errors
+	}{
+		{name: "valid", input: profile{Email: "user@hyperzoop.com", Username: ptr("user_1"), Avatar: ptr("https://hyperzoop.com/a.png"), Plan: "pro"}},
+		{name: "optional fields", input: profile{Email: "user@hyperzoop.com"}},
+		{name: "missing email", input: profile{}, want: Errors{{Field: "email", Rule: "required", Message: "is required"}}},
+		{name: "every failure", input: profile{
+			Email:    "user",
+			Username: ptr("us"),
+			Avatar:   ptr("javascript:alert(1)"),
+			Plan:     "gold",
+			Address:  &address{},
+		}, want: Errors{
+			{Field: "email", Rule: "email", Message: "must be an email address"},
+			{Field: "username", Rule: "min", Message: "must be at least 3 characters long"},
+			{Field: "avatar", Rule: "url", Message: "must be an http or https URL"},
+			{Field: "plan", Rule: "oneof", Message: "must be one of free, pro"},
+			{Field: "address.city", Rule: "required", Message: "is required"},
+		}},
+		{name: "rules in order", input: profile{Email: "user@hyperzoop.com", Username: ptr("user name!")}, want: Errors{
+			{Field: "username", Rule: "max", Message: "must be at most 8 characters long"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Struct(&tt.input)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Struct() error = %v", err)
+				}
+				return
+			}
+			var got Errors
+			if !errors.As(err, &got) || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Struct() error = %#v, want %#v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructNormalizes(t *testing.T) {
+	input := profile{Email: " User@HyperZoop.COM "}
+	if err := Struct(&input); err != nil || input.Email != "user@hyperzoop.com" {
+		t.Fatalf("Struct() = %v, email %q", err, input.Email)
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := map[string]string{
+		"user@hyperzoop.com":                        "user@hyperzoop.com",
+		"  User.Name+tag@HyperZoop.com ":            "user.name+tag@hyperzoop.com",
+		"user@hyperzoop.com.":                       "user@hyperzoop.com",
+		"user@Bücher.example":                       "user@xn--bcher-kva.example",
+		"user@xn--bcher-kva.example":                "user@xn--bcher-kva.example",
+		"user@пример.рф":                            "user@xn--e1afmkfd.xn--p1ai",
+		"a@b@hyperzoop.com":                         "",
+		"user":                                      "",
+		"@hyperzoop.com":                            "",
+		"user@":                                     "",
+		"user@localhost":                            "",
+		"us er@hyperzoop.com":                       "",
+		"user@hyper_zoop.com":                       "",
+		"üser@hyperzoop.com":                        "",
+		strings.Repeat("a", 65) + "@hyperzoop.com":  "",
+		"user@" + strings.Repeat("a", 250) + ".com": "",
+	}
+	for input, want := range tests {
+		got, err := NormalizeEmail(input)
+		if (err != nil) != (want == "") || got != want {
+			t.Errorf("NormalizeEmail(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		strict bool
+		want   Errors
+	}{
+		{name: "valid", body: `{"email":"User@HyperZoop.com"}`},
+		{name: "unknown fields allowed", body: `{"email":"user@hyperzoop.com","role":"admin"}`},
+		{name: "unknown field", body: `{"email":"user@hyperzoop.com","role":"admin"}`, strict: true, want: Errors{{Field: "role", Rule: "unknown", Message: "is not a field of the request"}}},
+		{name: "empty", body: ``, want: Errors{{Rule: "required", Message: "body is required"}}},
+		{name: "malformed", body: `{"email":`, want: Errors{{Rule: "json", Message: "body is not valid JSON"}}},
+		{name: "wrong type", body: `{"email":42}`, want: Errors{{Field: "email", Rule: "type", Message: "must be a string"}}},
+		{name: "nested wrong type", body: `{"email":"user@hyperzoop.com","address":{"city":[]}}`, want: Errors{{Field: "address.city", Rule: "type", Message: "must be a string"}}},
+		{name: "two values", body: `{"email":"user@hyperzoop.com"} {}`, want: Errors{{Rule: "json", Message: "body must hold a single JSON value"}}},
+		{name: "trailing garbage", body: `{"email":"user@hyperzoop.com"} }`, want: Errors{{Rule: "json", Message: "body must hold a single JSON value"}}},
+		{name: "invalid", body: `{"email":"user"}`, want: Errors{{Field: "email", Rule: "email", Message: "must be an email address"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input profile
+			err := DecodeJSON(strings.NewReader(tt.body), &input, tt.strict)
+			if tt.want == nil {
+				if err != nil || input.Email != "user@hyperzoop.com" {
+					t.Fatalf("DecodeJSON() = %v, email %q", err, input.Email)
+				}
+				return
+			}
+			var got Errors
+			if !errors.As(err, &got) || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("DecodeJSON() error = %#v, want %#v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	err := Errors{{Rule: "json", Message: "body is not valid JSON"}, {Field: "email", Rule: "required", Message: "is required"}}
+	if got := err.Error(); got != "body is not valid JSON; email is required" {
+		t.Errorf("Error() = %q", got)
+	}
+}
@@ -0,0 +1,6 @@
+-- Add the device parsed from the user agent to the Session table
+ALTER TABLE Sessions ADD COLUMN IF NOT EXISTS browser STRING NOT NULL DEFAULT '';
+ALTER TABLE Sessions ADD COLUMN IF NOT EXISTS browser_version STRING NOT NULL DEFAULT '';
+ALTER TABLE Sessions ADD COLUMN IF NOT EXISTS os STRING NOT NULL DEFAULT '';
+ALTER TABLE Sessions ADD COLUMN IF NOT EXISTS device_type STRING NOT NULL DEFAULT '';
+ALTER TABLE Sessions ADD COLUMN IF NOT EXISTS device_label STRING NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- Track when and from where each session was last refreshed
+ALTER TABLE Sessions ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp();
+ALTER TABLE Sessions ADD COLUMN IF NOT EXISTS last_ip STRING;
+ALTER TABLE Sessions ADD COLUMN IF NOT EXISTS refresh_count INT8 NOT NULL DEFAULT 0;
+
+UPDATE Sessions SET last_used_at = COALESCE(updated_at, created_at, last_used_at), last_ip = ip WHERE true;
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_last_used_at_idx ON Sessions (user_id, last_used_at DESC);
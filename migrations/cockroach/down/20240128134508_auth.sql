@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS Sessions;
+DROP TABLE IF EXISTS Magic_Links;
+DROP TABLE IF EXISTS Users;
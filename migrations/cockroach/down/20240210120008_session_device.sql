@@ -0,0 +1,5 @@
+ALTER TABLE Sessions DROP COLUMN IF EXISTS device_label;
+ALTER TABLE Sessions DROP COLUMN IF EXISTS device_type;
+ALTER TABLE Sessions DROP COLUMN IF EXISTS os;
+ALTER TABLE Sessions DROP COLUMN IF EXISTS browser_version;
+ALTER TABLE Sessions DROP COLUMN IF EXISTS browser;
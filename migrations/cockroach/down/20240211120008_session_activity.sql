@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS Sessions@sessions_user_id_last_used_at_idx;
+ALTER TABLE Sessions DROP COLUMN IF EXISTS refresh_count;
+ALTER TABLE Sessions DROP COLUMN IF EXISTS last_ip;
+ALTER TABLE Sessions DROP COLUMN IF EXISTS last_used_at;
@@ -0,0 +1,8 @@
+package migrations
+
+import "embed"
+
+// FS holds the Atlas-formatted migration directories, one per supported database.
+//
+//go:embed postgres cockroach
+var FS embed.FS
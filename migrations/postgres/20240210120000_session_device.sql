@@ -0,0 +1,7 @@
+-- Add the device parsed from the user agent to the Sessions table
+ALTER TABLE public.sessions
+  ADD COLUMN IF NOT EXISTS browser text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS browser_version text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS os text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS device_type text NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS device_label text NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- Track when and from where each session was last refreshed
+ALTER TABLE public.sessions
+  ADD COLUMN IF NOT EXISTS last_used_at timestamp with time zone NOT NULL DEFAULT current_timestamp,
+  ADD COLUMN IF NOT EXISTS last_ip text,
+  ADD COLUMN IF NOT EXISTS refresh_count bigint NOT NULL DEFAULT 0;
+
+UPDATE public.sessions SET last_used_at = COALESCE(updated_at, created_at, last_used_at), last_ip = ip;
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_last_used_at_idx ON public.sessions (user_id, last_used_at DESC);
@@ -0,0 +1,3 @@
+-- Emails are looked up in their normalized, lowercase form; this fails when two
+-- users only differ by the case of their email, which must be merged by hand
+UPDATE public.users SET email = lower(email), updated_at = current_timestamp WHERE email <> lower(email);
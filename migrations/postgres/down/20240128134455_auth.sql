@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS public.sessions;
+DROP TABLE IF EXISTS public.magic_links;
+DROP TABLE IF EXISTS public.users;
@@ -0,0 +1,6 @@
+ALTER TABLE public.sessions
+  DROP COLUMN IF EXISTS device_label,
+  DROP COLUMN IF EXISTS device_type,
+  DROP COLUMN IF EXISTS os,
+  DROP COLUMN IF EXISTS browser_version,
+  DROP COLUMN IF EXISTS browser;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS public.sessions_user_id_last_used_at_idx;
+ALTER TABLE public.sessions
+  DROP COLUMN IF EXISTS refresh_count,
+  DROP COLUMN IF EXISTS last_ip,
+  DROP COLUMN IF EXISTS last_used_at;
@@ -0,0 +1,228 @@
+// Package authz lets services behind HyperZoop accept its access tokens. It
+// verifies them with the public keys HyperZoop serves at /.well-known/jwks.json
+// when it signs with the ES256 keys of token_keys_file, or with token_secret,
+// and hands the authenticated user to handlers through the request context:
+//
+//	auth, err := authz.New(authz.Config{JWKSURL: "https://auth.example.com/.well-known/jwks.json"})
+//	mux.Handle("/profile", auth.Middleware(profile))
+//	mux.Handle("/admin/", auth.Require("admin")(admin))
+//
+//	func profile(w http.ResponseWriter, r *http.Request) {
+//		user, _ := authz.UserFromContext(r.Context())
+//		...
+//	}
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Config selects how tokens are verified. Exactly one of Secret and JWKSURL must be set.
+type Config struct {
+	// Secret is token_secret, the HMAC secret the tokens are signed with. It
+	// is shared with HyperZoop: whoever knows it can issue tokens, so keep it
+	// as private as the configuration of HyperZoop. Prefer JWKSURL with ES256
+	// keys, which also follows key rotations.
+	Secret string
+	// JWKSURL is fetched for the public keys the tokens are signed with,
+	// which are looked up by the kid header of the tokens.
+	JWKSURL string
+	// JWKSRefresh is how long fetched keys are used before fetching them
+	// again, 5 minutes by default. Tokens signed with an unknown key trigger
+	// a fetch too, at most every 10 seconds.
+	JWKSRefresh time.Duration
+	// HTTPClient fetches JWKSURL, http.DefaultClient by default.
+	HTTPClient *http.Client
+	// Realm is sent in WWW-Authenticate challenges, "hyperzoop" by default.
+	Realm string
+	// Leeway tolerates clocks running behind the one of HyperZoop when
+	// checking expirations.
+	Leeway time.Duration
+	// IsRevoked, when set, is asked about every valid token, for instance to
+	// check the denylist through the introspection endpoint. Errors fail the
+	// request with 503.
+	IsRevoked func(ctx context.Context, user *User) (bool, error)
+}
+
+var (
+	errNoKeySource      = errors.New("authz: one of Secret and JWKSURL is required")
+	errTwoKeySources    = errors.New("authz: Secret and JWKSURL can't both be set")
+	errUnexpectedMethod = errors.New("unexpected signing method")
+	errUnknownKey       = errors.New("token signed with an unknown key")
+	errExpired          = errors.New("token is expired")
+	errNotYetValid      = errors.New("token is not valid yet")
+	errBlocked          = errors.New("user is blocked")
+	errRevoked          = errors.New("token was revoked")
+)
+
+// unavailableError wraps the failures to load the keys or check revocations,
+// which aren't the fault of the client.
+type unavailableError struct{ err error }
+
+func (e *unavailableError) Error() string { return e.err.Error() }
+func (e *unavailableError) Unwrap() error { return e.err }
+
+// Authenticator verifies access tokens. It is safe for concurrent use.
+type Authenticator struct {
+	realm     string
+	leeway    time.Duration
+	keys      keySource
+	isRevoked func(ctx context.Context, user *User) (bool, error)
+	now       func() time.Time
+}
+
+func New(cfg Config) (*Authenticator, error) {
+	a := &Authenticator{realm: cfg.Realm, leeway: cfg.Leeway, isRevoked: cfg.IsRevoked, now: time.Now}
+	if a.realm == "" {
+		a.realm = "hyperzoop"
+	}
+	switch {
+	case cfg.Secret != "" && cfg.JWKSURL != "":
+		return nil, errTwoKeySources
+	case cfg.Secret != "":
+		a.keys = secretKey(cfg.Secret)
+	case cfg.JWKSURL != "":
+		a.keys = newJWKSCache(cfg.JWKSURL, cfg.HTTPClient, cfg.JWKSRefresh)
+	default:
+		return nil, errNoKeySource
+	}
+	return a, nil
+}
+
+// claims are the claims of HyperZoop access tokens.
+type claims struct {
+	UserId    string `json:"id"`
+	Email     string `json:"email"`
+	Blocked   bool   `json:"blocked"`
+	SessionId string `json:"sid"`
+	Scope     string `json:"scope"`
+	jwt.StandardClaims
+}
+
+// Valid leaves the time checks to Authenticate, which applies the leeway.
+func (c *claims) Valid() error {
+	return nil
+}
+
+// Authenticate verifies the access token and returns its user.
+func (a *Authenticator) Authenticate(ctx context.Context, accessToken string) (*User, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(accessToken, &c, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := a.keys.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if !methodFits(t.Method, key) {
+			return nil, errUnexpectedMethod
+		}
+		return key, nil
+	})
+	if err != nil {
+		var validation *jwt.ValidationError
+		if errors.As(err, &validation) && validation.Inner != nil {
+			err = validation.Inner
+		}
+		return nil, err
+	}
+	now := a.now()
+	switch {
+	case c.ExpiresAt == 0 || now.Add(-a.leeway).Unix() >= c.ExpiresAt:
+		return nil, errExpired
+	case c.NotBefore != 0 && now.Add(a.leeway).Unix() < c.NotBefore:
+		return nil, errNotYetValid
+	case c.Blocked:
+		return nil, errBlocked
+	}
+	user := &User{
+		ID:        c.UserId,
+		Email:     c.Email,
+		SessionID: c.SessionId,
+		TokenID:   c.Id,
+		Roles:     strings.Fields(c.Scope),
+		ExpiresAt: time.Unix(c.ExpiresAt, 0),
+	}
+	if c.IssuedAt != 0 {
+		user.IssuedAt = time.Unix(c.IssuedAt, 0)
+	}
+	if len(user.Roles) == 0 {
+		// issued before tokens carried their scope
+		user.Roles = []string{"user"}
+	}
+	if a.isRevoked != nil {
+		revoked, err := a.isRevoked(ctx, user)
+		if err != nil {
+			return nil, &unavailableError{err}
+		}
+		if revoked {
+			return nil, errRevoked
+		}
+	}
+	return user, nil
+}
+
+// Middleware only lets requests through with a valid bearer token, storing
+// its user in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return a.Require()(next)
+}
+
+// Require returns a middleware like Middleware that also refuses, with 403,
+// the users lacking one of the roles.
+func (a *Authenticator) Require(roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, accessToken, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			accessToken = strings.TrimSpace(accessToken)
+			if !strings.EqualFold(scheme, "Bearer") || accessToken == "" {
+				// RFC 6750 section 3.1: no error code when no token was sent
+				a.challenge(w, http.StatusUnauthorized, "", "")
+				return
+			}
+			user, err := a.Authenticate(r.Context(), accessToken)
+			if err != nil {
+				var unavailable *unavailableError
+				if errors.As(err, &unavailable) {
+					writeError(w, http.StatusServiceUnavailable, "temporarily_unavailable", err.Error())
+					return
+				}
+				a.challenge(w, http.StatusUnauthorized, "invalid_token", err.Error())
+				return
+			}
+			for _, role := range roles {
+				if !user.HasRole(role) {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q, error="insufficient_scope", scope=%q`, a.realm, strings.Join(roles, " ")))
+					writeError(w, http.StatusForbidden, "insufficient_scope", "the "+role+" role is required")
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), user)))
+		})
+	}
+}
+
+func (a *Authenticator) challenge(w http.ResponseWriter, status int, code, description string) {
+	challenge := fmt.Sprintf("Bearer realm=%q", a.realm)
+	if code != "" {
+		challenge += fmt.Sprintf(", error=%q, error_description=%q", code, description)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeError(w, status, code, description)
+}
+
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if code == "" {
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
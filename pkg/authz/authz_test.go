@@ -0,0 +1,322 @@
+package authz
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/jmjp/gopasswordless/internal/infra/token"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, c claims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, &c)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	signed, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func validClaims() claims {
+	return claims{UserId: "user", Email: "user@hyperzoop.com", SessionId: "session", Scope: "user", StandardClaims: jwt.StandardClaims{
+		Id:        "token",
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	}}
+}
+
+// serve runs a request with accessToken through handler and returns the
+// response along with the user the handler saw.
+func serve(handler func(http.Handler) http.Handler, accessToken string) (*httptest.ResponseRecorder, *User) {
+	var seen *User
+	h := handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = UserFromContext(r.Context())
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if accessToken != "" {
+		r.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w, seen
+}
+
+func TestMiddlewareWithSecret(t *testing.T) {
+	auth, err := New(Config{Secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := validClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	blocked := validClaims()
+	blocked.Blocked = true
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		token     string
+		want      int
+		challenge string
+	}{
+		{name: "lets a valid token through", token: sign(t, jwt.SigningMethodHS256, []byte("secret"), "", validClaims()), want: http.StatusOK},
+		{name: "asks for a token", want: http.StatusUnauthorized, challenge: `Bearer realm="hyperzoop"`},
+		{name: "refuses another secret", token: sign(t, jwt.SigningMethodHS256, []byte("other"), "", validClaims()), want: http.StatusUnauthorized, challenge: `error="invalid_token"`},
+		{name: "refuses another signing method", token: sign(t, jwt.SigningMethodES256, ecKey, "", validClaims()), want: http.StatusUnauthorized, challenge: `error_description="unexpected signing method"`},
+		{name: "refuses an expired token", token: sign(t, jwt.SigningMethodHS256, []byte("secret"), "", expired), want: http.StatusUnauthorized, challenge: `error_description="token is expired"`},
+		{name: "refuses a blocked user", token: sign(t, jwt.SigningMethodHS256, []byte("secret"), "", blocked), want: http.StatusUnauthorized, challenge: `error="invalid_token"`},
+		{name: "refuses garbage", token: "garbage", want: http.StatusUnauthorized, challenge: `error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, user := serve(auth.Middleware, tt.token)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); !strings.Contains(got, tt.challenge) {
+				t.Fatalf("WWW-Authenticate = %q, want it to contain %q", got, tt.challenge)
+			}
+			if (user != nil) != (tt.want == http.StatusOK) {
+				t.Fatalf("handler saw user %+v", user)
+			}
+		})
+	}
+}
+
+func TestMiddlewareAcceptsHyperZoopTokens(t *testing.T) {
+	keys := token.NewStaticKeyring("secret")
+	accessToken, err := token.NewJwtAccessToken(keys, token.UserClaims{
+		UserId:         "user",
+		Email:          "user@hyperzoop.com",
+		SessionId:      "session",
+		Scope:          token.ScopeUser + " " + token.ScopeAdmin,
+		StandardClaims: jwt.StandardClaims{Id: "token", IssuedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Minute).Unix()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, _ := New(Config{Secret: "secret"})
+	w, user := serve(auth.Require("admin"), accessToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if user.ID != "user" || user.Email != "user@hyperzoop.com" || user.SessionID != "session" || user.TokenID != "token" || !user.HasRole("admin") {
+		t.Fatalf("user = %+v", user)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	auth, _ := New(Config{Secret: "secret"})
+	w, _ := serve(auth.Require("admin"), sign(t, jwt.SigningMethodHS256, []byte("secret"), "", validClaims()))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); !strings.Contains(got, `error="insufficient_scope"`) || !strings.Contains(got, `scope="admin"`) {
+		t.Fatalf("WWW-Authenticate = %q", got)
+	}
+}
+
+func TestIsRevoked(t *testing.T) {
+	accessToken := sign(t, jwt.SigningMethodHS256, []byte("secret"), "", validClaims())
+	for _, tt := range []struct {
+		name    string
+		revoked bool
+		err     error
+		want    int
+	}{
+		{name: "valid", want: http.StatusOK},
+		{name: "revoked", revoked: true, want: http.StatusUnauthorized},
+		{name: "unavailable", err: errors.New("down"), want: http.StatusServiceUnavailable},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, _ := New(Config{Secret: "secret", IsRevoked: func(ctx context.Context, user *User) (bool, error) {
+				return tt.revoked, tt.err
+			}})
+			if w, _ := serve(auth.Middleware, accessToken); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithJWKS(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+	keys := []map[string]string{
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X.Bytes()), "y": encode(ecKey.Y.Bytes())},
+		{"kty": "RSA", "kid": "rsa", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		// secrets are skipped rather than trusted
+		{"kty": "oct", "kid": "hmac", "k": encode([]byte("secret"))},
+	}
+	var fetches atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer server.Close()
+
+	auth, err := New(Config{JWKSURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := auth.keys.(*jwksCache)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	if w, _ := serve(auth.Middleware, sign(t, jwt.SigningMethodES256, ecKey, "ec", validClaims())); w.Code != http.StatusOK {
+		t.Fatalf("EC key: status = %d, want 200", w.Code)
+	}
+	if w, _ := serve(auth.Middleware, sign(t, jwt.SigningMethodRS256, rsaKey, "rsa", validClaims())); w.Code != http.StatusOK {
+		t.Fatalf("RSA key: status = %d, want 200", w.Code)
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("fetched %d times, want the keys cached", fetches.Load())
+	}
+	// a public key must not serve as an HMAC secret
+	if w, _ := serve(auth.Middleware, sign(t, jwt.SigningMethodHS256, []byte("secret"), "ec", validClaims())); w.Code != http.StatusUnauthorized {
+		t.Fatalf("HMAC with an EC key: status = %d, want 401", w.Code)
+	}
+	if w, _ := serve(auth.Middleware, sign(t, jwt.SigningMethodHS256, []byte("secret"), "hmac", validClaims())); w.Code != http.StatusUnauthorized {
+		t.Fatalf("oct key: status = %d, want 401", w.Code)
+	}
+
+	// unknown keys are fetched again, but not more than every minJWKSRefetch
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = append(keys, map[string]string{"kty": "EC", "kid": "new", "crv": "P-256", "x": encode(newKey.X.Bytes()), "y": encode(newKey.Y.Bytes())})
+	newToken := sign(t, jwt.SigningMethodES256, newKey, "new", validClaims())
+	if w, _ := serve(auth.Middleware, newToken); w.Code != http.StatusUnauthorized || fetches.Load() != 1 {
+		t.Fatalf("status = %d after %d fetches, want 401 without fetching", w.Code, fetches.Load())
+	}
+	now = now.Add(minJWKSRefetch)
+	if w, _ := serve(auth.Middleware, newToken); w.Code != http.StatusOK || fetches.Load() != 2 {
+		t.Fatalf("status = %d after %d fetches, want 200 after fetching again", w.Code, fetches.Load())
+	}
+
+	// stale keys are kept when the key set can't be fetched
+	failing.Store(true)
+	now = now.Add(defaultJWKSRefresh)
+	if w, _ := serve(auth.Middleware, newToken); w.Code != http.StatusOK {
+		t.Fatalf("status = %d with a failing key set, want the stale keys used", w.Code)
+	}
+}
+
+func TestMiddlewareWithUnreachableJWKS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, _ := New(Config{JWKSURL: server.URL})
+	if w, _ := serve(auth.Middleware, sign(t, jwt.SigningMethodES256, key, "ec", validClaims())); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+}
+
+// TestMiddlewareFollowsKeyRotations verifies the tokens of an ES256 keys file
+// with the key set HyperZoop serves, across a rotation.
+func TestMiddlewareFollowsKeyRotations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	set, err := token.NewKeySet(token.AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := token.OpenKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keyring.JWKS())
+	}))
+	defer server.Close()
+	auth, err := New(Config{JWKSURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func() string {
+		t.Helper()
+		accessToken, err := token.NewJwtAccessToken(keyring, token.UserClaims{
+			UserId:         "user",
+			Scope:          token.ScopeUser,
+			StandardClaims: jwt.StandardClaims{Id: "token", IssuedAt: time.Now().Unix(), ExpiresAt: time.Now().Add(time.Minute).Unix()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return accessToken
+	}
+
+	before := issue()
+	if w, _ := serve(auth.Middleware, before); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if err := set.Rotate(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	// a new modification time, as the save may land within the same tick
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	// the promoted key was already published as the next key
+	for _, accessToken := range []string{issue(), before} {
+		if w, _ := serve(auth.Middleware, accessToken); w.Code != http.StatusOK {
+			t.Fatalf("status = %d after the rotation, want 200", w.Code)
+		}
+	}
+}
+
+func TestNewRequiresOneKeySource(t *testing.T) {
+	if _, err := New(Config{}); !errors.Is(err, errNoKeySource) {
+		t.Errorf("New() error = %v, want errNoKeySource", err)
+	}
+	if _, err := New(Config{Secret: "secret", JWKSURL: "http://localhost"}); !errors.Is(err, errTwoKeySources) {
+		t.Errorf("New() error = %v, want errTwoKeySources", err)
+	}
+}
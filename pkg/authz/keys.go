@@ -0,0 +1,194 @@
+package authz
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	defaultJWKSRefresh = 5 * time.Minute
+	// minJWKSRefetch limits the fetches triggered by tokens with unknown keys.
+	minJWKSRefetch = 10 * time.Second
+)
+
+// keySource finds the key that verifies the tokens with the kid header.
+type keySource interface {
+	key(ctx context.Context, kid string) (any, error)
+}
+
+// secretKey verifies every token with the same secret, whatever its kid.
+type secretKey string
+
+func (s secretKey) key(ctx context.Context, kid string) (any, error) {
+	return []byte(s), nil
+}
+
+// methodFits keeps tokens from choosing an algorithm that doesn't match the
+// key, such as HMAC with a public key as the secret.
+func methodFits(method jwt.SigningMethod, key any) bool {
+	switch key.(type) {
+	case []byte:
+		_, ok := method.(*jwt.SigningMethodHMAC)
+		return ok
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		_, ok := method.(*jwt.SigningMethodECDSA)
+		return ok
+	}
+	return false
+}
+
+// errUnsupportedKey marks the keys of a set that can't verify tokens and are
+// skipped, as RFC 7517 asks.
+var errUnsupportedKey = errors.New("unsupported key type")
+
+// jwk is a public JSON Web Key (RFC 7517) of type RSA or EC. Secret oct keys
+// are not accepted from a key set: publishing them would let anyone issue tokens.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *jwk) key() (any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("%w %q", errUnsupportedKey, k.Kty)
+}
+
+// jwksCache fetches a key set and keeps it for refresh. When a fetch fails the
+// keys fetched before keep being used.
+type jwksCache struct {
+	url     string
+	client  *http.Client
+	refresh time.Duration
+	now     func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]any
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func newJWKSCache(url string, client *http.Client, refresh time.Duration) *jwksCache {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if refresh <= 0 {
+		refresh = defaultJWKSRefresh
+	}
+	return &jwksCache{url: url, client: client, refresh: refresh, now: time.Now}
+}
+
+func (c *jwksCache) key(ctx context.Context, kid string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	key, known := c.keys[kid]
+	if known && now.Sub(c.fetchedAt) < c.refresh {
+		return key, nil
+	}
+	if now.Sub(c.attemptedAt) >= minJWKSRefetch {
+		c.attemptedAt = now
+		keys, err := c.fetch(ctx)
+		if err == nil {
+			c.keys, c.fetchedAt = keys, now
+			key, known = keys[kid]
+		} else if c.keys == nil {
+			return nil, &unavailableError{fmt.Errorf("fetching the token keys: %w", err)}
+		}
+	}
+	if c.keys == nil {
+		return nil, &unavailableError{errors.New("the token keys couldn't be fetched")}
+	}
+	if !known {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+func (c *jwksCache) fetch(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", c.url, res.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.key()
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the key set has no signing key")
+	}
+	return keys, nil
+}
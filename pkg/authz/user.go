@@ -0,0 +1,41 @@
+package authz
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// User is the user an access token was issued to.
+type User struct {
+	ID    string
+	Email string
+	// SessionID is the HyperZoop session the token was refreshed from.
+	SessionID string
+	// TokenID is the jti claim, empty for tokens issued before HyperZoop set it.
+	TokenID string
+	// Roles are the scopes granted to the token, "user" and, for admins, "admin".
+	Roles     []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// HasRole reports whether the token was granted role.
+func (u *User) HasRole(role string) bool {
+	return slices.Contains(u.Roles, role)
+}
+
+type userKey struct{}
+
+// NewContext returns a copy of ctx carrying user, as the middlewares do. Tests
+// of handlers can use it to skip authentication.
+func NewContext(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the user stored by the middlewares, false when the
+// request wasn't authenticated.
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userKey{}).(*User)
+	return user, ok && user != nil
+}
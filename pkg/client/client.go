@@ -0,0 +1,236 @@
+// Package client calls the HyperZoop HTTP API. A Client holds the address of
+// the server; each signed-in user gets a Session, which keeps the
+// _fingerprint and _refresh cookies in its own jar and refreshes the access
+// token before it expires:
+//
+//	c, err := client.New("https://auth.hyperzoop.com")
+//	session := c.NewSession()
+//	session.Login(ctx, client.LoginRequest{Email: "user@hyperzoop.com"})
+//	// the user opens the emailed link, whose code goes to Verify
+//	session.Verify(ctx, code)
+//	sessions, err := session.Sessions(ctx)
+//
+// Failed requests return an *Error, which errors.Is matches against
+// ErrUnauthorized, ErrForbidden and the other errors of this package.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultRefreshMargin = time.Minute
+
+// Client calls one HyperZoop server. It is safe for concurrent use.
+type Client struct {
+	baseURL       *url.URL
+	httpClient    *http.Client
+	userAgent     string
+	refreshMargin time.Duration
+	clientID      string
+	clientSecret  string
+	now           func() time.Time
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with httpClient, keeping its transport and
+// timeout. Its cookie jar is ignored: every Session has its own.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithUserAgent sets the User-Agent header of the requests, which HyperZoop
+// shows in the sessions list.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// WithRefreshMargin refreshes access tokens when they expire within margin,
+// a minute by default.
+func WithRefreshMargin(margin time.Duration) Option {
+	return func(c *Client) { c.refreshMargin = margin }
+}
+
+// WithClientCredentials authenticates the Introspect and RevokeToken calls,
+// with a pair of the oauth_clients setting.
+func WithClientCredentials(id, secret string) Option {
+	return func(c *Client) {
+		c.clientID = id
+		c.clientSecret = secret
+	}
+}
+
+// New returns a client of the server at baseURL, like https://auth.hyperzoop.com.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("hyperzoop: base url must be an absolute http or https url")
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	c := &Client{baseURL: u, httpClient: http.DefaultClient, refreshMargin: defaultRefreshMargin, now: time.Now}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// request is an API call.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	// body is encoded as JSON, form as application/x-www-form-urlencoded.
+	body  any
+	form  url.Values
+	token string
+	basic bool
+	// decodeFailures decodes out from error responses too.
+	decodeFailures bool
+}
+
+// do sends req with httpClient and decodes a successful response into out,
+// which may be nil.
+func (c *Client) do(ctx context.Context, httpClient *http.Client, req request, out any) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += req.path
+	u.RawQuery = req.query.Encode()
+	var body io.Reader
+	contentType := ""
+	switch {
+	case req.body != nil:
+		raw, err := json.Marshal(req.body)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = bytes.NewReader(raw), "application/json"
+	case req.form != nil:
+		body, contentType = strings.NewReader(req.form.Encode()), "application/x-www-form-urlencoded"
+	}
+	r, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	if c.userAgent != "" {
+		r.Header.Set("User-Agent", c.userAgent)
+	}
+	if req.token != "" {
+		r.Header.Set("Authorization", "Bearer "+req.token)
+	}
+	if req.basic {
+		r.SetBasicAuth(c.clientID, c.clientSecret)
+	}
+	res, err := httpClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res, err
+	}
+	if res.StatusCode >= 300 && !req.decodeFailures {
+		return res, decodeError(res.StatusCode, raw)
+	}
+	if out != nil && len(bytes.TrimSpace(raw)) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil && res.StatusCode < 300 {
+			return res, err
+		}
+	}
+	if res.StatusCode >= 300 {
+		return res, decodeError(res.StatusCode, raw)
+	}
+	return res, nil
+}
+
+func decodeError(status int, raw []byte) *Error {
+	var body struct {
+		Message     string       `json:"message"`
+		Code        string       `json:"code"`
+		Title       string       `json:"title"`
+		Error       string       `json:"error"`
+		Description string       `json:"error_description"`
+		Errors      []FieldError `json:"errors"`
+	}
+	json.Unmarshal(raw, &body)
+	e := &Error{StatusCode: status, Message: body.Message, Code: body.Code, Fields: body.Errors}
+	// problem details and OAuth errors name things differently
+	if e.Message == "" {
+		e.Message = body.Title
+	}
+	if e.Message == "" {
+		e.Message = body.Description
+	}
+	if e.Code == "" {
+		e.Code = body.Error
+	}
+	return e
+}
+
+// NotMe confirms the "this wasn't me" link of a new device email with its
+// code, signing the reported session out.
+func (c *Client) NotMe(ctx context.Context, code string) error {
+	_, err := c.do(ctx, c.httpClient, request{method: http.MethodPost, path: "/auth/not-me", form: url.Values{"code": {code}}}, nil)
+	return err
+}
+
+// Introspect describes token, an access or a refresh token. It needs
+// WithClientCredentials.
+func (c *Client) Introspect(ctx context.Context, token string) (*Introspection, error) {
+	out := new(Introspection)
+	_, err := c.do(ctx, c.httpClient, request{method: http.MethodPost, path: "/oauth/introspect", form: url.Values{"token": {token}}, basic: true}, out)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RevokeToken revokes token, an access or a refresh token. It needs
+// WithClientCredentials.
+func (c *Client) RevokeToken(ctx context.Context, token string) error {
+	_, err := c.do(ctx, c.httpClient, request{method: http.MethodPost, path: "/oauth/revoke", form: url.Values{"token": {token}}, basic: true}, nil)
+	return err
+}
+
+// Live checks that the server is running.
+func (c *Client) Live(ctx context.Context) error {
+	_, err := c.do(ctx, c.httpClient, request{method: http.MethodGet, path: "/healthz"}, nil)
+	return err
+}
+
+// Ready runs the readiness checks of the server. The report is returned along
+// with ErrUnavailable when a check failed.
+func (c *Client) Ready(ctx context.Context) (*HealthReport, error) {
+	report := new(HealthReport)
+	if _, err := c.do(ctx, c.httpClient, request{method: http.MethodGet, path: "/readyz", decodeFailures: true}, report); err != nil {
+		if report.Status == "" {
+			return nil, err
+		}
+		return report, err
+	}
+	return report, nil
+}
+
+// Jobs returns the stats of the background jobs of the replica that answers.
+func (c *Client) Jobs(ctx context.Context) ([]JobStats, error) {
+	var out []JobStats
+	if _, err := c.do(ctx, c.httpClient, request{method: http.MethodGet, path: "/healthz/jobs"}, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,402 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer mimics the cookies and JSON shapes of the HyperZoop API.
+type fakeServer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu sync.Mutex
+	// now is the time of the server and of the client under test.
+	now       time.Time
+	tokenTTL  time.Duration
+	extendTo  time.Time
+	issued    int
+	refreshes int
+	valid     map[string]bool
+	sessions  map[string]bool
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	f := &fakeServer{t: t, now: time.Now(), tokenTTL: 15 * time.Minute, valid: map[string]bool{}, sessions: map[string]bool{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/login", f.login)
+	mux.HandleFunc("/auth/verify", f.verify)
+	mux.HandleFunc("/auth/refresh", f.refresh)
+	mux.HandleFunc("/auth/session", f.authorized(f.list))
+	mux.HandleFunc("/auth/logout", f.authorized(f.logout))
+	mux.HandleFunc("/auth/session/others", f.authorized(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]int64{"revoked": 2})
+	}))
+	mux.HandleFunc("/admin/users/", f.authorized(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin/users/other/sessions" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"message": "you are not authorized to perform this action", "status_code": "403"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int64{"revoked": 3})
+	}))
+	mux.HandleFunc("/oauth/introspect", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "gateway" || secret != "secret" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"active": f.validToken(r.PostFormValue("token")), "sub": "user"})
+	})
+	mux.HandleFunc("/auth/not-me", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method != http.MethodPost:
+			// the link only shows a confirmation page
+			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			w.Write([]byte("<form method=\"post\"></form>"))
+		case r.PostFormValue("code") != "not-me":
+			writeJSON(w, http.StatusGone, map[string]string{"message": "this link has expired or was already used", "status_code": "410", "code": "link_expired"})
+		default:
+			writeJSON(w, http.StatusOK, map[string]string{"message": "the device was signed out"})
+		}
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "down", "checks": map[string]any{"redis": map[string]string{"status": "down", "error": "refused"}}})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (f *fakeServer) clock() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeServer) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func (f *fakeServer) validToken(token string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.valid[token]
+}
+
+// issue returns an unsigned token with the exp claim, which is all the client reads.
+func (f *fakeServer) issue() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.issued++
+	payload, _ := json.Marshal(map[string]any{"id": "user", "exp": f.now.Add(f.tokenTTL).Unix(), "n": f.issued})
+	token := "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+	f.valid[token] = true
+	return token
+}
+
+func (f *fakeServer) login(w http.ResponseWriter, r *http.Request) {
+	var body LoginRequest
+	json.NewDecoder(r.Body).Decode(&body)
+	if !strings.Contains(body.Email, "@") {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"message": "invalid request body", "status_code": "422", "errors": []FieldError{{Field: "email", Rule: "email", Message: "must be an email address"}}})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: "_fingerprint", Value: "fingerprint", Path: "/", HttpOnly: true})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "magic link sent"})
+}
+
+func (f *fakeServer) verify(w http.ResponseWriter, r *http.Request) {
+	fingerprint, err := r.Cookie("_fingerprint")
+	if err != nil || fingerprint.Value != "fingerprint" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "fingerprint not found", "status_code": "400"})
+		return
+	}
+	switch r.URL.Query().Get("code") {
+	case "step-up":
+		writeJSON(w, http.StatusForbidden, map[string]string{"message": "confirm it", "status_code": "403", "code": "step_up_required"})
+		return
+	case "step-up-problem":
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"type":"urn:hyperzoop:problem:step_up_required","title":"confirm it","status":403,"code":"step_up_required"}`))
+		return
+	case "forbidden":
+		writeJSON(w, http.StatusForbidden, map[string]string{"message": "forbidden"})
+		return
+	case "blocked":
+		writeJSON(w, http.StatusForbidden, map[string]string{"message": "this user is blocked", "status_code": "403", "code": "user_blocked"})
+		return
+	case "problem":
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"type":"urn:hyperzoop:problem:link_not_found","title":"no magic link found","status":404,"code":"link_not_found"}`))
+		return
+	}
+	f.mu.Lock()
+	f.sessions["session"] = true
+	f.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: "_refresh", Value: "session", Path: "/", Expires: f.clock().Add(24 * time.Hour), HttpOnly: true})
+	writeJSON(w, http.StatusOK, map[string]any{"user": map[string]string{"id": "user", "email": "user@hyperzoop.com"}, "access_token": f.issue()})
+}
+
+func (f *fakeServer) refresh(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("_refresh")
+	f.mu.Lock()
+	known := err == nil && f.sessions[cookie.Value]
+	f.refreshes++
+	extendTo := f.extendTo
+	f.mu.Unlock()
+	if !known {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"message": "session not found or already expired", "status_code": "500"})
+		return
+	}
+	out := map[string]any{"access_token": f.issue(), "user": map[string]string{"id": "user"}}
+	if !extendTo.IsZero() {
+		out["refresh_token"], out["expires_in"] = cookie.Value, extendTo
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (f *fakeServer) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !f.validToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (f *fakeServer) list(w http.ResponseWriter, r *http.Request) {
+	cookie, _ := r.Cookie("_refresh")
+	writeJSON(w, http.StatusOK, []map[string]any{{"id": "session", "user_id": "user", "current": cookie != nil && cookie.Value == "session"}})
+}
+
+func (f *fakeServer) logout(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.sessions, r.URL.Query().Get("session"))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeServer) newClient(t *testing.T, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(f.URL+"/", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.now = f.clock
+	return c
+}
+
+func (f *fakeServer) signIn(t *testing.T, c *Client) *Session {
+	t.Helper()
+	ctx := context.Background()
+	s := c.NewSession()
+	if _, err := s.Login(ctx, LoginRequest{Email: "user@hyperzoop.com"}); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if _, err := s.Verify(ctx, "code"); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	return s
+}
+
+func TestSessionSignIn(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeServer(t)
+	c := f.newClient(t)
+	s := f.signIn(t, c)
+
+	if s.RefreshToken() != "session" || s.User().Email != "user@hyperzoop.com" {
+		t.Fatalf("RefreshToken() = %q, User() = %+v", s.RefreshToken(), s.User())
+	}
+	sessions, err := s.Sessions(ctx)
+	if err != nil || len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("Sessions() = %+v, %v", sessions, err)
+	}
+	if revoked, err := s.RevokeOthers(ctx); err != nil || revoked != 2 {
+		t.Fatalf("RevokeOthers() = %d, %v", revoked, err)
+	}
+	if revoked, err := s.RevokeUserSessions(ctx, "other"); err != nil || revoked != 3 {
+		t.Fatalf("RevokeUserSessions() = %d, %v", revoked, err)
+	}
+	if _, err := s.RevokeUserSessions(ctx, "admin"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("RevokeUserSessions() error = %v, want ErrForbidden", err)
+	}
+	if f.refreshes != 0 {
+		t.Fatalf("refreshed %d times, want the verified token reused", f.refreshes)
+	}
+
+	if err := s.Logout(ctx); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if s.RefreshToken() != "" || f.sessions["session"] {
+		t.Fatal("Logout() kept the session")
+	}
+	if _, err := s.Sessions(ctx); !errors.Is(err, ErrNotSignedIn) {
+		t.Fatalf("Sessions() after Logout() error = %v, want ErrNotSignedIn", err)
+	}
+}
+
+func TestSessionRefreshesBeforeExpiry(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeServer(t)
+	c := f.newClient(t, WithRefreshMargin(time.Minute))
+	s := f.signIn(t, c)
+
+	first, _ := s.AccessToken(ctx)
+	f.advance(13 * time.Minute)
+	if token, _ := s.AccessToken(ctx); token != first || f.refreshes != 0 {
+		t.Fatal("refreshed a token valid for two more minutes")
+	}
+	f.advance(90 * time.Second)
+	second, err := s.AccessToken(ctx)
+	if err != nil || second == first || f.refreshes != 1 {
+		t.Fatalf("AccessToken() = %v after %d refreshes, want a new token", err, f.refreshes)
+	}
+
+	// extending the session keeps the refresh token past the first expiry
+	f.extendTo = f.clock().Add(48 * time.Hour)
+	if _, err := s.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	f.advance(30 * time.Hour)
+	if s.RefreshToken() != "session" {
+		t.Fatal("the extended refresh token expired with the first cookie")
+	}
+	if _, err := s.Sessions(ctx); err != nil {
+		t.Fatalf("Sessions() error = %v", err)
+	}
+}
+
+func TestSessionRetriesRefusedTokens(t *testing.T) {
+	f := newFakeServer(t)
+	s := f.signIn(t, f.newClient(t))
+	token, _ := s.AccessToken(context.Background())
+	// the server revokes the token, say after a key rotation
+	f.valid[token] = false
+	if _, err := s.Sessions(context.Background()); err != nil {
+		t.Fatalf("Sessions() error = %v, want a retry with a new token", err)
+	}
+	if f.refreshes != 1 {
+		t.Fatalf("refreshed %d times, want 1", f.refreshes)
+	}
+}
+
+func TestResumeSession(t *testing.T) {
+	f := newFakeServer(t)
+	f.signIn(t, f.newClient(t))
+	s := f.newClient(t).ResumeSession("session")
+	if _, err := s.Sessions(context.Background()); err != nil {
+		t.Fatalf("Sessions() error = %v", err)
+	}
+	if _, err := f.newClient(t).ResumeSession("unknown").Sessions(context.Background()); !errors.Is(err, ErrServer) {
+		t.Fatalf("Sessions() of an unknown session error = %v, want ErrServer", err)
+	}
+}
+
+func TestVerifyStepUp(t *testing.T) {
+	f := newFakeServer(t)
+	for _, code := range []string{"step-up", "step-up-problem"} {
+		s := f.newClient(t).NewSession()
+		s.Login(context.Background(), LoginRequest{Email: "user@hyperzoop.com"})
+		if _, err := s.Verify(context.Background(), code); !errors.Is(err, ErrStepUpRequired) {
+			t.Fatalf("Verify(%q) error = %v, want ErrStepUpRequired", code, err)
+		}
+	}
+	s := f.newClient(t).NewSession()
+	s.Login(context.Background(), LoginRequest{Email: "user@hyperzoop.com"})
+	_, err := s.Verify(context.Background(), "blocked")
+	var apiErr *Error
+	if errors.Is(err, ErrStepUpRequired) || !errors.As(err, &apiErr) || apiErr.Code != "user_blocked" {
+		t.Fatalf("Verify() of a blocked user error = %#v, want user_blocked", err)
+	}
+	// only the code tells step-ups apart from other refusals
+	if _, err := s.Verify(context.Background(), "forbidden"); errors.Is(err, ErrStepUpRequired) || !errors.Is(err, ErrForbidden) {
+		t.Fatalf("Verify() of a 403 without code error = %v, want ErrForbidden", err)
+	}
+	_, err = s.Verify(context.Background(), "problem")
+	if !errors.As(err, &apiErr) || apiErr.Code != "link_not_found" || apiErr.Message != "no magic link found" || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Verify() error = %#v, want the problem details", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeServer(t)
+	_, err := f.newClient(t).NewSession().Login(ctx, LoginRequest{Email: "invalid"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.Message != "invalid request body" || !errors.Is(err, ErrInvalidInput) ||
+		len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "email" {
+		t.Fatalf("Login() error = %#v, want the invalid input error", err)
+	}
+	if _, err := f.newClient(t).NewSession().Verify(ctx, "code"); !errors.Is(err, ErrBadRequest) || err.Error() != "hyperzoop: 400 fingerprint not found" {
+		t.Fatalf("Verify() without Login() error = %v", err)
+	}
+	_, err = f.newClient(t, WithClientCredentials("gateway", "wrong")).Introspect(ctx, "token")
+	if !errors.As(err, &apiErr) || apiErr.Code != "invalid_client" || !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Introspect() error = %#v, want invalid_client", err)
+	}
+	report, err := f.newClient(t).Ready(ctx)
+	if !errors.Is(err, ErrUnavailable) || report == nil || report.Checks["redis"].Error != "refused" {
+		t.Fatalf("Ready() = %+v, %v, want the failing report", report, err)
+	}
+}
+
+func TestNotMe(t *testing.T) {
+	c := newFakeServer(t).newClient(t)
+	if err := c.NotMe(context.Background(), "not-me"); err != nil {
+		t.Fatalf("NotMe() error = %v", err)
+	}
+	var apiErr *Error
+	if err := c.NotMe(context.Background(), "expired"); !errors.As(err, &apiErr) || apiErr.Code != "link_expired" {
+		t.Fatalf("NotMe() of an expired link error = %v, want link_expired", err)
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	f := newFakeServer(t)
+	s := f.signIn(t, f.newClient(t))
+	token, _ := s.AccessToken(context.Background())
+	out, err := f.newClient(t, WithClientCredentials("gateway", "secret")).Introspect(context.Background(), token)
+	if err != nil || !out.Active || out.Sub != "user" {
+		t.Fatalf("Introspect() = %+v, %v", out, err)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"exp":1700000000}`))
+	if got := tokenExpiry(fmt.Sprintf("e30.%s.sig", payload)); !got.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("tokenExpiry() = %v", got)
+	}
+	for _, token := range []string{"", "garbage", "a.b.c", "e30.e30.sig"} {
+		if got := tokenExpiry(token); !got.IsZero() {
+			t.Errorf("tokenExpiry(%q) = %v, want the zero time", token, got)
+		}
+	}
+}
+
+func TestNewRejectsRelativeURLs(t *testing.T) {
+	for _, raw := range []string{"auth.hyperzoop.com", "/auth", "ftp://auth.hyperzoop.com"} {
+		if _, err := New(raw); err == nil {
+			t.Errorf("New(%q) accepted a relative url", raw)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors the *Error returned for a failed request matches with errors.Is,
+// by status code.
+var (
+	ErrBadRequest   = errors.New("hyperzoop: bad request")
+	ErrUnauthorized = errors.New("hyperzoop: unauthorized")
+	ErrForbidden    = errors.New("hyperzoop: forbidden")
+	ErrNotFound     = errors.New("hyperzoop: not found")
+	ErrInvalidInput = errors.New("hyperzoop: invalid input")
+	ErrRateLimited  = errors.New("hyperzoop: rate limited")
+	ErrUnavailable  = errors.New("hyperzoop: service unavailable")
+	ErrServer       = errors.New("hyperzoop: server error")
+)
+
+var (
+	// ErrStepUpRequired is returned by Verify when the sign-in looked risky,
+	// answered with a 403 step_up_required: the user was emailed a new link
+	// to confirm it.
+	ErrStepUpRequired = errors.New("hyperzoop: the sign-in must be confirmed with the link just emailed")
+	// ErrNotSignedIn is returned by the calls needing a session before one was
+	// verified or resumed, or after it was logged out.
+	ErrNotSignedIn = errors.New("hyperzoop: not signed in")
+)
+
+// Error is a response of the API with an error status. Message and Code come
+// from the {"message", "status_code", "code"} body of most endpoints, their
+// problem details, or the error_description and error of the OAuth endpoints.
+// Code is stable, unlike Message. Fields lists what was wrong with the body
+// of a 422.
+type Error struct {
+	StatusCode int
+	Message    string
+	Code       string
+	Fields     []FieldError
+}
+
+// FieldError is a rule a field of the request body broke. Field is empty
+// when the whole body is wrong, like invalid JSON.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("hyperzoop: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("hyperzoop: %d %s", e.StatusCode, e.Message)
+}
+
+// Is matches the sentinel error of the status code.
+func (e *Error) Is(target error) bool {
+	return target == e.kind()
+}
+
+func (e *Error) kind() error {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusUnprocessableEntity:
+		return ErrInvalidInput
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	}
+	if e.StatusCode >= 500 {
+		return ErrServer
+	}
+	return nil
+}
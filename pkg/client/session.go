@@ -0,0 +1,293 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const refreshCookie = "_refresh"
+
+// stepUpRequired is the code of the 403 answered by /auth/verify for step-ups.
+const stepUpRequired = "step_up_required"
+
+// Session is the sign-in of one user: its cookie jar holds the fingerprint
+// between Login and Verify, then the refresh token. It is safe for concurrent
+// use; concurrent calls share a single refresh.
+type Session struct {
+	client     *Client
+	jar        *sessionJar
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+	user        *User
+}
+
+// sessionJar keeps the refresh token apart from the other cookies: the
+// server sets it for the app_host domain but the session extends it for the
+// host of the base url, and both must be one cookie.
+type sessionJar struct {
+	http.CookieJar
+	host string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	refresh *http.Cookie
+}
+
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	rest := make([]*http.Cookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		if cookie.Name != refreshCookie {
+			rest = append(rest, cookie)
+			continue
+		}
+		j.mu.Lock()
+		if cookie.Value == "" || cookie.MaxAge < 0 || !cookie.Expires.IsZero() && !cookie.Expires.After(j.now()) {
+			j.refresh = nil
+		} else {
+			j.refresh = &http.Cookie{Name: refreshCookie, Value: cookie.Value, Expires: cookie.Expires}
+		}
+		j.mu.Unlock()
+	}
+	j.CookieJar.SetCookies(u, rest)
+}
+
+func (j *sessionJar) Cookies(u *url.URL) []*http.Cookie {
+	cookies := j.CookieJar.Cookies(u)
+	if token := j.refreshToken(); token != "" && u.Host == j.host {
+		cookies = append(cookies, &http.Cookie{Name: refreshCookie, Value: token})
+	}
+	return cookies
+}
+
+func (j *sessionJar) refreshToken() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.refresh == nil || !j.refresh.Expires.IsZero() && !j.refresh.Expires.After(j.now()) {
+		return ""
+	}
+	return j.refresh.Value
+}
+
+// NewSession returns a session with an empty cookie jar, ready for Login.
+func (c *Client) NewSession() *Session {
+	cookies, _ := cookiejar.New(nil)
+	jar := &sessionJar{CookieJar: cookies, host: c.baseURL.Host, now: c.now}
+	httpClient := *c.httpClient
+	httpClient.Jar = jar
+	return &Session{client: c, jar: jar, httpClient: &httpClient}
+}
+
+// ResumeSession returns a session signed in with refreshToken, as returned by
+// RefreshToken, for instance after a restart. The access token is fetched by
+// the first call needing it.
+func (c *Client) ResumeSession(refreshToken string) *Session {
+	s := c.NewSession()
+	s.setRefreshToken(refreshToken, time.Time{})
+	return s
+}
+
+// RefreshToken returns the refresh token of the session, empty when it isn't
+// signed in. Store it to resume the session later.
+func (s *Session) RefreshToken() string {
+	return s.jar.refreshToken()
+}
+
+// User returns the signed-in user as of the last verification or refresh.
+func (s *Session) User() *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.user
+}
+
+func (s *Session) setRefreshToken(value string, expires time.Time) {
+	s.jar.SetCookies(s.client.baseURL, []*http.Cookie{{Name: refreshCookie, Value: value, Path: "/", Expires: expires}})
+}
+
+// Login asks for a magic link to be emailed, storing the fingerprint cookie
+// Verify needs.
+func (s *Session) Login(ctx context.Context, input LoginRequest) (*LoginResult, error) {
+	out := new(LoginResult)
+	if _, err := s.client.do(ctx, s.httpClient, request{method: http.MethodPost, path: "/auth/login", body: input}, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Verify signs in with the code of a magic link asked for by Login on this
+// session. It returns ErrStepUpRequired when the user must confirm the sign-in
+// with the new link just emailed, which is verified with this session too.
+func (s *Session) Verify(ctx context.Context, code string) (*VerifyResult, error) {
+	out := new(VerifyResult)
+	_, err := s.client.do(ctx, s.httpClient, request{method: http.MethodGet, path: "/auth/verify", query: url.Values{"code": {code}}}, out)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden && apiErr.Code == stepUpRequired {
+		return nil, ErrStepUpRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.setAccessToken(out.AccessToken)
+	s.user = &out.User
+	s.mu.Unlock()
+	return out, nil
+}
+
+// Refresh gets a new access token with the refresh token, which the server
+// may extend.
+func (s *Session) Refresh(ctx context.Context) (*RefreshResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refresh(ctx)
+}
+
+func (s *Session) refresh(ctx context.Context) (*RefreshResult, error) {
+	if s.RefreshToken() == "" {
+		return nil, ErrNotSignedIn
+	}
+	out := new(RefreshResult)
+	if _, err := s.client.do(ctx, s.httpClient, request{method: http.MethodPost, path: "/auth/refresh"}, out); err != nil {
+		return nil, err
+	}
+	s.setAccessToken(out.AccessToken)
+	s.user = &out.User
+	if out.RefreshToken != nil && out.ExpiresIn != nil {
+		// the server extends the session without setting the cookie again
+		s.setRefreshToken(*out.RefreshToken, *out.ExpiresIn)
+	}
+	return out, nil
+}
+
+func (s *Session) setAccessToken(accessToken string) {
+	s.accessToken = accessToken
+	s.expiresAt = tokenExpiry(accessToken)
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it, the zero
+// time when it can't.
+func tokenExpiry(accessToken string) time.Time {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}
+	}
+	exp, err := strconv.ParseInt(claims.Exp.String(), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(exp, 0)
+}
+
+// AccessToken returns an access token valid for at least the refresh margin,
+// refreshing it first when needed.
+func (s *Session) AccessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken != "" && s.client.now().Add(s.client.refreshMargin).Before(s.expiresAt) {
+		return s.accessToken, nil
+	}
+	if _, err := s.refresh(ctx); err != nil {
+		return "", err
+	}
+	return s.accessToken, nil
+}
+
+// authorized sends req with the access token, refreshing it and trying again
+// once when the server refuses it, for instance after a key rotation.
+func (s *Session) authorized(ctx context.Context, req request, out any) error {
+	accessToken, err := s.AccessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req.token = accessToken
+	_, err = s.client.do(ctx, s.httpClient, req, out)
+	if !errors.Is(err, ErrUnauthorized) {
+		return err
+	}
+	s.mu.Lock()
+	if s.accessToken == accessToken {
+		_, err = s.refresh(ctx)
+	}
+	req.token = s.accessToken
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = s.client.do(ctx, s.httpClient, req, out)
+	return err
+}
+
+// Sessions lists the sessions of the user, flagging this one as current.
+func (s *Session) Sessions(ctx context.Context) ([]SessionInfo, error) {
+	var out []SessionInfo
+	if err := s.authorized(ctx, request{method: http.MethodGet, path: "/auth/session"}, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Logout signs out this session and forgets its tokens.
+func (s *Session) Logout(ctx context.Context) error {
+	refreshToken := s.RefreshToken()
+	if refreshToken == "" {
+		return ErrNotSignedIn
+	}
+	if err := s.RevokeSession(ctx, refreshToken); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken, s.expiresAt, s.user = "", time.Time{}, nil
+	s.setRefreshToken("", time.Time{})
+	return nil
+}
+
+// RevokeSession signs out another session of the user, listed by Sessions.
+func (s *Session) RevokeSession(ctx context.Context, sessionID string) error {
+	return s.authorized(ctx, request{method: http.MethodPut, path: "/auth/logout", query: url.Values{"session": {sessionID}}}, nil)
+}
+
+// RevokeOthers signs out every session of the user but this one and returns
+// how many there were.
+func (s *Session) RevokeOthers(ctx context.Context) (int64, error) {
+	var out struct {
+		Revoked int64 `json:"revoked"`
+	}
+	if err := s.authorized(ctx, request{method: http.MethodDelete, path: "/auth/session/others"}, &out); err != nil {
+		return 0, err
+	}
+	return out.Revoked, nil
+}
+
+// RevokeUserSessions signs the user out everywhere. Only admins may do it for
+// other users.
+func (s *Session) RevokeUserSessions(ctx context.Context, userID string) (int64, error) {
+	var out struct {
+		Revoked int64 `json:"revoked"`
+	}
+	if err := s.authorized(ctx, request{method: http.MethodDelete, path: "/admin/users/" + url.PathEscape(userID) + "/sessions"}, &out); err != nil {
+		return 0, err
+	}
+	return out.Revoked, nil
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type User struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Avatar    *string   `json:"avatar"`
+	Blocked   bool      `json:"blocked"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SessionInfo describes a signed-in device of the user, as listed by Sessions.
+type SessionInfo struct {
+	ID               string    `json:"id"`
+	UserID           string    `json:"user_id"`
+	ValidUntil       time.Time `json:"valid_until"`
+	UserAgent        *string   `json:"user_agent"`
+	IP               *string   `json:"ip"`
+	Latitude         *float64  `json:"latitude"`
+	Longitude        *float64  `json:"longitude"`
+	City             *string   `json:"city"`
+	Region           *string   `json:"region"`
+	Country          *string   `json:"country"`
+	OrganizationName *string   `json:"organization_name"`
+	Browser          string    `json:"browser"`
+	BrowserVersion   string    `json:"browser_version"`
+	OS               string    `json:"os"`
+	DeviceType       string    `json:"device_type"`
+	DeviceLabel      string    `json:"device_label"`
+	LastUsedAt       time.Time `json:"last_used_at"`
+	LastIP           *string   `json:"last_ip"`
+	RefreshCount     int64     `json:"refresh_count"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	// Current is set on the session of the client.
+	Current bool `json:"current"`
+}
+
+type LoginRequest struct {
+	Email    string  `json:"email"`
+	Username *string `json:"username,omitempty"`
+	Avatar   *string `json:"avatar,omitempty"`
+}
+
+type LoginResult struct {
+	Message string `json:"message"`
+}
+
+type VerifyResult struct {
+	User        User   `json:"user"`
+	AccessToken string `json:"access_token"`
+}
+
+type RefreshResult struct {
+	AccessToken string `json:"access_token"`
+	// RefreshToken and ExpiresIn are set when the session was extended.
+	RefreshToken *string    `json:"refresh_token"`
+	ExpiresIn    *time.Time `json:"expires_in"`
+	User         User       `json:"user"`
+}
+
+// Introspection is the RFC 7662 description of a token.
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthReport is the answer of the readiness check.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// JobStats describes the last runs of a background job on the replica that answered.
+type JobStats struct {
+	Name         string          `json:"name"`
+	Interval     string          `json:"interval"`
+	Runs         int64           `json:"runs"`
+	Failures     int64           `json:"failures"`
+	Skipped      int64           `json:"skipped"`
+	LastRunAt    *time.Time      `json:"last_run_at,omitempty"`
+	LastDuration string          `json:"last_duration,omitempty"`
+	LastError    string          `json:"last_error,omitempty"`
+	LastResult   json.RawMessage `json:"last_result,omitempty"`
+}